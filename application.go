@@ -0,0 +1,126 @@
+package glacier
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mylxsw/glacier/infra"
+)
+
+// Run 以非阻塞的方式启动应用，返回应用句柄，ctx 被取消时触发优雅停机
+func (impl *framework) Run(ctx context.Context, flagCtx infra.FlagContext) infra.Application {
+	app := newApplication()
+	go func() {
+		select {
+		case <-ctx.Done():
+			app.shutdown()
+		case <-app.done:
+		}
+	}()
+
+	go func() {
+		app.finish(impl.start(flagCtx, app))
+	}()
+
+	return app
+}
+
+// StartAsync 以非阻塞的方式启动应用，等同于 Run(context.Background(), flagCtx)
+func (impl *framework) StartAsync(flagCtx infra.FlagContext) infra.Application {
+	return impl.Run(context.Background(), flagCtx)
+}
+
+// application 非阻塞启动的应用句柄
+type application struct {
+	boundCh chan struct{}
+	ready   chan struct{}
+	done    chan struct{}
+
+	resolver infra.Resolver
+	gf       infra.Graceful
+	err      error
+
+	boundOnce sync.Once
+	readyOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func newApplication() *application {
+	return &application{
+		boundCh: make(chan struct{}),
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// bound 容器创建完成
+func (app *application) bound(resolver infra.Resolver, gf infra.Graceful) {
+	app.boundOnce.Do(func() {
+		app.resolver, app.gf = resolver, gf
+		close(app.boundCh)
+	})
+}
+
+func (app *application) markReady() {
+	app.readyOnce.Do(func() { close(app.ready) })
+}
+
+// finish 应用退出，err 为 Start 的返回值
+func (app *application) finish(err error) {
+	app.err = err
+	close(app.done)
+}
+
+// shutdown 触发优雅停机，容器尚未创建时，等待容器创建完成后再停机
+// 内置的 Graceful 在 Start 执行之前会缓存停机信号，停机开始之后不再阻塞，因此 Start 在此期间返回也不会导致 goroutine 泄露
+func (app *application) shutdown() {
+	app.stopOnce.Do(func() {
+		go func() {
+			select {
+			case <-app.boundCh:
+			case <-app.done:
+				return
+			}
+
+			app.gf.Shutdown()
+		}()
+	})
+}
+
+func (app *application) Ready() <-chan struct{} {
+	return app.ready
+}
+
+func (app *application) Done() <-chan struct{} {
+	return app.done
+}
+
+func (app *application) Stop(ctx context.Context) error {
+	app.shutdown()
+
+	select {
+	case <-app.done:
+		return app.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (app *application) Wait() error {
+	<-app.done
+	return app.err
+}
+
+func (app *application) Resolver() infra.Resolver {
+	select {
+	case <-app.boundCh:
+		return app.resolver
+	case <-app.done:
+		select {
+		case <-app.boundCh:
+			return app.resolver
+		default:
+			return nil
+		}
+	}
+}
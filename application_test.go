@@ -0,0 +1,108 @@
+package glacier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/infra"
+)
+
+type appTestService struct{ stopped chan struct{} }
+
+func (s *appTestService) Start() error {
+	<-s.stopped
+	return nil
+}
+
+func (s *appTestService) Stop() { close(s.stopped) }
+
+func TestRunApplication(t *testing.T) {
+	service := &appTestService{stopped: make(chan struct{})}
+
+	impl := New("1.0", 1).(*framework)
+	impl.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	impl.Singleton(func() *appTestService { return service })
+	impl.Service(service)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app := impl.Run(ctx, NewFlagContext())
+
+	select {
+	case <-app.Ready():
+	case <-app.Done():
+		t.Fatalf("application exited before ready: %v", app.Wait())
+	case <-time.After(time.Second):
+		t.Fatal("application should be ready")
+	}
+
+	app.Resolver().MustResolve(func(s *appTestService) {
+		if s != service {
+			t.Error("unexpected service")
+		}
+	})
+
+	cancel()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer stopCancel()
+
+	if err := app.Stop(stopCtx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case <-service.stopped:
+	default:
+		t.Error("service should be stopped")
+	}
+}
+
+func TestRunApplicationReadyAbort(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	impl.OnServerReadyHook(func() error { return errors.New("migration failed") }, SetReadyHookAbortOption())
+
+	app := impl.Run(context.Background(), NewFlagContext())
+
+	select {
+	case <-app.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("application should exit when an abort hook fails")
+	}
+
+	if err := app.Wait(); err == nil || !strings.Contains(err.Error(), "migration failed") {
+		t.Errorf("abort hook error should be returned, got %v", err)
+	}
+}
+
+type bootFailedService struct{}
+
+func (bootFailedService) Init(resolver infra.Resolver) error { return errors.New("init failed") }
+func (bootFailedService) Start() error                       { return nil }
+
+func TestStartBootFailure(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	impl.Service(bootFailedService{})
+
+	cancelled := make(chan struct{})
+	impl.Async(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	if err := impl.Start(NewFlagContext()); err == nil || !strings.Contains(err.Error(), "init failed") {
+		t.Fatalf("expect boot error, got %v", err)
+	}
+
+	// 启动失败时已经启动的异步任务会随着 ctx 取消而退出
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("context should be cancelled when boot fails")
+	}
+}
@@ -17,6 +17,8 @@ func (s Status) String() string {
 		return "Initialized"
 	case Started:
 		return "Started"
+	case Stopping:
+		return "Stopping"
 	}
 
 	return "Unknown"
@@ -26,6 +28,7 @@ const (
 	Unknown     Status = 0
 	Initialized Status = 1
 	Started     Status = 2
+	Stopping    Status = 3
 )
 
 type namedFunc struct {
@@ -0,0 +1,392 @@
+package glacier
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
+	"github.com/mylxsw/go-ioc"
+)
+
+const (
+	// bindingModuleGlacier 框架内置绑定的来源，覆盖框架内置绑定不会被视为冲突
+	bindingModuleGlacier = "glacier"
+	// bindingModuleApp 通过 Glacier.Singleton/Prototype/PreBind 添加的绑定的来源
+	bindingModuleApp = "app"
+)
+
+// WithBindingConflictPolicy 设置不同模块绑定同一个 key 时的处理策略
+func (impl *framework) WithBindingConflictPolicy(policy infra.BindingConflictPolicy) infra.Glacier {
+	if impl.status >= Initialized {
+		panic("[glacier] can not invoke this method after Glacier has been initialize")
+	}
+
+	impl.bindings.policy = policy
+	return impl
+}
+
+// Bindings 返回容器中所有记录的绑定，按照绑定顺序排列
+func (impl *framework) Bindings() []infra.BindingInfo {
+	return impl.bindings.all()
+}
+
+// binder 返回记录绑定来源的 Binder，module 为绑定来源，scope 不为空时表示 ScopedProvider 的子容器
+func (impl *framework) binder(cc ioc.Container, module string, scope string) infra.Binder {
+	return &recordingBinder{cc: cc, registry: impl.bindings, module: module, scope: scope}
+}
+
+type bindingKey struct {
+	scope string
+	key   interface{}
+}
+
+type bindingRecord struct {
+	key      interface{}
+	info     infra.BindingInfo
+	resolved int32
+}
+
+// bindingRegistry 记录容器中每个绑定的来源模块
+type bindingRegistry struct {
+	policy infra.BindingConflictPolicy
+
+	lock    sync.RWMutex
+	records []*bindingRecord
+	index   map[bindingKey]*bindingRecord
+}
+
+func newBindingRegistry() *bindingRegistry {
+	return &bindingRegistry{records: make([]*bindingRecord, 0), index: make(map[bindingKey]*bindingRecord)}
+}
+
+// reset 清空所有记录，每次创建全局容器时调用
+func (r *bindingRegistry) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.records = make([]*bindingRecord, 0)
+	r.index = make(map[bindingKey]*bindingRecord)
+}
+
+func (r *bindingRegistry) all() []infra.BindingInfo {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	results := make([]infra.BindingInfo, 0, len(r.records))
+	for _, rec := range r.records {
+		// 被覆盖的绑定不再输出
+		if r.index[bindingKey{scope: rec.info.Scope, key: rec.key}] != rec {
+			continue
+		}
+
+		info := rec.info
+		info.Resolved = atomic.LoadInt32(&rec.resolved) == 1
+		results = append(results, info)
+	}
+
+	return results
+}
+
+// removeScope 删除指定作用域及其子作用域（ScopedProvider 子容器）中的所有绑定记录，运行时挂载的模块卸载时调用
+func (r *bindingRegistry) removeScope(scope string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	inScope := func(s string) bool { return s == scope || strings.HasPrefix(s, scope+"/") }
+
+	records := make([]*bindingRecord, 0, len(r.records))
+	for _, rec := range r.records {
+		if !inScope(rec.info.Scope) {
+			records = append(records, rec)
+		}
+	}
+	r.records = records
+
+	for k := range r.index {
+		if inScope(k.scope) {
+			delete(r.index, k)
+		}
+	}
+}
+
+// lookup 查找某个 key 在指定容器中的绑定来源
+func (r *bindingRegistry) lookup(scope string, key interface{}) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if rec, ok := r.index[bindingKey{scope: scope, key: key}]; ok {
+		return rec.info.Module, true
+	}
+
+	return "", false
+}
+
+// bind 检查绑定冲突，执行绑定并记录绑定来源
+// doBind 接收包装之后的初始化函数，返回 false 表示条件绑定未满足条件，没有绑定任何对象
+func (r *bindingRegistry) bind(scope, module string, key interface{}, lifetime infra.BindingLifetime, override bool, initialize interface{}, doBind func(initialize interface{}) (bool, error)) error {
+	existModule, exist := r.lookup(scope, key)
+	if exist && existModule != module && existModule != bindingModuleGlacier {
+		msg := fmt.Sprintf("[glacier] binding conflict: %s is bound by both %s and %s", displayBindingKey(key), existModule, module)
+		if !override {
+			return fmt.Errorf("%s, override is not allowed", msg)
+		}
+
+		switch r.policy {
+		case infra.BindingConflictFail:
+			return fmt.Errorf("%s", msg)
+		case infra.BindingConflictWarn:
+			if infra.WARN {
+				log.Warningf("%s, the latter one takes effect", msg)
+			}
+		}
+	}
+
+	rec := &bindingRecord{key: key, info: infra.BindingInfo{Key: displayBindingKey(key), Lifetime: lifetime, Module: module, Scope: scope}}
+	if lifetime == infra.BindingValue {
+		rec.resolved = 1
+	} else {
+		initialize = trackResolved(initialize, rec)
+	}
+
+	bound, err := doBind(initialize)
+	if err != nil || !bound {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if prev, ok := r.index[bindingKey{scope: scope, key: key}]; ok {
+		rec.info.Overrides = append(append([]string{}, prev.info.Overrides...), prev.info.Module)
+	}
+
+	r.records = append(r.records, rec)
+	r.index[bindingKey{scope: scope, key: key}] = rec
+
+	return nil
+}
+
+// mustBindScoped 添加作用域绑定并记录绑定来源，作用域绑定不会注册到全局容器中
+func (r *bindingRegistry) mustBindScoped(scopes *scopeFactory, module string, initialize interface{}) {
+	err := r.bind("", module, initializerKey(initialize), infra.BindingScoped, false, initialize, func(initialize interface{}) (bool, error) {
+		scopes.Scoped(initialize)
+		return true, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// trackResolved 包装初始化函数，在对象被创建时标记为已解析，非函数形式的绑定直接标记为已解析
+func trackResolved(initialize interface{}, rec *bindingRecord) interface{} {
+	if _, ok := initialize.(ioc.Conditional); ok {
+		return initialize
+	}
+
+	fn := reflect.ValueOf(initialize)
+	if fn.Kind() != reflect.Func {
+		atomic.StoreInt32(&rec.resolved, 1)
+		return initialize
+	}
+
+	return reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		atomic.StoreInt32(&rec.resolved, 1)
+		if fn.Type().IsVariadic() {
+			return fn.CallSlice(args)
+		}
+
+		return fn.Call(args)
+	}).Interface()
+}
+
+// initializerKey 与容器的规则保持一致，计算初始化函数对应的绑定 key
+func initializerKey(initialize interface{}) reflect.Type {
+	if _, ok := initialize.(ioc.Conditional); ok {
+		// 只有通过 infra.WithCondition 创建的条件绑定才能获取到初始化函数，直接使用 ioc.WithCondition 创建的无法推导 key
+		if cond, ok := initialize.(interface{ Initializer() interface{} }); ok && cond.Initializer() != nil {
+			return initializerKey(cond.Initializer())
+		}
+
+		return nil
+	}
+
+	typ, ok := initialize.(reflect.Type)
+	if !ok {
+		typ = reflect.TypeOf(initialize)
+	}
+
+	if typ != nil && typ.Kind() == reflect.Func && typ.NumOut() > 0 {
+		return typ.Out(0)
+	}
+
+	return typ
+}
+
+func displayBindingKey(key interface{}) string {
+	if typ, ok := key.(reflect.Type); ok {
+		return typ.String()
+	}
+
+	return fmt.Sprintf("%v", key)
+}
+
+// recordingBinder 记录绑定来源的 Binder，Provider 的 Register 方法接收的就是该 Binder
+// 没有嵌入 ioc.Binder，所有方法都显式实现，避免 Binder 新增的绑定方法绕过记录
+type recordingBinder struct {
+	cc       ioc.Container
+	registry *bindingRegistry
+	module   string
+	// scope 不为空时，表示绑定到 ScopedProvider 的子容器中
+	scope string
+}
+
+// bind 执行绑定，key 为 nil 时根据初始化函数推导绑定的 key
+func (b *recordingBinder) bind(key interface{}, initialize interface{}, prototype bool, override bool) error {
+	customKey := key != nil
+	if !customKey {
+		if typ := initializerKey(initialize); typ != nil {
+			key = typ
+		} else {
+			return b.cc.Bind(initialize, prototype, override)
+		}
+	}
+
+	lifetime := infra.BindingSingleton
+	if prototype {
+		lifetime = infra.BindingPrototype
+	}
+
+	// 条件绑定只有在满足条件时才会绑定，通过记录条件函数的返回值判断是否绑定成功
+	var onCondition interface{}
+	if _, ok := initialize.(ioc.Conditional); ok {
+		cond, ok := initialize.(interface {
+			Initializer() interface{}
+			Condition() interface{}
+		})
+		if !ok {
+			// 直接使用 ioc.WithCondition 创建的条件绑定无法判断是否绑定成功，不记录绑定来源
+			if customKey {
+				return b.cc.BindWithKey(key, initialize, prototype, override)
+			}
+
+			return b.cc.Bind(initialize, prototype, override)
+		}
+
+		initialize, onCondition = cond.Initializer(), cond.Condition()
+	}
+
+	return b.registry.bind(b.scope, b.module, key, lifetime, override, initialize, func(initialize interface{}) (bool, error) {
+		matched := true
+		if onCondition != nil {
+			initialize = ioc.WithCondition(initialize, trackCondition(onCondition, &matched))
+		}
+
+		var err error
+		if customKey {
+			err = b.cc.BindWithKey(key, initialize, prototype, override)
+		} else {
+			err = b.cc.Bind(initialize, prototype, override)
+		}
+
+		return err == nil && matched, err
+	})
+}
+
+// trackCondition 包装条件函数，将条件函数的返回值记录到 matched 中
+func trackCondition(onCondition interface{}, matched *bool) interface{} {
+	fn := reflect.ValueOf(onCondition)
+	return reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		results := fn.Call(args)
+		*matched = results[0].Bool()
+		return results
+	}).Interface()
+}
+
+func (b *recordingBinder) bindValue(key string, value interface{}, override bool) error {
+	return b.registry.bind(b.scope, b.module, key, infra.BindingValue, override, value, func(value interface{}) (bool, error) {
+		if override {
+			return true, b.cc.BindValueOverride(key, value)
+		}
+
+		return true, b.cc.BindValue(key, value)
+	})
+}
+
+func (b *recordingBinder) P(initialize any) error         { return b.bind(nil, initialize, true, false) }
+func (b *recordingBinder) S(initialize any) error         { return b.bind(nil, initialize, false, false) }
+func (b *recordingBinder) V(key string, value any) error  { return b.bindValue(key, value, false) }
+func (b *recordingBinder) MP(initialize any)              { b.Must(b.P(initialize)) }
+func (b *recordingBinder) MS(initialize any)              { b.Must(b.S(initialize)) }
+func (b *recordingBinder) MV(key string, value any)       { b.Must(b.V(key, value)) }
+func (b *recordingBinder) Prototype(initialize any) error { return b.P(initialize) }
+func (b *recordingBinder) MustPrototype(initialize any)   { b.MP(initialize) }
+func (b *recordingBinder) Singleton(initialize any) error { return b.S(initialize) }
+func (b *recordingBinder) MustSingleton(initialize any)   { b.MS(initialize) }
+func (b *recordingBinder) BindValue(key string, value any) error {
+	return b.V(key, value)
+}
+func (b *recordingBinder) MustBindValue(key string, value any) { b.MV(key, value) }
+
+func (b *recordingBinder) PrototypeWithKey(key any, initialize any) error {
+	return b.bind(key, initialize, true, false)
+}
+func (b *recordingBinder) MustPrototypeWithKey(key any, initialize any) {
+	b.Must(b.PrototypeWithKey(key, initialize))
+}
+func (b *recordingBinder) PrototypeOverride(initialize any) error {
+	return b.bind(nil, initialize, true, true)
+}
+func (b *recordingBinder) MustPrototypeOverride(initialize any) {
+	b.Must(b.PrototypeOverride(initialize))
+}
+func (b *recordingBinder) PrototypeWithKeyOverride(key any, initialize any) error {
+	return b.bind(key, initialize, true, true)
+}
+func (b *recordingBinder) MustPrototypeWithKeyOverride(key any, initialize any) {
+	b.Must(b.PrototypeWithKeyOverride(key, initialize))
+}
+func (b *recordingBinder) SingletonWithKey(key any, initialize any) error {
+	return b.bind(key, initialize, false, false)
+}
+func (b *recordingBinder) MustSingletonWithKey(key any, initialize any) {
+	b.Must(b.SingletonWithKey(key, initialize))
+}
+func (b *recordingBinder) SingletonOverride(initialize any) error {
+	return b.bind(nil, initialize, false, true)
+}
+func (b *recordingBinder) MustSingletonOverride(initialize any) {
+	b.Must(b.SingletonOverride(initialize))
+}
+func (b *recordingBinder) SingletonWithKeyOverride(key any, initialize any) error {
+	return b.bind(key, initialize, false, true)
+}
+func (b *recordingBinder) MustSingletonWithKeyOverride(key any, initialize any) {
+	b.Must(b.SingletonWithKeyOverride(key, initialize))
+}
+func (b *recordingBinder) BindValueOverride(key string, value any) error {
+	return b.bindValue(key, value, true)
+}
+func (b *recordingBinder) MustBindValueOverride(key string, value any) {
+	b.Must(b.BindValueOverride(key, value))
+}
+func (b *recordingBinder) Bind(initialize any, prototype bool, override bool) error {
+	return b.bind(nil, initialize, prototype, override)
+}
+func (b *recordingBinder) MustBind(initialize any, prototype bool, override bool) {
+	b.Must(b.Bind(initialize, prototype, override))
+}
+func (b *recordingBinder) BindWithKey(key any, initialize any, prototype bool, override bool) error {
+	return b.bind(key, initialize, prototype, override)
+}
+func (b *recordingBinder) MustBindWithKey(key any, initialize any, prototype bool, override bool) {
+	b.Must(b.BindWithKey(key, initialize, prototype, override))
+}
+func (b *recordingBinder) Must(err error)                    { b.cc.Must(err) }
+func (b *recordingBinder) Keys() []any                       { return b.cc.Keys() }
+func (b *recordingBinder) CanOverride(key any) (bool, error) { return b.cc.CanOverride(key) }
+func (b *recordingBinder) HasBoundValue(key string) bool     { return b.cc.HasBoundValue(key) }
+func (b *recordingBinder) HasBound(key any) bool             { return b.cc.HasBound(key) }
@@ -0,0 +1,120 @@
+package glacier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+type bindingRepo struct{ name string }
+
+type bindingName struct{ name string }
+
+type bindingProvider struct{}
+
+func (bindingProvider) Register(binder infra.Binder) {
+	binder.MustSingletonOverride(func() *bindingRepo { return &bindingRepo{name: "provider"} })
+}
+
+func newBindingTestFramework(policy infra.BindingConflictPolicy) *framework {
+	impl := New("1.0", 1).(*framework)
+	impl.WithBindingConflictPolicy(policy)
+	impl.cc = ioc.New()
+
+	impl.binder(impl.cc, bindingModuleGlacier, "").MustSingletonOverride(func() bindingName { return bindingName{name: "builtin"} })
+	impl.binder(impl.cc, bindingModuleApp, "").MustSingletonOverride(func() *bindingRepo { return &bindingRepo{name: "app"} })
+	impl.binder(impl.cc, bindingModuleApp, "").MustSingletonOverride(func() bindingName { return bindingName{name: "app"} })
+
+	impl.Provider(bindingProvider{})
+	return impl
+}
+
+func TestBindingConflictPolicy(t *testing.T) {
+	impl := newBindingTestFramework(infra.BindingConflictWarn)
+	if err := impl.registerProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	impl.cc.MustResolve(func(repo *bindingRepo) {
+		if repo.name != "provider" {
+			t.Errorf("expect the latter binding takes effect, got %s", repo.name)
+		}
+	})
+
+	// Provider 中使用 Must 系列方法绑定时，冲突会以 panic 的形式中断启动
+	impl = newBindingTestFramework(infra.BindingConflictFail)
+	err := func() (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = rec.(error)
+			}
+		}()
+
+		return impl.registerProviders()
+	}()
+	if err == nil || !strings.Contains(err.Error(), "app") || !strings.Contains(err.Error(), "bindingProvider") {
+		t.Fatalf("expect binding conflict error with both module names, got %v", err)
+	}
+}
+
+func TestBindings(t *testing.T) {
+	impl := newBindingTestFramework(infra.BindingConflictWarn)
+	if err := impl.registerProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	find := func(key string) infra.BindingInfo {
+		for _, b := range impl.Bindings() {
+			if b.Key == key {
+				return b
+			}
+		}
+
+		t.Fatalf("binding %s not found", key)
+		return infra.BindingInfo{}
+	}
+
+	str := find("glacier.bindingName")
+	if str.Module != bindingModuleApp || len(str.Overrides) != 1 || str.Overrides[0] != bindingModuleGlacier {
+		t.Errorf("unexpected binding: %+v", str)
+	}
+
+	repo := find("*glacier.bindingRepo")
+	if repo.Lifetime != infra.BindingSingleton || repo.Resolved || len(repo.Overrides) != 1 || repo.Overrides[0] != bindingModuleApp {
+		t.Errorf("unexpected binding: %+v", repo)
+	}
+
+	impl.cc.MustResolve(func(*bindingRepo) {})
+	if repo := find("*glacier.bindingRepo"); !repo.Resolved {
+		t.Errorf("binding should be resolved: %+v", repo)
+	}
+}
+
+func TestConditionalBindings(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.cc = ioc.New()
+
+	binder := impl.binder(impl.cc, "conditional", "")
+	binder.MustSingleton(infra.WithCondition(func() *bindingRepo { return &bindingRepo{} }, func() bool { return true }))
+	binder.MustSingleton(infra.WithCondition(func() bindingName { return bindingName{} }, func() bool { return false }))
+
+	bindings := impl.Bindings()
+	if len(bindings) != 1 || bindings[0].Key != "*glacier.bindingRepo" || bindings[0].Module != "conditional" {
+		t.Errorf("only the matched conditional binding should be recorded, got %+v", bindings)
+	}
+
+	if !binder.HasBound(&bindingRepo{}) || binder.HasBound(bindingName{}) {
+		t.Error("binder should delegate lookups to the container")
+	}
+
+	// key 已经被绑定时，未满足条件的覆盖绑定不应该被记录
+	override := impl.binder(impl.cc, "override", "")
+	override.MustSingletonOverride(infra.WithCondition(func() *bindingRepo { return &bindingRepo{} }, func() bool { return false }))
+
+	bindings = impl.Bindings()
+	if len(bindings) != 1 || bindings[0].Module != "conditional" || len(bindings[0].Overrides) != 0 {
+		t.Errorf("unmatched conditional override should not be recorded, got %+v", bindings)
+	}
+}
@@ -0,0 +1,235 @@
+package glacier
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
+)
+
+// BootPlan 在不启动应用的情况下计算应用的启动计划
+// 该方法会执行 initStage 和 diBindStage 用于确定各模块 ShouldLoad 的结果，也就是说通过 Init、PreBind 添加的钩子
+// 以及模块的 ShouldLoad 方法会被真正执行，但不会执行模块的 Register、Boot、Init 等方法，
+// 因此只能在 Start 之外单独调用，比如用于输出启动流程图
+func (impl *framework) BootPlan(flagCtx infra.FlagContext) (plan infra.BootPlan, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("[glacier] compute boot plan failed: %v", rec)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flagCtx = impl.activateProfile(flagCtx)
+	if err := impl.initStage(flagCtx); err != nil {
+		return plan, err
+	}
+
+	if err := impl.diBindStage(ctx, flagCtx); err != nil {
+		return plan, err
+	}
+
+	return impl.buildBootPlan()
+}
+
+// buildBootPlan 根据 providers 和 services 的过滤排序结果生成启动计划，步骤与 Start 的执行流程保持一致
+func (impl *framework) buildBootPlan() (infra.BootPlan, error) {
+	providers, skippedProviders, err := impl.filterProviders()
+	if err != nil {
+		return infra.BootPlan{}, err
+	}
+
+	services, skippedServices, err := impl.filterServices()
+	if err != nil {
+		return infra.BootPlan{}, err
+	}
+
+	plan := infra.BootPlan{Modules: make([]infra.BootPlanModule, 0), Steps: make([]infra.BootPlanStep, 0)}
+	for _, p := range append(providers, skippedProviders...) {
+		plan.Modules = append(plan.Modules, providerPlanModule(p))
+	}
+	for _, s := range append(services, skippedServices...) {
+		plan.Modules = append(plan.Modules, servicePlanModule(s))
+	}
+
+	b := &bootPlanBuilder{}
+
+	for _, hook := range impl.initHooks {
+		b.add(lifecycle.StageInit, "invoke init hook: "+hook.name, "", false)
+	}
+	if impl.logger != nil {
+		b.add(lifecycle.StageInit, "init logger", "", false)
+	}
+
+	b.add(lifecycle.StageDIBind, "create container", "", false)
+	if len(impl.singletons) > 0 {
+		b.add(lifecycle.StageDIBind, "add singletons to container", "", false)
+	}
+	if len(impl.prototypes) > 0 {
+		b.add(lifecycle.StageDIBind, "add prototypes to container", "", false)
+	}
+	if len(impl.scoped) > 0 {
+		b.add(lifecycle.StageDIBind, "add scoped bindings", "", false)
+	}
+	for _, hook := range impl.preBindHooks {
+		b.add(lifecycle.StageDIBind, "invoke preBind hook: "+hook.name, "", false)
+	}
+
+	for _, p := range providers {
+		b.add(lifecycle.StageBoot, "register provider "+p.Name(), p.Name(), false)
+	}
+	for _, s := range services {
+		b.add(lifecycle.StageBoot, "register service "+s.Name(), s.Name(), false)
+	}
+
+	b.add(lifecycle.StageBoot, "start async runners", "", false)
+
+	for _, s := range services {
+		if _, ok := s.service.(infra.Initializer); ok {
+			b.add(lifecycle.StageBoot, "init service "+s.Name(), s.Name(), false)
+		}
+	}
+	for _, p := range providers {
+		if _, ok := p.provider.(infra.ProviderBoot); ok {
+			b.add(lifecycle.StageBoot, "boot provider "+p.Name(), p.Name(), false)
+		}
+	}
+
+	daemons := make([]*providerEntry, 0)
+	for _, p := range providers {
+		if _, ok := p.provider.(infra.DaemonProvider); ok {
+			daemons = append(daemons, p)
+		}
+	}
+	if len(daemons) > 0 {
+		b.add(lifecycle.StageBoot, "start daemon providers", "", false)
+		for _, p := range daemons {
+			b.add(lifecycle.StageBoot, "start daemon provider "+p.Name(), p.Name(), true)
+		}
+	}
+
+	if len(services) > 0 {
+		b.add(lifecycle.StageBoot, "start services", "", false)
+		for _, s := range services {
+			b.add(lifecycle.StageBoot, "start service "+s.Name(), s.Name(), true)
+		}
+	}
+
+	// 同一个分组中的钩子依次执行，应用在所有 Required 钩子执行成功之后才会就绪
+	required := make([]string, 0)
+	if len(impl.onServerReadyHooks) > 0 {
+		b.add(lifecycle.StageReady, "invoke onServerReady hooks", "", false)
+		parent := b.last
+		for _, group := range readyHookGroups(impl.onServerReadyHooks) {
+			b.last = parent
+			for _, hook := range group {
+				b.add(lifecycle.StageReady, "invoke onServerReady hook: "+hook.name, "", true)
+				b.last = b.steps[len(b.steps)-1].ID
+				if hook.opts.Required {
+					required = append(required, b.last)
+				}
+			}
+		}
+		b.last = parent
+	}
+	b.add(lifecycle.StageReady, "launched", "", false)
+	launched := &b.steps[len(b.steps)-1]
+	launched.After = append(launched.After, required...)
+
+	plan.Steps = b.steps
+	return plan, nil
+}
+
+// bootPlanBuilder 按照执行顺序构建启动步骤，同步步骤依次执行，异步步骤从前一个同步步骤派生，后续步骤不会等待异步步骤
+type bootPlanBuilder struct {
+	steps []infra.BootPlanStep
+	last  string
+}
+
+func (b *bootPlanBuilder) add(stage, name, module string, async bool) {
+	step := infra.BootPlanStep{ID: fmt.Sprintf("step%d", len(b.steps)+1), Stage: stage, Name: name, Module: module, Async: async}
+	if b.last != "" {
+		step.After = []string{b.last}
+	}
+
+	b.steps = append(b.steps, step)
+	if !async {
+		b.last = step.ID
+	}
+}
+
+func providerPlanModule(p *providerEntry) infra.BootPlanModule {
+	capabilities := make([]string, 0)
+	if _, ok := p.provider.(infra.ProviderBoot); ok {
+		capabilities = append(capabilities, "Boot")
+	}
+	if _, ok := p.provider.(infra.DaemonProvider); ok {
+		capabilities = append(capabilities, "Daemon")
+	}
+	if _, ok := p.provider.(infra.ProviderAggregate); ok {
+		capabilities = append(capabilities, "Aggregate")
+	}
+	if _, ok := p.provider.(infra.HealthChecker); ok {
+		capabilities = append(capabilities, "Health")
+	}
+
+	return infra.BootPlanModule{
+		Name:         p.Name(),
+		Kind:         infra.BootPlanProvider,
+		Priority:     modulePriority(p.provider),
+		Level:        p.level,
+		AggregatedBy: p.aggregatedBy,
+		DependsOn:    dependencyNames(p),
+		Capabilities: capabilities,
+		SkipReason:   p.skipReason,
+	}
+}
+
+func servicePlanModule(s *serviceEntry) infra.BootPlanModule {
+	capabilities := make([]string, 0)
+	if _, ok := s.service.(infra.Initializer); ok {
+		capabilities = append(capabilities, "Init")
+	}
+	if _, ok := s.service.(infra.Stoppable); ok {
+		capabilities = append(capabilities, "Stop")
+	}
+	if _, ok := s.service.(infra.Reloadable); ok {
+		capabilities = append(capabilities, "Reload")
+	}
+	if _, ok := s.service.(infra.Supervisable); ok {
+		capabilities = append(capabilities, "Supervise")
+	}
+	if _, ok := s.service.(infra.HealthChecker); ok {
+		capabilities = append(capabilities, "Health")
+	}
+
+	return infra.BootPlanModule{
+		Name:         s.Name(),
+		Kind:         infra.BootPlanService,
+		Priority:     modulePriority(s.service),
+		Level:        s.level,
+		DependsOn:    dependencyNames(s),
+		Capabilities: capabilities,
+		SkipReason:   s.skipReason,
+	}
+}
+
+// modulePriority 返回模块的优先级，未实现 Priority 接口时为默认值 1000
+func modulePriority(module interface{}) int {
+	if p, ok := module.(infra.Priority); ok {
+		return p.Priority()
+	}
+
+	return 1000
+}
+
+func dependencyNames(entry dependencyEntry) []string {
+	names := make([]string, 0)
+	for _, dep := range entry.dependsOn() {
+		names = append(names, resolveNameable(dep))
+	}
+
+	return names
+}
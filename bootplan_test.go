@@ -0,0 +1,49 @@
+package glacier
+
+import (
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+type planSkippedProvider struct{}
+
+func (planSkippedProvider) Register(binder infra.Binder) {}
+func (planSkippedProvider) ShouldLoad() bool             { return false }
+
+func TestBootPlan(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Provider(planSkippedProvider{}, depProviderB{}, depProviderC{})
+	impl.cc = ioc.New()
+
+	plan, err := impl.buildBootPlan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `flowchart TD
+    subgraph stage_0 ["diBindStage"]
+        step1["create container"]
+    end
+    subgraph stage_1 ["bootStage"]
+        step2["register provider github.com/mylxsw/glacier:glacier.depProviderC"]
+        step3["register provider github.com/mylxsw/glacier:glacier.depProviderB"]
+        step4["start async runners"]
+    end
+    subgraph stage_2 ["readyStage"]
+        step5["launched"]
+    end
+    step1 --> step2
+    step2 --> step3
+    step3 --> step4
+    step4 --> step5`
+
+	if plan.Mermaid() != expected {
+		t.Errorf("unexpected boot plan:\n%s", plan.Mermaid())
+	}
+
+	if len(plan.Modules) != 3 || plan.Modules[1].Level != 1 || plan.Modules[2].SkipReason == "" {
+		t.Errorf("unexpected boot plan modules: %+v", plan.Modules)
+	}
+}
@@ -0,0 +1,170 @@
+// Package clock 提供 infra.Clock 的实现，System 使用系统时间，Fake 用于测试，只有调用 Advance/Set 时时间才会变化
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+)
+
+// System 返回使用系统时间的 Clock
+func System() infra.Clock {
+	return systemClock{}
+}
+
+// IsSystem 判断 c 是否为使用系统时间的 Clock
+func IsSystem(c infra.Clock) bool {
+	_, ok := c.(systemClock)
+	return ok
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) NewTimer(d time.Duration) infra.Timer {
+	return systemTimer{timer: time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.timer.C }
+func (t systemTimer) Stop() bool          { return t.timer.Stop() }
+
+// Fake 可以手动控制的 Clock，所有的定时器只有在调用 Advance/Set 推进时间之后才会触发
+type Fake struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake 创建一个当前时间为 now 的 Fake Clock
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now, timers: make([]*fakeTimer, 0)}
+	f.cond = sync.NewCond(&f.lock)
+	return f
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	return t.clock.removeTimer(t)
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) NewTimer(d time.Duration) infra.Timer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	timer := &fakeTimer{clock: f, deadline: f.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.ch <- f.now
+		return timer
+	}
+
+	f.timers = append(f.timers, timer)
+	f.cond.Broadcast()
+
+	return timer
+}
+
+// Advance 将时间向后推进 d，并触发所有到期的定时器
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.setTime(f.now.Add(d))
+}
+
+// Set 将时间设置为 t，并触发所有到期的定时器，t 早于当前时间时不会触发任何定时器
+func (f *Fake) Set(t time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.setTime(t)
+}
+
+// Timers 返回尚未触发的定时器数量
+func (f *Fake) Timers() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.timers)
+}
+
+// BlockUntil 阻塞直到尚未触发的定时器数量不少于 n，用于在推进时间之前等待被测代码开始等待
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) setTime(t time.Time) {
+	f.now = t
+
+	sort.SliceStable(f.timers, func(i, j int) bool { return f.timers[i].deadline.Before(f.timers[j].deadline) })
+
+	pending := make([]*fakeTimer, 0, len(f.timers))
+	for _, timer := range f.timers {
+		if timer.deadline.After(t) {
+			pending = append(pending, timer)
+			continue
+		}
+
+		timer.ch <- t
+	}
+
+	f.timers = pending
+	f.cond.Broadcast()
+}
+
+func (f *Fake) removeTimer(timer *fakeTimer) bool {
+	for i, t := range f.timers {
+		if t == timer {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			f.cond.Broadcast()
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package glacier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/clock"
+	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/scheduler"
+)
+
+func TestCronWithFakeClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local))
+	triggered := make(chan time.Time, 10)
+
+	impl := New("1.0", 1).(*framework)
+	impl.WithClock(fake)
+	impl.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	impl.Provider(scheduler.Provider(func(resolver infra.Resolver, creator scheduler.JobCreator) {
+		creator.MustAdd("report", "0 */5 * * * *", func(c infra.Clock) { triggered <- c.Now() })
+	}))
+
+	app := impl.StartAsync(NewFlagContext())
+	defer func() { _ = app.Stop(context.Background()) }()
+
+	select {
+	case <-app.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("application is not ready")
+	}
+
+	app.Resolver().MustResolve(func(cr scheduler.Scheduler) {
+		job, err := cr.Info("report")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		next, err := job.Next(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !next[0].Equal(fake.Now().Add(5*time.Minute)) || !next[1].Equal(fake.Now().Add(10*time.Minute)) {
+			t.Errorf("unexpected next runs: %v", next)
+		}
+	})
+
+	// 调度循环开始等待之后再推进时间
+	fake.BlockUntil(1)
+	fake.Advance(4 * time.Minute)
+
+	select {
+	case <-triggered:
+		t.Fatal("cron job should not be triggered before its plan")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fake.Advance(time.Minute)
+
+	select {
+	case ts := <-triggered:
+		if !ts.Equal(time.Date(2024, 1, 1, 0, 5, 0, 0, time.Local)) {
+			t.Errorf("unexpected trigger time: %s", ts)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cron job is not triggered")
+	}
+}
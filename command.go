@@ -0,0 +1,96 @@
+package glacier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
+	"github.com/mylxsw/glacier/log"
+)
+
+// Exec 以命令模式执行 handler，handler 的参数从容器中解析，返回命令的退出码
+//
+// 命令模式下会执行初始化钩子、完成容器绑定，注册并启动（Boot）所有的 Provider，
+// 但是不会启动 Daemon Provider、Service 以及异步任务，应用状态也不会变为 Started，因此不能挂载模块。
+// handler 执行完毕后会立即执行 Graceful 的所有停机阶段，释放 Provider 在 Boot 中注册的资源。
+// handler 的返回值支持以下几种形式：无返回值、error、int、(int, error)，返回 error 且退出码为 0 时，退出码为 1
+func (impl *framework) Exec(flagCtx infra.FlagContext, handler interface{}) (code int, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Errorf("[glacier] command failed with a panic, Err: %s, Stack: \n%s", rec, debug.Stack())
+			code, err = 1, fmt.Errorf("[glacier] command failed with a panic: %v", rec)
+		}
+	}()
+
+	if handler == nil || reflect.TypeOf(handler).Kind() != reflect.Func {
+		return 1, errors.New("[glacier] command handler must be a function")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flagCtx = impl.activateProfile(flagCtx)
+	if err := impl.initStage(flagCtx); err != nil {
+		return 1, err
+	}
+
+	if err := impl.diBindStage(ctx, flagCtx); err != nil {
+		return 1, err
+	}
+
+	impl.updateGlacierStatus(Initialized)
+	defer impl.commandShutdown()
+
+	if err := impl.commandBootStage(); err != nil {
+		return 1, err
+	}
+
+	results, err := impl.cc.Call(handler)
+	if err != nil {
+		return 1, err
+	}
+
+	return commandResult(results)
+}
+
+// commandBootStage 命令模式的启动阶段，只注册和启动 Provider
+func (impl *framework) commandBootStage() error {
+	defer impl.lifecycleStage(lifecycle.StageBoot)()
+
+	if err := impl.registerProviders(); err != nil {
+		return err
+	}
+
+	return impl.bootProviders()
+}
+
+// commandShutdown 执行 Graceful 的所有停机阶段，释放 Provider 启动时注册的资源
+func (impl *framework) commandShutdown() {
+	if err := impl.cc.Resolve(func(gf infra.Graceful) {
+		impl.runShutdownPhases(gf)
+	}); err != nil {
+		log.Errorf("[glacier] command shutdown failed: %v", err)
+	}
+}
+
+// commandResult 将命令 handler 的返回值转换为退出码和错误
+func commandResult(results []interface{}) (code int, err error) {
+	for _, res := range results {
+		switch v := res.(type) {
+		case int:
+			code = v
+		case error:
+			err = v
+		}
+	}
+
+	if err != nil && code == 0 {
+		code = 1
+	}
+
+	return code, err
+}
@@ -0,0 +1,90 @@
+package glacier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/infra"
+)
+
+type commandRepo struct {
+	booted bool
+	closed bool
+}
+
+type commandProvider struct {
+	repo    *commandRepo
+	daemons int
+}
+
+func (p *commandProvider) Register(binder infra.Binder) {
+	binder.MustSingleton(func() *commandRepo { return p.repo })
+}
+
+func (p *commandProvider) Boot(resolver infra.Resolver) {
+	p.repo.booted = true
+	resolver.MustResolve(func(gf infra.Graceful) {
+		gf.AddShutdownHandler(func() { p.repo.closed = true })
+	})
+}
+
+func (p *commandProvider) Daemon(ctx context.Context, resolver infra.Resolver) {
+	p.daemons++
+}
+
+type commandService struct {
+	inited bool
+}
+
+func (s *commandService) Init(resolver infra.Resolver) error {
+	s.inited = true
+	return nil
+}
+
+func (s *commandService) Start() error { return nil }
+
+func TestExec(t *testing.T) {
+	provider := &commandProvider{repo: &commandRepo{}}
+	service := &commandService{}
+
+	impl := New("1.0", 1).(*framework)
+	impl.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	impl.Provider(provider)
+	impl.Service(service)
+
+	flagCtx := NewFlagContext()
+	flagCtx.SetString("name", "admin")
+
+	code, err := impl.Exec(flagCtx, func(fc infra.FlagContext, repo *commandRepo, modules infra.ModuleManager) int {
+		if !repo.booted || fc.String("name") != "admin" {
+			t.Errorf("provider should be booted before command, got %v, %q", repo.booted, fc.String("name"))
+		}
+
+		if err := modules.Attach("plugin"); err == nil {
+			t.Errorf("modules should not be attached in command mode")
+		}
+		return 3
+	})
+	if code != 3 || err != nil {
+		t.Errorf("expected exit code 3, got %d, %v", code, err)
+	}
+
+	if !provider.repo.closed {
+		t.Errorf("shutdown handlers should run after command finished")
+	}
+
+	if provider.daemons != 0 || service.inited {
+		t.Errorf("daemons and services should not be started in command mode")
+	}
+
+	if code, err := commandResult([]interface{}{errors.New("failed")}); code != 1 || err == nil {
+		t.Errorf("expected exit code 1 with error, got %d, %v", code, err)
+	}
+
+	if code, err := New("1.0", 1).Exec(NewFlagContext(), func() { panic("oops") }); code != 1 || err == nil {
+		t.Errorf("expected panic to be reported as error, got %d, %v", code, err)
+	}
+}
@@ -0,0 +1,152 @@
+package glacier
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
+)
+
+// dependencyEntry 可以声明依赖关系的模块（Provider/Service）
+type dependencyEntry interface {
+	Name() string
+	module() interface{}
+	dependsOn() []interface{}
+}
+
+// sortByDependency 按照模块声明的依赖关系对模块进行拓扑排序
+// 输入的 entries 应该已经按照 Priority 排好序，没有依赖关系的模块之间会保持原有的相对顺序
+// 返回排序后的模块以及每个模块所在的层级，没有依赖的模块层级为 0，被依赖模块的层级总是小于依赖它的模块
+// skipped 为因 ShouldLoad、Profile 等原因不会加载的模块，依赖这些模块时忽略该依赖关系并输出警告，不视为错误
+// loaded 为之前已经加载的模块（比如运行时挂载模块时，应用启动时加载的模块），依赖这些模块时视为依赖已经满足
+func sortByDependency[T dependencyEntry](kind string, entries []T, skipped []T, loaded []T) ([]T, []int, error) {
+	indexes := make(map[reflect.Type][]int)
+	for i, entry := range entries {
+		typ := reflect.TypeOf(entry.module())
+		indexes[typ] = append(indexes[typ], i)
+	}
+
+	skippedTypes := make(map[reflect.Type]bool)
+	for _, entry := range skipped {
+		skippedTypes[reflect.TypeOf(entry.module())] = true
+	}
+
+	loadedTypes := make(map[reflect.Type]bool)
+	for _, entry := range loaded {
+		loadedTypes[reflect.TypeOf(entry.module())] = true
+	}
+
+	// deps[i] 为第 i 个模块依赖的模块下标，dependents[i] 为依赖第 i 个模块的模块下标
+	deps := make([][]int, len(entries))
+	dependents := make([][]int, len(entries))
+	for i, entry := range entries {
+		for _, dep := range entry.dependsOn() {
+			depIndexes, ok := indexes[reflect.TypeOf(dep)]
+			if !ok && loadedTypes[reflect.TypeOf(dep)] {
+				continue
+			}
+
+			if !ok && skippedTypes[reflect.TypeOf(dep)] {
+				if infra.WARN {
+					log.Warningf("[glacier] %s %s depends on %s, but it is skipped, ignore this dependency", kind, entry.Name(), resolveNameable(dep))
+				}
+				continue
+			}
+
+			if !ok {
+				return nil, nil, fmt.Errorf("[glacier] %s %s depends on %s, but it is not loaded", kind, entry.Name(), resolveNameable(dep))
+			}
+
+			for _, j := range depIndexes {
+				if j == i {
+					return nil, nil, fmt.Errorf("[glacier] %s %s can not depend on itself", kind, entry.Name())
+				}
+
+				deps[i] = append(deps[i], j)
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	inDegree := make([]int, len(entries))
+	for i := range entries {
+		inDegree[i] = len(deps[i])
+	}
+
+	levels := make([]int, len(entries))
+	visited := make([]bool, len(entries))
+	order := make([]int, 0, len(entries))
+	for len(order) < len(entries) {
+		// 每次选取可加载模块中原始顺序最靠前的一个，保证在依赖关系之外 Priority 依然生效
+		next := -1
+		for i := range entries {
+			if !visited[i] && inDegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			return nil, nil, fmt.Errorf("[glacier] circular dependency detected between %ss: %s", kind, describeDependencyCycle(entries, deps, visited))
+		}
+
+		visited[next] = true
+		order = append(order, next)
+		for _, d := range dependents[next] {
+			inDegree[d]--
+			if levels[next]+1 > levels[d] {
+				levels[d] = levels[next] + 1
+			}
+		}
+	}
+
+	sorted := make([]T, len(entries))
+	sortedLevels := make([]int, len(entries))
+	for i, idx := range order {
+		sorted[i] = entries[idx]
+		sortedLevels[i] = levels[idx]
+	}
+
+	return sorted, sortedLevels, nil
+}
+
+// describeDependencyCycle 从未加载的模块中找出一个依赖环，格式为 a -> b -> c -> a
+func describeDependencyCycle[T dependencyEntry](entries []T, deps [][]int, visited []bool) string {
+	start := -1
+	for i := range entries {
+		if !visited[i] {
+			start = i
+			break
+		}
+	}
+
+	// 未加载的模块一定存在未加载的依赖，沿着依赖链走下去必然会回到已经走过的模块
+	path := make([]int, 0)
+	position := make(map[int]int)
+	current := start
+	for {
+		if pos, ok := position[current]; ok {
+			path = append(path[pos:], current)
+			break
+		}
+
+		position[current] = len(path)
+		path = append(path, current)
+
+		for _, d := range deps[current] {
+			if !visited[d] {
+				current = d
+				break
+			}
+		}
+	}
+
+	names := make([]string, len(path))
+	for i, idx := range path {
+		names[i] = entries[idx].Name()
+	}
+
+	return strings.Join(names, " -> ")
+}
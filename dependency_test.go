@@ -0,0 +1,94 @@
+package glacier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+type depProviderA struct{}
+
+func (depProviderA) Register(binder infra.Binder) {}
+
+type depProviderB struct{}
+
+func (depProviderB) Register(binder infra.Binder) {}
+func (depProviderB) DependsOn() []infra.Provider {
+	return []infra.Provider{depProviderC{}}
+}
+
+type depProviderC struct{}
+
+func (depProviderC) Register(binder infra.Binder) {}
+func (depProviderC) Priority() int                { return 2000 }
+
+type cycleProviderA struct{}
+
+func (cycleProviderA) Register(binder infra.Binder) {}
+func (cycleProviderA) DependsOn() []infra.Provider  { return []infra.Provider{cycleProviderB{}} }
+
+type cycleProviderB struct{}
+
+func (cycleProviderB) Register(binder infra.Binder) {}
+func (cycleProviderB) DependsOn() []infra.Provider  { return []infra.Provider{cycleProviderA{}} }
+
+func TestProvidersDependencyOrder(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Provider(depProviderB{}, depProviderA{}, depProviderC{})
+
+	providers, err := impl.providersFilter()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+
+	expected := "github.com/mylxsw/glacier:glacier.depProviderA,github.com/mylxsw/glacier:glacier.depProviderC,github.com/mylxsw/glacier:glacier.depProviderB"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("unexpected provider order: %v", names)
+	}
+}
+
+func TestProvidersCircularDependency(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Provider(cycleProviderA{}, cycleProviderB{})
+
+	_, err := impl.providersFilter()
+	if err == nil || !strings.Contains(err.Error(), "circular dependency") {
+		t.Fatalf("expect circular dependency error, got %v", err)
+	}
+
+	t.Log(err)
+}
+
+type skippedProvider struct{}
+
+func (skippedProvider) Register(binder infra.Binder) {}
+func (skippedProvider) ShouldLoad() bool             { return false }
+
+type dependOnSkippedProvider struct{}
+
+func (dependOnSkippedProvider) Register(binder infra.Binder) {}
+func (dependOnSkippedProvider) DependsOn() []infra.Provider {
+	return []infra.Provider{skippedProvider{}}
+}
+
+func TestProvidersDependOnSkipped(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.cc = ioc.New()
+	impl.Provider(dependOnSkippedProvider{}, skippedProvider{})
+
+	providers, err := impl.providersFilter()
+	if err != nil {
+		t.Fatalf("dependency on skipped provider should be ignored, got %v", err)
+	}
+
+	if len(providers) != 1 || providers[0].provider != (dependOnSkippedProvider{}) {
+		t.Errorf("unexpected providers: %v", providers)
+	}
+}
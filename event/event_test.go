@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/mylxsw/glacier/event"
+	"github.com/mylxsw/go-ioc"
 )
 
 type UserCreatedEvent struct {
@@ -50,3 +51,36 @@ func TestPublishEvent(t *testing.T) {
 		ID: "121",
 	})
 }
+
+type userRepo struct{ name string }
+
+func TestListenerWithDependencies(t *testing.T) {
+	cc := ioc.New()
+	cc.MustSingleton(func() *userRepo { return &userRepo{name: "repo"} })
+
+	called := false
+	eventManager := event.NewEventManagerWithResolver(event.NewMemoryEventStore(false, 10), cc)
+	eventManager.Listen(func(evt UserCreatedEvent, repo *userRepo) {
+		called = true
+		if evt.ID != "111" || repo.name != "repo" {
+			t.Errorf("unexpected listener arguments: %v, %v", evt, repo)
+		}
+	})
+
+	_ = eventManager.Publish(UserCreatedEvent{ID: "111"})
+	if !called {
+		t.Error("listener should be called")
+	}
+
+	// 依赖无法满足时只输出错误日志，不会 panic，其它监听器正常执行
+	calledAfterMissing := false
+	eventManager.Listen(func(evt UserUpdatedEvent, missing *missingDep) {})
+	eventManager.Listen(func(evt UserUpdatedEvent) { calledAfterMissing = true })
+
+	_ = eventManager.Publish(UserUpdatedEvent{ID: "121"})
+	if !calledAfterMissing {
+		t.Error("listener after a failed one should be called")
+	}
+}
+
+type missingDep struct{}
@@ -5,18 +5,33 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
 )
 
 // eventManager is a manager for event dispatch
 type eventManager struct {
-	store Store
-	lock  sync.RWMutex
+	store    Store
+	resolver infra.Resolver
+	lock     sync.RWMutex
+
+	ctxLock sync.RWMutex
+	ctx     context.Context
 }
 
 // NewEventManager create a eventManager
 func NewEventManager(store Store) Manager {
+	return NewEventManagerWithResolver(store, nil)
+}
+
+// NewEventManagerWithResolver create a eventManager whose listeners can declare dependencies after the event argument,
+// each dispatch to such a listener is executed in its own scope
+func NewEventManagerWithResolver(store Store, resolver infra.Resolver) Manager {
 	manager := &eventManager{
-		store: store,
+		store:    store,
+		resolver: resolver,
+		ctx:      context.Background(),
 	}
 
 	store.SetManager(manager)
@@ -35,7 +50,11 @@ func (em *eventManager) Listen(listeners ...interface{}) {
 			panic("[glacier] listener must be a function")
 		}
 
-		if listenerType.NumIn() != 1 {
+		if listenerType.NumIn() == 0 {
+			panic("[glacier] listener must be a function with the event as its first argument")
+		}
+
+		if listenerType.NumIn() > 1 && em.resolver == nil {
 			panic("[glacier] listener must be a function with only one argument")
 		}
 
@@ -59,10 +78,39 @@ func (em *eventManager) Publish(evt interface{}) error {
 }
 
 // Call trigger listener to execute
+// listener with dependencies is called in a new scope, the event is provided as the first argument,
+// if the dependencies can not be resolved, the error is logged and the listener is skipped
 func (em *eventManager) Call(evt interface{}, listener interface{}) {
-	reflect.ValueOf(listener).Call([]reflect.Value{reflect.ValueOf(evt)})
+	listenerValue := reflect.ValueOf(listener)
+	if listenerValue.Type().NumIn() == 1 {
+		listenerValue.Call([]reflect.Value{reflect.ValueOf(evt)})
+		return
+	}
+
+	em.ctxLock.RLock()
+	ctx := em.ctx
+	em.ctxLock.RUnlock()
+
+	resolver := em.resolver
+	if scope := infra.OpenScope(ctx, em.resolver, infra.ScopeEvent); scope != nil {
+		defer scope.Close()
+		resolver = scope
+	}
+
+	evtType := listenerValue.Type().In(0)
+	evtProvider := reflect.MakeFunc(reflect.FuncOf(nil, []reflect.Type{evtType}, false), func([]reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf(evt)}
+	})
+
+	if _, err := resolver.CallWithProvider(listener, resolver.Provider(evtProvider.Interface())); err != nil {
+		log.Errorf("[glacier] call listener for event %s failed: %v", evtType, err)
+	}
 }
 
 func (em *eventManager) Start(ctx context.Context) <-chan interface{} {
+	em.ctxLock.Lock()
+	em.ctx = ctx
+	em.ctxLock.Unlock()
+
 	return em.store.Start(ctx)
 }
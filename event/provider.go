@@ -33,7 +33,9 @@ func (p *provider) Register(app infra.Binder) {
 
 		return NewMemoryEventStore(false, 20)
 	})
-	app.MustSingletonOverride(NewEventManager)
+	app.MustSingletonOverride(func(store Store, resolver infra.Resolver) Manager {
+		return NewEventManagerWithResolver(store, resolver)
+	})
 	app.MustSingletonOverride(func(manager Manager) Listener { return manager })
 	app.MustSingletonOverride(func(manager Manager) Publisher { return manager })
 }
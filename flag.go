@@ -16,7 +16,8 @@ func (impl *framework) buildFlagContext(cliCtx infra.FlagContext) func() (infra.
 			return nil, err
 		}
 
-		return res[0].(infra.FlagContext), nil
+		// WithFlagContext 返回的 FlagContext 同样需要能够获取当前运行环境
+		return impl.withProfile(res[0].(infra.FlagContext)), nil
 	}
 }
 
@@ -24,6 +25,11 @@ type FlagContext struct {
 	data map[string]interface{}
 }
 
+// NewFlagContext 创建一个空的 FlagContext，通过 SetXXX 方法设置选项的值，一般用于不使用命令行启动应用时，比如测试
+func NewFlagContext() *FlagContext {
+	return &FlagContext{data: make(map[string]interface{})}
+}
+
 func (f *FlagContext) setData(name string, value interface{}) {
 	f.data[name] = value
 }
@@ -6,6 +6,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mylxsw/glacier/clock"
+	"github.com/mylxsw/glacier/event"
 	"github.com/mylxsw/glacier/infra"
 	"github.com/mylxsw/go-ioc"
 )
@@ -14,6 +16,7 @@ import (
 type framework struct {
 	version   string
 	startTime time.Time
+	clock     infra.Clock
 
 	cc     ioc.Container
 	logger infra.Logger
@@ -24,20 +27,47 @@ type framework struct {
 	services  []*serviceEntry
 
 	// asyncRunnerCount 异步任务执行器数量
-	asyncRunnerCount int
-	asyncJobs        []asyncJob
-	asyncJobChannel  chan asyncJob
-
-	init               func(fc infra.FlagContext) error
-	preBinder          func(binder infra.Binder)
-	beforeServerStop   func(resolver infra.Resolver) error
-	onServerReadyHooks []namedFunc
+	asyncRunnerCount    int
+	asyncQueueSize      int
+	asyncOverflowPolicy infra.AsyncOverflowPolicy
+	asyncLock           sync.RWMutex
+	asyncJobs           []*asyncJob
+	asyncJobChannel     chan *asyncJob
+	asyncStopping       chan struct{}
+	asyncClosed         bool
+
+	initHooks             hookList
+	preBindHooks          hookList
+	beforeServerStopHooks hookList
+	onServerReadyHooks    []*readyHook
+
+	// profileFlag/profileEnv/defaultProfile 当前运行环境的来源，profile 为启动时确定的运行环境
+	profileFlag    string
+	profileEnv     string
+	defaultProfile string
+	profile        infra.Profile
 
 	gracefulBuilder func() infra.Graceful
+	// shutdownPhaseTimeouts 通过 WithShutdownPhaseTimeout 设置的停机阶段超时时间
+	shutdownPhaseTimeouts []infra.ShutdownPhase
+	panicHandler          infra.PanicHandler
 
 	flagContextInit interface{}
 	singletons      []interface{}
 	prototypes      []interface{}
+	scoped          []interface{}
+
+	lifecycle event.Manager
+	modules   *moduleManager
+	bindings  *bindingRegistry
+	scopes    *scopeFactory
+
+	// printStartupReport 应用就绪后是否输出启动耗时报告
+	printStartupReport  bool
+	slowModuleThreshold time.Duration
+	startupLock         sync.Mutex
+	startupSteps        []infra.StartupStep
+	startupTook         time.Duration
 
 	status   Status
 	nodes    infra.GraphvizNodes
@@ -46,15 +76,22 @@ type framework struct {
 
 // New a new framework server
 func New(version string, asyncJobRunnerCount int) infra.Glacier {
-	impl := &framework{startTime: time.Now()}
+	impl := &framework{clock: clock.System()}
+	impl.startTime = impl.clock.Now()
 	impl.version = version
 	impl.singletons = make([]interface{}, 0)
 	impl.prototypes = make([]interface{}, 0)
+	impl.scoped = make([]interface{}, 0)
 	impl.providers = make([]*providerEntry, 0)
 	impl.services = make([]*serviceEntry, 0)
-	impl.asyncJobs = make([]asyncJob, 0)
+	impl.asyncJobs = make([]*asyncJob, 0)
 	impl.asyncRunnerCount = asyncJobRunnerCount
+	impl.asyncOverflowPolicy = infra.AsyncOverflowBlock
+	impl.asyncStopping = make(chan struct{})
 	impl.status = Unknown
+	impl.lifecycle = newLifecycleManager()
+	impl.modules = newModuleManager(impl)
+	impl.bindings = newBindingRegistry()
 	impl.flagContextInit = func(flagCtx infra.FlagContext) infra.FlagContext { return flagCtx }
 
 	impl.nodes = make(infra.GraphvizNodes, 0)
@@ -98,6 +135,13 @@ func (impl *framework) updateGlacierStatus(status Status) {
 	impl.status = status
 }
 
+func (impl *framework) currentStatus() Status {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.status
+}
+
 func (impl *framework) WithFlagContext(fn interface{}) infra.Glacier {
 	fnType := reflect.TypeOf(fn)
 	if fnType.Kind() != reflect.Func || fnType.NumOut() != 1 || fnType.Out(0) != reflect.TypeOf(infra.FlagContext(nil)) {
@@ -115,6 +159,24 @@ func (impl *framework) Graceful(builder func() infra.Graceful) infra.Glacier {
 	return impl
 }
 
+// WithShutdownPhaseTimeout 设置停机阶段的超时时间，Graceful 实现了 infra.ShutdownPhaseTimeoutAware 接口时生效
+func (impl *framework) WithShutdownPhaseTimeout(phase infra.ShutdownPhase, timeout time.Duration) infra.Glacier {
+	phase.Timeout = timeout
+	impl.shutdownPhaseTimeouts = append(impl.shutdownPhaseTimeouts, phase)
+	return impl
+}
+
+// WithClock 设置框架使用的时间源，定时任务触发、停机超时、启动耗时统计等都会使用它，一般用于测试
+func (impl *framework) WithClock(c infra.Clock) infra.Glacier {
+	if impl.status >= Initialized {
+		panic("[glacier] can not invoke this method after Glacier has been initialize")
+	}
+
+	impl.clock = c
+	impl.startTime = c.Now()
+	return impl
+}
+
 // SetLogger set default logger for glacier
 func (impl *framework) SetLogger(logger infra.Logger) infra.Glacier {
 	impl.logger = logger
@@ -166,10 +228,17 @@ func (impl *framework) Binder() infra.Binder {
 	return impl.cc
 }
 
-func (impl *framework) shouldLoadModule(pValue reflect.Value) bool {
+// shouldLoadModule 调用模块的 ShouldLoad 方法判断模块是否需要加载，方法参数从 cc 中获取
+// record 为 true 时记录 ShouldLoad 的耗时，只有启动应用时才需要记录，计算启动计划、校验等场景不应该影响启动耗时报告
+func (impl *framework) shouldLoadModule(cc ioc.Container, name string, pValue reflect.Value, record bool) bool {
 	shouldLoadMethod := pValue.MethodByName("ShouldLoad")
 	if shouldLoadMethod.IsValid() && !shouldLoadMethod.IsZero() {
-		res, err := impl.cc.Call(shouldLoadMethod)
+		startTs := impl.clock.Now()
+		res, err := cc.Call(shouldLoadMethod)
+		if record {
+			impl.recordStartupStep(name, infra.StartupStepShouldLoad, startTs)
+		}
+
 		if err != nil {
 			panic(fmt.Errorf("[glacier] call %s.ShouldLoad method failed: %v", pValue.Kind().String(), err))
 		}
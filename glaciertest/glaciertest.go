@@ -0,0 +1,473 @@
+// Package glaciertest 提供用于测试 Glacier 应用的辅助工具
+//
+// Harness 基于 glacier.New 和内存中的 FlagContext 创建应用，使用不监听系统信号的 Graceful 启动，
+// 支持使用 fake 对象替换容器中的绑定，等待应用就绪后可以通过 Client 访问 web 服务，
+// 并且提供了断言事件已发布、定时任务已注册的辅助方法
+package glaciertest
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier"
+	"github.com/mylxsw/glacier/event"
+	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/listener"
+	"github.com/mylxsw/glacier/scheduler"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+// DefaultTimeout 等待应用就绪、停机以及断言事件发布的默认超时时间
+var DefaultTimeout = 5 * time.Second
+
+// Harness 测试用的应用容器
+type Harness struct {
+	t testing.TB
+
+	ins     infra.Glacier
+	flags   *glacier.FlagContext
+	fakes   []interface{}
+	timeout time.Duration
+
+	listener net.Listener
+	app      infra.Application
+	client   *http.Client
+
+	lock     sync.Mutex
+	useWeb   bool
+	events   []interface{}
+	stopOnce sync.Once
+}
+
+// New 创建一个测试用的应用，测试结束时应用会自动停止
+func New(t testing.TB) *Harness {
+	h := &Harness{
+		t:       t,
+		ins:     glacier.New("test", 1),
+		flags:   glacier.NewFlagContext(),
+		fakes:   make([]interface{}, 0),
+		timeout: DefaultTimeout,
+		events:  make([]interface{}, 0),
+	}
+
+	h.ins.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(h.timeout) })
+	return h
+}
+
+// Glacier 返回底层的 Glacier 实例，用于注册 Provider、Service、钩子等
+func (h *Harness) Glacier() infra.Glacier {
+	return h.ins
+}
+
+// Provider 注册 Provider
+func (h *Harness) Provider(providers ...infra.Provider) *Harness {
+	h.ins.Provider(providers...)
+	return h
+}
+
+// Service 注册 Service
+func (h *Harness) Service(services ...infra.Service) *Harness {
+	h.ins.Service(services...)
+	return h
+}
+
+// WithTimeout 设置等待应用就绪、停机以及断言事件发布的超时时间
+func (h *Harness) WithTimeout(timeout time.Duration) *Harness {
+	h.timeout = timeout
+	return h
+}
+
+// Profile 设置应用的运行环境，只在该环境中加载的 Provider/Service 才会被加载
+func (h *Harness) Profile(profile string) *Harness {
+	h.ins.WithProfile("", "", profile)
+	return h
+}
+
+// Flags 返回应用使用的 FlagContext，可以直接调用其 SetXXX 方法设置选项的值
+func (h *Harness) Flags() *glacier.FlagContext {
+	return h.flags
+}
+
+// DeclareFlags 声明命令行选项，使用选项的默认值初始化 FlagContext，支持 cli 和 altsrc 中的常用选项类型
+func (h *Harness) DeclareFlags(flags ...cli.Flag) *Harness {
+	for _, f := range flags {
+		name, value, ok := flagDefault(f)
+		if !ok {
+			h.t.Fatalf("glaciertest: unsupported flag type %T", f)
+		}
+
+		h.SetFlag(name, value)
+	}
+
+	return h
+}
+
+// SetFlag 设置选项的值，value 的类型决定了通过 FlagContext 的哪个方法读取
+func (h *Harness) SetFlag(name string, value interface{}) *Harness {
+	switch v := value.(type) {
+	case string:
+		h.flags.SetString(name, v)
+	case bool:
+		h.flags.SetBool(name, v)
+	case int:
+		h.flags.SetInt(name, v)
+	case float64:
+		h.flags.SetFloat64(name, v)
+	case time.Duration:
+		h.flags.SetDuration(name, v)
+	case []string:
+		h.flags.SetStringSlice(name, v)
+	case []int:
+		h.flags.SetIntSlice(name, v)
+	default:
+		h.t.Fatalf("glaciertest: unsupported value type %T for flag %s", value, name)
+	}
+
+	return h
+}
+
+// Fake 使用 fake 对象替换容器中的绑定，参数与 Singleton 相同，会在所有 Provider 注册之后覆盖原有的绑定
+func (h *Harness) Fake(initializers ...interface{}) *Harness {
+	h.fakes = append(h.fakes, initializers...)
+	return h
+}
+
+// Start 启动应用并等待应用就绪，启动失败或者超时时测试失败
+func (h *Harness) Start() *Harness {
+	h.t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		h.t.Fatalf("glaciertest: create listener failed: %v", err)
+	}
+
+	h.listener = l
+	h.ins.Provider(&harnessProvider{h: h})
+
+	h.app = h.ins.StartAsync(h.flags)
+	h.t.Cleanup(h.Stop)
+
+	select {
+	case <-h.app.Ready():
+	case <-h.app.Done():
+		h.t.Fatalf("glaciertest: application exited before ready: %v", h.app.Wait())
+	case <-time.After(h.timeout):
+		h.t.Fatalf("glaciertest: application is not ready after %s", h.timeout)
+	}
+
+	return h
+}
+
+// Stop 停止应用并等待应用退出，测试结束时会自动调用
+func (h *Harness) Stop() {
+	h.stopOnce.Do(func() {
+		if h.app == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+		defer cancel()
+
+		if err := h.app.Stop(ctx); err != nil {
+			h.t.Errorf("glaciertest: stop application failed: %v", err)
+		}
+
+		if !h.usingWeb() {
+			_ = h.listener.Close()
+		}
+	})
+}
+
+// Resolver 返回应用的容器，只能在 Start 之后调用
+func (h *Harness) Resolver() infra.Resolver {
+	h.t.Helper()
+
+	if h.app == nil {
+		h.t.Fatal("glaciertest: application is not started")
+	}
+
+	return h.app.Resolver()
+}
+
+// MustResolve 从容器中解析依赖并执行 callback
+func (h *Harness) MustResolve(callback interface{}) {
+	h.t.Helper()
+
+	if err := h.Resolver().Resolve(callback); err != nil {
+		h.t.Fatalf("glaciertest: resolve failed: %v", err)
+	}
+}
+
+func (h *Harness) usingWeb() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.useWeb
+}
+
+// URL 返回 web 服务的地址，比如 http://127.0.0.1:34567，应用没有注册 web.Provider 时测试失败
+func (h *Harness) URL() string {
+	h.t.Helper()
+
+	if h.listener == nil || !h.usingWeb() {
+		h.t.Fatal("glaciertest: web provider is not registered")
+	}
+
+	return "http://" + h.listener.Addr().String()
+}
+
+// Client 返回访问 web 服务的 http.Client，与 httptest.Server.Client 相同，请求需要使用 URL 返回的地址
+func (h *Harness) Client() *http.Client {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.client == nil {
+		h.client = &http.Client{Transport: &http.Transport{}, Timeout: h.timeout}
+		h.t.Cleanup(h.client.CloseIdleConnections)
+	}
+
+	return h.client
+}
+
+// NewRequest 创建访问 web 服务的请求，path 为请求路径
+func (h *Harness) NewRequest(method string, path string, body io.Reader) *http.Request {
+	h.t.Helper()
+
+	req, err := http.NewRequest(method, h.URL()+"/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		h.t.Fatalf("glaciertest: create request failed: %v", err)
+	}
+
+	return req
+}
+
+// Do 向 web 服务发送请求，请求失败时测试失败，响应会在测试结束时自动关闭
+func (h *Harness) Do(req *http.Request) *http.Response {
+	h.t.Helper()
+
+	resp, err := h.Client().Do(req)
+	if err != nil {
+		h.t.Fatalf("glaciertest: %s %s failed: %v", req.Method, req.URL.Path, err)
+	}
+
+	h.t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// Get 向 web 服务发送 GET 请求
+func (h *Harness) Get(path string) *http.Response {
+	h.t.Helper()
+	return h.Do(h.NewRequest(http.MethodGet, path, nil))
+}
+
+// Post 向 web 服务发送 POST 请求
+func (h *Harness) Post(path string, contentType string, body io.Reader) *http.Response {
+	h.t.Helper()
+
+	req := h.NewRequest(http.MethodPost, path, body)
+	req.Header.Set("Content-Type", contentType)
+
+	return h.Do(req)
+}
+
+// Events 返回应用启动之后通过 event.Publisher 发布的所有事件，按照发布顺序排列
+func (h *Harness) Events() []interface{} {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return append([]interface{}{}, h.events...)
+}
+
+func (h *Harness) recordEvent(evt interface{}) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.events = append(h.events, evt)
+}
+
+// EventsOf 返回所有类型为 T 的已发布事件
+func EventsOf[T any](h *Harness) []T {
+	results := make([]T, 0)
+	for _, evt := range h.Events() {
+		if e, ok := evt.(T); ok {
+			results = append(results, e)
+		}
+	}
+
+	return results
+}
+
+// AssertEventPublished 断言类型为 T 并且满足所有 match 条件的事件已经发布，事件发布可能是异步的，
+// 因此会在超时时间内持续等待，返回第一个匹配的事件
+func AssertEventPublished[T any](h *Harness, match ...func(evt T) bool) T {
+	h.t.Helper()
+
+	deadline := time.Now().Add(h.timeout)
+	for {
+		for _, evt := range EventsOf[T](h) {
+			if matchAll(evt, match) {
+				return evt
+			}
+		}
+
+		if time.Now().After(deadline) {
+			var zero T
+			h.t.Fatalf("glaciertest: no event of type %T matched after %s, published events: %s", zero, h.timeout, describeEvents(h.Events()))
+			return zero
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// AssertEventNotPublished 断言类型为 T 并且满足所有 match 条件的事件没有发布
+func AssertEventNotPublished[T any](h *Harness, match ...func(evt T) bool) {
+	h.t.Helper()
+
+	for _, evt := range EventsOf[T](h) {
+		if matchAll(evt, match) {
+			h.t.Fatalf("glaciertest: unexpected event published: %#v", evt)
+		}
+	}
+}
+
+func matchAll[T any](evt T, match []func(evt T) bool) bool {
+	for _, m := range match {
+		if !m(evt) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func describeEvents(events []interface{}) string {
+	types := make([]string, 0, len(events))
+	for _, evt := range events {
+		types = append(types, reflect.TypeOf(evt).String())
+	}
+
+	return "[" + strings.Join(types, ", ") + "]"
+}
+
+// AssertCronJob 断言名称为 name 的定时任务已经注册，plan 不为空时同时断言任务的执行计划，返回任务信息
+func (h *Harness) AssertCronJob(name string, plan ...string) scheduler.Job {
+	h.t.Helper()
+
+	var job scheduler.Job
+	var err error
+	h.MustResolve(func(cr scheduler.Scheduler) {
+		job, err = cr.Info(name)
+	})
+
+	if err != nil {
+		h.t.Fatalf("glaciertest: cron job %s is not registered: %v", name, err)
+	}
+
+	if len(plan) > 0 && job.Plan != plan[0] {
+		h.t.Fatalf("glaciertest: cron job %s has plan %q, expected %q", name, job.Plan, plan[0])
+	}
+
+	return job
+}
+
+// harnessProvider 在所有 Provider 注册之后执行，替换 web 服务的 listener、记录发布的事件以及应用 fake 绑定
+type harnessProvider struct {
+	h *Harness
+}
+
+func (p *harnessProvider) Name() string {
+	return "glaciertest"
+}
+
+func (p *harnessProvider) Priority() int {
+	return math.MaxInt32
+}
+
+func (p *harnessProvider) Register(binder infra.Binder) {
+	bound := make(map[interface{}]bool)
+	for _, k := range binder.Keys() {
+		bound[k] = true
+	}
+
+	if bound[reflect.TypeOf((*infra.ListenerBuilder)(nil)).Elem()] {
+		p.h.lock.Lock()
+		p.h.useWeb = true
+		p.h.lock.Unlock()
+
+		binder.MustSingletonOverride(func() infra.ListenerBuilder { return listener.Exist(p.h.listener) })
+	}
+
+	if bound[reflect.TypeOf((*event.Store)(nil)).Elem()] {
+		binder.MustSingletonOverride(func(store event.Store, resolver infra.Resolver) event.Manager {
+			return &recordingManager{Manager: event.NewEventManagerWithResolver(store, resolver), h: p.h}
+		})
+	}
+
+	for _, fake := range p.h.fakes {
+		binder.MustSingletonOverride(fake)
+	}
+}
+
+// recordingManager 记录所有发布的事件
+type recordingManager struct {
+	event.Manager
+	h *Harness
+}
+
+func (m *recordingManager) Publish(evt interface{}) error {
+	m.h.recordEvent(evt)
+	return m.Manager.Publish(evt)
+}
+
+// flagDefault 读取选项的名称和默认值
+func flagDefault(f cli.Flag) (string, interface{}, bool) {
+	switch v := f.(type) {
+	case *altsrc.StringFlag:
+		return flagDefault(v.StringFlag)
+	case *altsrc.BoolFlag:
+		return flagDefault(v.BoolFlag)
+	case *altsrc.IntFlag:
+		return flagDefault(v.IntFlag)
+	case *altsrc.Float64Flag:
+		return flagDefault(v.Float64Flag)
+	case *altsrc.DurationFlag:
+		return flagDefault(v.DurationFlag)
+	case *altsrc.StringSliceFlag:
+		return flagDefault(v.StringSliceFlag)
+	case *altsrc.IntSliceFlag:
+		return flagDefault(v.IntSliceFlag)
+	case *cli.StringFlag:
+		return v.Name, v.Value, true
+	case *cli.BoolFlag:
+		return v.Name, v.Value, true
+	case *cli.IntFlag:
+		return v.Name, v.Value, true
+	case *cli.Float64Flag:
+		return v.Name, v.Value, true
+	case *cli.DurationFlag:
+		return v.Name, v.Value, true
+	case *cli.StringSliceFlag:
+		if v.Value == nil {
+			return v.Name, []string{}, true
+		}
+		return v.Name, v.Value.Value(), true
+	case *cli.IntSliceFlag:
+		if v.Value == nil {
+			return v.Name, []int{}, true
+		}
+		return v.Name, v.Value.Value(), true
+	}
+
+	return "", nil, false
+}
@@ -0,0 +1,71 @@
+package glaciertest_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/mylxsw/glacier/event"
+	"github.com/mylxsw/glacier/glaciertest"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/scheduler"
+	"github.com/mylxsw/glacier/web"
+	"github.com/urfave/cli/v2"
+)
+
+type greeter interface {
+	Greet(name string) string
+}
+
+type fakeGreeter struct{}
+
+func (fakeGreeter) Greet(name string) string { return "fake hello " + name }
+
+type userGreeted struct{ Name string }
+
+func TestHarness(t *testing.T) {
+	h := glaciertest.New(t)
+	h.DeclareFlags(&cli.StringFlag{Name: "greeting", Value: "hello"}, &cli.BoolFlag{Name: "verbose"})
+	h.SetFlag("verbose", true)
+
+	h.Glacier().Singleton(func(flagCtx infra.FlagContext) greeter {
+		panic("should be replaced by fake")
+	})
+	h.Fake(func() greeter { return fakeGreeter{} })
+
+	h.Provider(event.Provider(func(resolver infra.Resolver, listener event.Listener) {}))
+	h.Provider(scheduler.Provider(func(resolver infra.Resolver, creator scheduler.JobCreator) {
+		creator.MustAdd("cleanup", "@every 1h", func() {})
+	}))
+	h.Provider(web.Provider(nil, web.SetRouteHandlerOption(func(resolver infra.Resolver, router web.Router, mw web.RequestMiddleware) {
+		router.Get("/greet/{name}", func(ctx web.Context, g greeter, publisher event.Publisher, flagCtx infra.FlagContext) string {
+			name := ctx.PathVar("name")
+			_ = publisher.Publish(userGreeted{Name: name})
+
+			if !flagCtx.Bool("verbose") {
+				return ""
+			}
+
+			return flagCtx.String("greeting") + ", " + g.Greet(name)
+		})
+	})))
+
+	h.Start()
+
+	resp := h.Get("/greet/mylxsw")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello, fake hello mylxsw" {
+		t.Errorf("unexpected response: %s", body)
+	}
+
+	evt := glaciertest.AssertEventPublished(h, func(evt userGreeted) bool { return evt.Name == "mylxsw" })
+	if evt.Name != "mylxsw" {
+		t.Errorf("unexpected event: %#v", evt)
+	}
+
+	h.AssertCronJob("cleanup", "@every 1h")
+}
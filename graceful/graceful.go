@@ -5,9 +5,11 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/mylxsw/glacier/clock"
 	"github.com/mylxsw/glacier/infra"
 	"github.com/mylxsw/glacier/log"
 )
@@ -15,28 +17,51 @@ import (
 type SignalHandler func(signalChan chan os.Signal, signals []os.Signal)
 
 type gracefulImpl struct {
-	lock sync.Mutex
+	// lock 保护 handler 列表等数据，execLock 保证 reload 和 shutdown 串行执行
+	// handler 执行时不持有 lock，因此 handler 中可以继续注册 handler 或者获取停机统计
+	lock     sync.Mutex
+	execLock sync.Mutex
 
 	reloadSignals   []os.Signal
 	shutdownSignals []os.Signal
 
 	handlerTimeout time.Duration
+	clock          infra.Clock
 
 	signalChan chan os.Signal
+	// stopping 收到停机信号后关闭，之后的 Shutdown/Reload 调用直接返回，不会阻塞
+	stopping chan struct{}
 
 	signalHandler       SignalHandler
 	reloadHandlers      []Handler
 	shutdownHandlers    []Handler
 	preShutdownHandlers []Handler
+
+	shutdownStats []infra.ShutdownPhaseStat
+	// phaseTimeouts 通过 SetShutdownPhaseTimeout 设置的停机阶段超时时间，key 为阶段的 Order
+	phaseTimeouts map[int]time.Duration
 }
 
 type Handler struct {
 	handler     func()
+	phase       infra.ShutdownPhase
 	packagePath string
 	filename    string
 	line        int
 }
 
+func newHandler(h func(), phase infra.ShutdownPhase) Handler {
+	handler := Handler{handler: h, phase: phase}
+	pc, f, line, ok := runtime.Caller(2)
+	if ok {
+		handler.packagePath = runtime.FuncForPC(pc).Name()
+		handler.filename = f
+		handler.line = line
+	}
+
+	return handler
+}
+
 func (h Handler) String() string {
 	return fmt.Sprintf("%s(%s:%d)", h.packagePath, h.filename, h.line)
 }
@@ -47,6 +72,11 @@ func NewWithSignal(reloadSignals []os.Signal, shutdownSignals []os.Signal, perHa
 	})
 }
 
+// NewWithoutSignal 创建不监听任何系统信号的 Graceful，只能通过 Reload/Shutdown 方法触发重新加载和停机，一般用于测试
+func NewWithoutSignal(perHandlerTimeout time.Duration) infra.Graceful {
+	return New(nil, []os.Signal{os.Interrupt}, perHandlerTimeout, func(chan os.Signal, []os.Signal) {})
+}
+
 func New(reloadSignals []os.Signal, shutdownSignals []os.Signal, handlerTimeout time.Duration, signalHandler SignalHandler) infra.Graceful {
 	return &gracefulImpl{
 		reloadSignals:    reloadSignals,
@@ -54,19 +84,32 @@ func New(reloadSignals []os.Signal, shutdownSignals []os.Signal, handlerTimeout
 		reloadHandlers:   make([]Handler, 0),
 		shutdownHandlers: make([]Handler, 0),
 		handlerTimeout:   handlerTimeout,
-		signalChan:       make(chan os.Signal),
+		clock:            clock.System(),
+		signalChan:       make(chan os.Signal, 1),
+		stopping:         make(chan struct{}),
 		signalHandler:    signalHandler,
+		phaseTimeouts:    make(map[int]time.Duration),
 	}
 }
 
+// SetClock 设置计算 handler 执行超时使用的时间源
+func (gf *gracefulImpl) SetClock(c infra.Clock) {
+	gf.lock.Lock()
+	defer gf.lock.Unlock()
+
+	gf.clock = c
+}
+
+// SetShutdownPhaseTimeout 设置停机阶段的超时时间，覆盖阶段自身声明的 Timeout，timeout 为 0 时使用默认的超时时间
+func (gf *gracefulImpl) SetShutdownPhaseTimeout(phase infra.ShutdownPhase, timeout time.Duration) {
+	gf.lock.Lock()
+	defer gf.lock.Unlock()
+
+	gf.phaseTimeouts[phase.Order] = timeout
+}
+
 func (gf *gracefulImpl) AddReloadHandler(h func()) {
-	handler := Handler{handler: h}
-	pc, f, line, ok := runtime.Caller(1)
-	if ok {
-		handler.packagePath = runtime.FuncForPC(pc).Name()
-		handler.filename = f
-		handler.line = line
-	}
+	handler := newHandler(h, infra.ShutdownPhase{})
 
 	gf.lock.Lock()
 	defer gf.lock.Unlock()
@@ -75,13 +118,7 @@ func (gf *gracefulImpl) AddReloadHandler(h func()) {
 }
 
 func (gf *gracefulImpl) AddPreShutdownHandler(h func()) {
-	handler := Handler{handler: h}
-	pc, f, line, ok := runtime.Caller(1)
-	if ok {
-		handler.packagePath = runtime.FuncForPC(pc).Name()
-		handler.filename = f
-		handler.line = line
-	}
+	handler := newHandler(h, infra.ShutdownPhase{})
 
 	gf.lock.Lock()
 	defer gf.lock.Unlock()
@@ -90,13 +127,16 @@ func (gf *gracefulImpl) AddPreShutdownHandler(h func()) {
 }
 
 func (gf *gracefulImpl) AddShutdownHandler(h func()) {
-	handler := Handler{handler: h}
-	pc, f, line, ok := runtime.Caller(1)
-	if ok {
-		handler.packagePath = runtime.FuncForPC(pc).Name()
-		handler.filename = f
-		handler.line = line
-	}
+	handler := newHandler(h, infra.ShutdownPhaseDrainWorkers)
+
+	gf.lock.Lock()
+	defer gf.lock.Unlock()
+
+	gf.shutdownHandlers = append(gf.shutdownHandlers, handler)
+}
+
+func (gf *gracefulImpl) AddShutdownHandlerInPhase(phase infra.ShutdownPhase, h func()) {
+	handler := newHandler(h, phase)
 
 	gf.lock.Lock()
 	defer gf.lock.Unlock()
@@ -118,18 +158,72 @@ func (gf *gracefulImpl) Shutdown() {
 	_ = gf.signalSelf(os.Interrupt)
 }
 
+// ShutdownStats 返回最近一次停机时各阶段的执行统计
+func (gf *gracefulImpl) ShutdownStats() []infra.ShutdownPhaseStat {
+	gf.lock.Lock()
+	defer gf.lock.Unlock()
+
+	return append([]infra.ShutdownPhaseStat{}, gf.shutdownStats...)
+}
+
+// signalSelf 向自身发送信号，Start 尚未执行时信号会被缓存，停机开始之后的信号会被忽略
 func (gf *gracefulImpl) signalSelf(sig os.Signal) error {
-	gf.signalChan <- sig
-	return nil
+	select {
+	case gf.signalChan <- sig:
+		return nil
+	case <-gf.stopping:
+		return fmt.Errorf("[glacier] graceful is shutting down, signal %s is ignored", sig)
+	}
+}
+
+// shutdownPhases 将停机 handler 按照所属阶段分组，并按照阶段的 Order 排序，调用时需要持有 lock
+func (gf *gracefulImpl) shutdownPhases() ([]infra.ShutdownPhase, map[int][]Handler) {
+	phases := make([]infra.ShutdownPhase, 0)
+	handlers := make(map[int][]Handler)
+	for _, handler := range gf.shutdownHandlers {
+		order := handler.phase.Order
+		if _, ok := handlers[order]; !ok {
+			phases = append(phases, handler.phase)
+		} else {
+			// Order 相同的阶段合并为一个阶段，超时时间取最大值
+			for i := range phases {
+				if phases[i].Order == order {
+					if phases[i].Name == "" {
+						phases[i].Name = handler.phase.Name
+					}
+					if handler.phase.Timeout > phases[i].Timeout {
+						phases[i].Timeout = handler.phase.Timeout
+					}
+				}
+			}
+		}
+
+		handlers[order] = append(handlers[order], handler)
+	}
+
+	for i := range phases {
+		if timeout, ok := gf.phaseTimeouts[phases[i].Order]; ok {
+			phases[i].Timeout = timeout
+		}
+	}
+
+	sort.SliceStable(phases, func(i, j int) bool { return phases[i].Order < phases[j].Order })
+	return phases, handlers
 }
 
 func (gf *gracefulImpl) shutdown() {
-	startTs := time.Now()
+	gf.execLock.Lock()
+	defer gf.execLock.Unlock()
 
 	gf.lock.Lock()
-	defer gf.lock.Unlock()
+	clock, handlerTimeout := gf.clock, gf.handlerTimeout
+	preShutdownHandlers := append([]Handler{}, gf.preShutdownHandlers...)
+	phases, handlers := gf.shutdownPhases()
+	gf.lock.Unlock()
 
-	for _, handler := range gf.preShutdownHandlers {
+	startTs := clock.Now()
+
+	for _, handler := range preShutdownHandlers {
 		if infra.DEBUG {
 			log.Debugf("[glacier] pre shutdown handler: %s", handler.String())
 		}
@@ -137,121 +231,120 @@ func (gf *gracefulImpl) shutdown() {
 		handler.handler()
 	}
 
-	handlerExecutedStat := make([]bool, len(gf.shutdownHandlers))
-	for i := len(gf.shutdownHandlers) - 1; i >= 0; i-- {
-		handlerExecutedStat[i] = false
-	}
-
-	var wg sync.WaitGroup
-	wg.Add(len(gf.shutdownHandlers))
-	for i := len(gf.shutdownHandlers) - 1; i >= 0; i-- {
-		go func(i int, handler Handler) {
-			startTs := time.Now()
-			if infra.DEBUG {
-				log.Debugf("[glacier] executing shutdown handler [%s]", handler.String())
-			}
+	// handlerTimeout 是整个停机过程的超时时间，每个阶段最多只能使用剩余的时间
+	deadline := startTs.Add(handlerTimeout)
 
-			defer func() {
-				if err := recover(); err != nil {
-					log.Errorf("[glacier] executing shutdown handler [%s] failed: %s", handler.String(), err)
-				}
+	stats := make([]infra.ShutdownPhaseStat, 0, len(phases))
+	for _, phase := range phases {
+		timeout := deadline.Sub(clock.Now())
+		if timeout < 0 {
+			timeout = 0
+		}
 
-				if infra.DEBUG {
-					log.Debugf("[glacier] shutdown handler [%s] finished, took %s", handler.String(), time.Since(startTs).String())
-				}
+		if phase.Timeout > 0 && phase.Timeout < timeout {
+			timeout = phase.Timeout
+		}
 
-				handlerExecutedStat[i] = true
-				wg.Done()
-			}()
+		if infra.DEBUG {
+			log.Debugf("[glacier] shutdown phase [%s] started, %d handlers", phase.Name, len(handlers[phase.Order]))
+		}
 
-			handler.handler()
-		}(i, gf.shutdownHandlers[i])
+		took, timedOut := executeHandlers(clock, "shutdown ["+phase.Name+"]", handlers[phase.Order], timeout)
+		stats = append(stats, infra.ShutdownPhaseStat{
+			Phase:    phase,
+			Handlers: len(handlers[phase.Order]),
+			Took:     took,
+			TimedOut: timedOut,
+		})
 	}
 
-	ok := make(chan interface{})
-	defer close(ok)
-
-	go func() {
-		wg.Wait()
-		ok <- struct{}{}
-	}()
-
-	select {
-	case <-ok:
-		if infra.DEBUG {
-			log.Debugf("[glacier] all shutdown handlers executed, took %s", time.Since(startTs))
-		}
-	case <-time.After(gf.handlerTimeout):
-		log.Errorf("[glacier] executing shutdown handlers timed out, took %s", time.Since(startTs))
-		for i, executed := range handlerExecutedStat {
-			if executed {
-				continue
-			}
+	gf.lock.Lock()
+	gf.shutdownStats = stats
+	gf.lock.Unlock()
 
-			log.Errorf("[glacier] shutdown handler [%s] may not finished", gf.shutdownHandlers[i].String())
-		}
+	if infra.DEBUG {
+		log.Debugf("[glacier] all shutdown phases finished, took %s", clock.Since(startTs))
 	}
 }
 
 func (gf *gracefulImpl) reload() {
-	startTs := time.Now()
+	gf.execLock.Lock()
+	defer gf.execLock.Unlock()
 
 	gf.lock.Lock()
-	defer gf.lock.Unlock()
+	clock, handlerTimeout := gf.clock, gf.handlerTimeout
+	reloadHandlers := append([]Handler{}, gf.reloadHandlers...)
+	gf.lock.Unlock()
 
-	handlerExecutedStat := make([]bool, len(gf.shutdownHandlers))
-	for i := len(gf.shutdownHandlers) - 1; i >= 0; i-- {
-		handlerExecutedStat[i] = false
-	}
+	executeHandlers(clock, "reload", reloadHandlers, handlerTimeout)
+}
+
+// executeHandlers 并发执行所有的 handler，等待全部执行完毕或者超时
+func executeHandlers(clock infra.Clock, kind string, handlers []Handler, timeout time.Duration) (time.Duration, bool) {
+	startTs := clock.Now()
+
+	var statLock sync.Mutex
+	handlerExecutedStat := make([]bool, len(handlers))
 
 	var wg sync.WaitGroup
-	wg.Add(len(gf.reloadHandlers))
-	for i := len(gf.reloadHandlers) - 1; i >= 0; i-- {
+	wg.Add(len(handlers))
+	for i := len(handlers) - 1; i >= 0; i-- {
 		go func(i int, handler Handler) {
-			startTs := time.Now()
+			startTs := clock.Now()
 			if infra.DEBUG {
-				log.Debugf("[glacier] executing reload handler [%s]", handler.String())
+				log.Debugf("[glacier] executing %s handler [%s]", kind, handler.String())
 			}
 
 			defer func() {
 				if err := recover(); err != nil {
-					log.Errorf("[glacier] executing reload handler failed: %s", err)
+					log.Errorf("[glacier] executing %s handler [%s] failed: %s", kind, handler.String(), err)
 				}
 
 				if infra.DEBUG {
-					log.Debugf("[glacier] reload handler [%s] finished, took %s", handler.String(), time.Since(startTs).String())
+					log.Debugf("[glacier] %s handler [%s] finished, took %s", kind, handler.String(), clock.Since(startTs).String())
 				}
 
+				statLock.Lock()
 				handlerExecutedStat[i] = true
+				statLock.Unlock()
+
 				wg.Done()
 			}()
 
 			handler.handler()
-		}(i, gf.reloadHandlers[i])
+		}(i, handlers[i])
 	}
 
-	ok := make(chan interface{})
-	defer close(ok)
-
+	ok := make(chan interface{}, 1)
 	go func() {
 		wg.Wait()
 		ok <- struct{}{}
 	}()
 
+	timer := clock.NewTimer(timeout)
+	defer timer.Stop()
+
 	select {
 	case <-ok:
 		if infra.DEBUG {
-			log.Debugf("[glacier] all reload handlers executed, took %s", time.Since(startTs))
+			log.Debugf("[glacier] all %s handlers executed, took %s", kind, clock.Since(startTs))
 		}
-	case <-time.After(gf.handlerTimeout):
-		log.Errorf("[glacier] executing reload handlers timed out, took %s", time.Since(startTs))
+		return clock.Since(startTs), false
+	case <-timer.C():
+		log.Errorf("[glacier] executing %s handlers timed out, took %s", kind, clock.Since(startTs))
+
+		statLock.Lock()
+		defer statLock.Unlock()
+
 		for i, executed := range handlerExecutedStat {
 			if executed {
 				continue
 			}
 
-			log.Errorf("[glacier] reload handler [%s] may not finished", gf.shutdownHandlers[i].String())
+			log.Errorf("[glacier] %s handler [%s] may not finished", kind, handlers[i].String())
 		}
+
+		return clock.Since(startTs), true
 	}
 }
 
@@ -284,6 +377,7 @@ func (gf *gracefulImpl) Start() error {
 		}
 	}
 FINAL:
+	close(gf.stopping)
 	gf.shutdown()
 
 	return nil
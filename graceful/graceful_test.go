@@ -0,0 +1,126 @@
+package graceful
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+)
+
+func TestShutdownPhases(t *testing.T) {
+	gf := NewWithoutSignal(time.Second).(*gracefulImpl)
+	gf.SetShutdownPhaseTimeout(infra.ShutdownPhaseCloseResources, 20*time.Millisecond)
+
+	var lock sync.Mutex
+	calls := make([]string, 0)
+	record := func(name string) func() {
+		return func() {
+			lock.Lock()
+			defer lock.Unlock()
+
+			calls = append(calls, name)
+		}
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	gf.AddShutdownHandlerInPhase(infra.ShutdownPhaseFinal, func() {
+		// handler 执行时不持有锁，可以继续注册 handler 以及获取停机统计
+		gf.AddShutdownHandler(func() {})
+		_ = gf.ShutdownStats()
+		record("final")()
+	})
+	gf.AddShutdownHandlerInPhase(infra.ShutdownPhaseCloseResources, func() {
+		record("close-resources")()
+		<-release
+	})
+	gf.AddShutdownHandler(record("drain-workers"))
+	gf.AddShutdownHandlerInPhase(infra.ShutdownPhaseStopTraffic, record("stop-traffic"))
+	gf.AddPreShutdownHandler(record("pre-shutdown"))
+
+	done := make(chan error)
+	go func() { done <- gf.Start() }()
+	gf.Shutdown()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("shutdown should finish")
+	}
+
+	expected := []string{"pre-shutdown", "stop-traffic", "drain-workers", "close-resources", "final"}
+	if len(calls) != len(expected) {
+		t.Fatalf("unexpected handler calls: %v", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("unexpected handler calls: %v", calls)
+		}
+	}
+
+	stats := gf.ShutdownStats()
+	if len(stats) != 4 {
+		t.Fatalf("unexpected shutdown stats: %+v", stats)
+	}
+
+	for _, stat := range stats {
+		timedOut := stat.Phase.Order == infra.ShutdownPhaseCloseResources.Order
+		if stat.Handlers != 1 || stat.TimedOut != timedOut {
+			t.Errorf("unexpected stat for phase %s: %+v", stat.Phase.Name, stat)
+		}
+	}
+
+	if stats[2].Phase.Timeout != 20*time.Millisecond {
+		t.Errorf("phase timeout should be overridden, got %s", stats[2].Phase.Timeout)
+	}
+}
+
+func TestShutdownDoesNotBlock(t *testing.T) {
+	gf := NewWithoutSignal(time.Second)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// Start 执行之前的停机请求会被缓存，Start 返回之后的停机请求直接忽略
+		gf.Shutdown()
+		_ = gf.Start()
+		gf.Shutdown()
+		gf.Shutdown()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown should not block")
+	}
+}
+
+func TestShutdownTimeoutCoversAllPhases(t *testing.T) {
+	gf := NewWithoutSignal(100 * time.Millisecond).(*gracefulImpl)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	block := func() { <-release }
+	gf.AddShutdownHandlerInPhase(infra.ShutdownPhaseStopTraffic, block)
+	gf.AddShutdownHandlerInPhase(infra.ShutdownPhaseDrainWorkers, block)
+	gf.AddShutdownHandlerInPhase(infra.ShutdownPhaseCloseResources, block)
+
+	startTs := time.Now()
+	gf.Shutdown()
+	_ = gf.Start()
+
+	// 所有阶段共用停机超时时间，而不是每个阶段单独计算
+	if took := time.Since(startTs); took > 250*time.Millisecond {
+		t.Errorf("shutdown should finish within the overall timeout, took %s", took)
+	}
+
+	for _, stat := range gf.ShutdownStats() {
+		if !stat.TimedOut {
+			t.Errorf("phase %s should time out", stat.Phase.Name)
+		}
+	}
+}
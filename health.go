@@ -0,0 +1,38 @@
+package glacier
+
+import (
+	"github.com/mylxsw/glacier/health"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
+)
+
+// registerHealthCheckers 将实现了 infra.HealthChecker 接口的 Provider 和 Service 注册到健康检查中心
+func (impl *framework) registerHealthCheckers(registry health.Registry) {
+	impl.registerHealthCheckerEntries(registry, "", impl.providers, impl.services)
+}
+
+// registerHealthCheckerEntries 注册 providers 和 services 中的健康检查，prefix 为检查名称的前缀，返回注册的检查名称
+func (impl *framework) registerHealthCheckerEntries(registry health.Registry, prefix string, providers []*providerEntry, services []*serviceEntry) []string {
+	names := make([]string, 0)
+	for _, p := range providers {
+		if checker, ok := p.provider.(infra.HealthChecker); ok {
+			if infra.DEBUG {
+				log.Debugf("[glacier] register health checker for provider %s", p.Name())
+			}
+			names = append(names, prefix+"provider:"+p.Name())
+			registry.Register(prefix+"provider:"+p.Name(), checker)
+		}
+	}
+
+	for _, s := range services {
+		if checker, ok := s.service.(infra.HealthChecker); ok {
+			if infra.DEBUG {
+				log.Debugf("[glacier] register health checker for service %s", s.Name())
+			}
+			names = append(names, prefix+"service:"+s.Name())
+			registry.Register(prefix+"service:"+s.Name(), checker)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,242 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/glacier/clock"
+	"github.com/mylxsw/glacier/infra"
+)
+
+const (
+	// DefaultTimeout 单个健康检查的默认超时时间
+	DefaultTimeout = 3 * time.Second
+	// DefaultCacheTTL 健康检查结果的默认缓存时间
+	DefaultCacheTTL = time.Second
+)
+
+// Status 健康状态
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// CheckResult 单项健康检查结果
+type CheckResult struct {
+	Name   string        `json:"name"`
+	Status Status        `json:"status"`
+	Error  string        `json:"error,omitempty"`
+	Took   time.Duration `json:"took"`
+}
+
+// Report 健康检查汇总报告
+type Report struct {
+	Status    Status        `json:"status"`
+	Live      bool          `json:"live"`
+	Ready     bool          `json:"ready"`
+	Checks    []CheckResult `json:"checks"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// Registry 健康检查中心，汇总所有模块的健康检查结果，同时维护应用的存活（liveness）和就绪（readiness）状态
+type Registry interface {
+	// Register 注册一个健康检查
+	Register(name string, checker infra.HealthChecker)
+	// Unregister 移除指定名称的健康检查，缓存的检查结果同时失效
+	Unregister(name string)
+	// Check 执行所有的健康检查，在缓存有效期内直接返回上一次的检查结果
+	// 检查结果会被所有调用方共享，因此检查使用独立的 context（超时时间为 Registry 的 timeout）执行，不受 ctx 取消的影响
+	Check(ctx context.Context) Report
+
+	// SetLive 设置应用的存活状态
+	SetLive(live bool)
+	// SetReady 设置应用的就绪状态
+	SetReady(ready bool)
+	// Live 应用是否存活
+	Live() bool
+	// Ready 应用是否就绪
+	Ready() bool
+}
+
+// CheckerFunc 将函数转换为 infra.HealthChecker
+type CheckerFunc func(ctx context.Context) error
+
+func (fn CheckerFunc) Health(ctx context.Context) error {
+	return fn(ctx)
+}
+
+type namedChecker struct {
+	name    string
+	checker infra.HealthChecker
+}
+
+type registryImpl struct {
+	lock     sync.RWMutex
+	checkers []namedChecker
+
+	timeout  time.Duration
+	cacheTTL time.Duration
+	clock    infra.Clock
+
+	cacheLock sync.Mutex
+	cached    *Report
+
+	live  bool
+	ready bool
+}
+
+// NewRegistry 创建一个健康检查中心，timeout 为单个检查的超时时间，cacheTTL 为检查结果的缓存时间
+func NewRegistry(timeout time.Duration, cacheTTL time.Duration) Registry {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &registryImpl{
+		checkers: make([]namedChecker, 0),
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+		clock:    clock.System(),
+	}
+}
+
+// SetClock 设置计算缓存有效期以及检查耗时使用的时间源
+func (r *registryImpl) SetClock(c infra.Clock) {
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+
+	r.clock = c
+}
+
+func (r *registryImpl) Register(name string, checker infra.HealthChecker) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.checkers = append(r.checkers, namedChecker{name: name, checker: checker})
+}
+
+func (r *registryImpl) Unregister(name string) {
+	r.lock.Lock()
+	checkers := make([]namedChecker, 0, len(r.checkers))
+	for _, c := range r.checkers {
+		if c.name != name {
+			checkers = append(checkers, c)
+		}
+	}
+	r.checkers = checkers
+	r.lock.Unlock()
+
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+
+	r.cached = nil
+}
+
+func (r *registryImpl) SetLive(live bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.live = live
+}
+
+func (r *registryImpl) SetReady(ready bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.ready = ready
+}
+
+func (r *registryImpl) Live() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.live
+}
+
+func (r *registryImpl) Ready() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.ready
+}
+
+func (r *registryImpl) Check(ctx context.Context) Report {
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+
+	if r.cached == nil || r.clock.Since(r.cached.CheckedAt) >= r.cacheTTL {
+		r.cached = r.check(context.Background())
+	}
+
+	report := *r.cached
+	report.Live, report.Ready = r.Live(), r.Ready()
+	return report
+}
+
+func (r *registryImpl) check(ctx context.Context) *Report {
+	r.lock.RLock()
+	checkers := append([]namedChecker{}, r.checkers...)
+	r.lock.RUnlock()
+
+	results := make([]CheckResult, len(checkers))
+
+	var wg sync.WaitGroup
+	wg.Add(len(checkers))
+	for i, c := range checkers {
+		go func(i int, c namedChecker) {
+			defer wg.Done()
+			results[i] = r.checkOne(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	report := Report{Status: StatusUp, Checks: results, CheckedAt: r.clock.Now()}
+	for _, res := range results {
+		if res.Status != StatusUp {
+			report.Status = StatusDown
+			break
+		}
+	}
+
+	return &report
+}
+
+func (r *registryImpl) checkOne(ctx context.Context, c namedChecker) (result CheckResult) {
+	startTs := r.clock.Now()
+	result = CheckResult{Name: c.name, Status: StatusUp}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				errCh <- fmt.Errorf("health check panic: %v", err)
+			}
+		}()
+
+		errCh <- c.checker.Health(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("health check timed out after %s", r.timeout)
+	}
+
+	result.Took = r.clock.Since(startTs)
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
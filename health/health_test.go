@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/clock"
+	"github.com/mylxsw/glacier/infra"
+)
+
+func TestRegistry(t *testing.T) {
+	var calls int32
+	registry := NewRegistry(50*time.Millisecond, time.Hour)
+	registry.Register("db", CheckerFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("connection refused")
+	}))
+	registry.Register("cache", CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	registry.SetLive(true)
+
+	// 调用方的 context 已经取消时，检查依然使用独立的 context 执行
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := registry.Check(ctx)
+	if report.Status != StatusDown || !report.Live || report.Ready || len(report.Checks) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	if report.Checks[0].Name != "cache" || report.Checks[0].Error != "health check timed out after 50ms" {
+		t.Errorf("unexpected cache check: %+v", report.Checks[0])
+	}
+
+	if report.Checks[1].Name != "db" || report.Checks[1].Error != "connection refused" {
+		t.Errorf("unexpected db check: %+v", report.Checks[1])
+	}
+
+	// 缓存有效期内不会重新检查，但是存活和就绪状态总是最新的
+	registry.SetReady(true)
+	if report := registry.Check(context.Background()); !report.Ready || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("report should be cached, calls: %d, report: %+v", atomic.LoadInt32(&calls), report)
+	}
+
+	noCache := NewRegistry(time.Second, 0)
+	noCache.Register("db", CheckerFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}))
+
+	noCache.Check(context.Background())
+	if report := noCache.Check(context.Background()); report.Status != StatusUp || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("report should not be cached, calls: %d, report: %+v", atomic.LoadInt32(&calls), report)
+	}
+}
+
+func TestRegistryCacheTTL(t *testing.T) {
+	var calls int32
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	registry := NewRegistry(time.Second, time.Minute)
+	registry.(infra.ClockAware).SetClock(fake)
+	registry.Register("db", CheckerFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}))
+
+	if report := registry.Check(context.Background()); !report.CheckedAt.Equal(fake.Now()) {
+		t.Errorf("report should be checked at the clock's time, got %s", report.CheckedAt)
+	}
+
+	fake.Advance(59 * time.Second)
+	registry.Check(context.Background())
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("report should be cached before the ttl expires, calls: %d", atomic.LoadInt32(&calls))
+	}
+
+	fake.Advance(time.Second)
+	registry.Check(context.Background())
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("report should be refreshed after the ttl expires, calls: %d", atomic.LoadInt32(&calls))
+	}
+}
@@ -3,29 +3,164 @@ package glacier
 import (
 	"fmt"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
 )
 
-// PreBind 设置预绑定实例，这里会确保在容器中第一次进行对象实例化之前完成实例绑定
-func (impl *framework) PreBind(fn func(binder infra.Binder)) infra.Glacier {
-	impl.preBinder = fn
+// SetHookNameOption 设置钩子名称
+func SetHookNameOption(name string) infra.HookOption {
+	return func(opts *infra.HookOptions) {
+		opts.Name = name
+	}
+}
+
+// SetHookPriorityOption 设置钩子优先级，值越小越先执行
+func SetHookPriorityOption(priority int) infra.HookOption {
+	return func(opts *infra.HookOptions) {
+		opts.Priority = priority
+	}
+}
+
+// HookFailure 执行失败的钩子
+type HookFailure struct {
+	Name string
+	Err  error
+}
+
+// HookError 钩子执行失败时返回的错误，包含所有执行失败的钩子
+type HookError struct {
+	// Kind 钩子类型，比如 init、preBind、beforeServerStop
+	Kind     string
+	Failures []HookFailure
+}
+
+func (e *HookError) Error() string {
+	messages := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		messages = append(messages, fmt.Sprintf("  - %s: %v", f.Name, f.Err))
+	}
+
+	return fmt.Sprintf("[glacier] %d %s hooks failed:\n%s", len(e.Failures), e.Kind, strings.Join(messages, "\n"))
+}
+
+// hookEntry 带有名称和优先级的钩子
+type hookEntry struct {
+	name     string
+	priority int
+	fn       interface{}
+}
+
+// hookList 按照优先级排列的钩子列表，优先级相同时按照添加顺序排列
+type hookList []hookEntry
+
+func newHookEntry(fn interface{}, options ...infra.HookOption) hookEntry {
+	var opts infra.HookOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if opts.Name == "" {
+		opts.Name = runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	}
+
+	return hookEntry{name: opts.Name, priority: opts.Priority, fn: fn}
+}
+
+func (hooks hookList) add(entry hookEntry) hookList {
+	hooks = append(hooks, entry)
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].priority < hooks[j].priority })
+	return hooks
+}
+
+// run 依次执行所有钩子，某个钩子失败（返回错误或者 panic）不影响后续钩子的执行，最后返回所有失败的钩子
+func (hooks hookList) run(impl *framework, kind string, call func(fn interface{}) error) error {
+	failures := make([]HookFailure, 0)
+	for _, hook := range hooks {
+		if infra.DEBUG {
+			impl.pushGraphvizNode(fmt.Sprintf("invoke %s hook: %s", kind, hook.name), false).Style = infra.GraphvizNodeStyleHook
+			log.Debugf("[glacier] invoke %s hook [%s]", kind, hook.name)
+		}
+
+		if err := callHook(hook, call); err != nil {
+			failures = append(failures, HookFailure{Name: hook.name, Err: err})
+		}
+	}
+
+	if len(failures) > 0 {
+		return &HookError{Kind: kind, Failures: failures}
+	}
+
+	return nil
+}
+
+func callHook(hook hookEntry, call func(fn interface{}) error) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+
+	return call(hook.fn)
+}
+
+// PreBind 添加预绑定钩子，这里会确保在容器中第一次进行对象实例化之前完成实例绑定
+func (impl *framework) PreBind(fn func(binder infra.Binder), options ...infra.HookOption) infra.Glacier {
+	impl.preBindHooks = impl.preBindHooks.add(newHookEntry(fn, options...))
 	return impl
 }
 
-// Init set a hook func executed before server initialize
+// Init add a hook func executed before server initialize
 // Usually, we use this method to initialize the log configuration
-func (impl *framework) Init(f func(c infra.FlagContext) error) infra.Glacier {
-	impl.init = f
+func (impl *framework) Init(f func(c infra.FlagContext) error, options ...infra.HookOption) infra.Glacier {
+	impl.initHooks = impl.initHooks.add(newHookEntry(f, options...))
 	return impl
 }
 
+// addHooks 添加模块提供的 Init、PreBind 钩子
+func (impl *framework) addHooks(hooks infra.Hooks) {
+	for _, h := range hooks.Init {
+		impl.Init(h.Fn, SetHookNameOption(h.Name), SetHookPriorityOption(h.Priority))
+	}
+	for _, h := range hooks.PreBind {
+		impl.PreBind(h.Fn, SetHookNameOption(h.Name), SetHookPriorityOption(h.Priority))
+	}
+}
+
+// collectProviderHooks 收集 Provider 及其聚合的 Provider 提供的 Init、PreBind 钩子
+func (impl *framework) collectProviderHooks(p infra.Provider) {
+	if ex, ok := p.(infra.ProviderAggregate); ok {
+		for _, exp := range ex.Aggregates() {
+			impl.collectProviderHooks(exp)
+		}
+	}
+
+	if ha, ok := p.(infra.HookAggregate); ok {
+		impl.addHooks(ha.Hooks())
+	}
+}
+
+// collectStopHooks 收集 providers 提供的 BeforeServerStop 钩子，providers 应该已经过滤，
+// 被 ShouldLoad 或者运行环境排除的 Provider 提供的钩子不会执行
+func (impl *framework) collectStopHooks(providers []*providerEntry) {
+	for _, p := range providers {
+		if ha, ok := p.provider.(infra.HookAggregate); ok {
+			for _, h := range ha.Hooks().BeforeServerStop {
+				impl.BeforeServerStop(h.Fn, SetHookNameOption(h.Name), SetHookPriorityOption(h.Priority))
+			}
+		}
+	}
+}
+
 // OnServerReady call a function on server ready
 func (impl *framework) OnServerReady(ffs ...interface{}) {
 	impl.lock.Lock()
 	defer impl.lock.Unlock()
 
-	if impl.status == Started {
+	if impl.status >= Started {
 		panic(fmt.Errorf("[glacier] can not call OnServerReady since server has been started"))
 	}
 
@@ -35,12 +170,12 @@ func (impl *framework) OnServerReady(ffs ...interface{}) {
 			panic(fmt.Errorf("[glacier] argument for OnServerReady [%s] must be a callable function", fn.name))
 		}
 
-		impl.onServerReadyHooks = append(impl.onServerReadyHooks, fn)
+		impl.onServerReadyHooks = append(impl.onServerReadyHooks, newReadyHook(f, SetReadyHookNameOption(fn.name)))
 	}
 }
 
-// BeforeServerStop set a hook func executed before server stop
-func (impl *framework) BeforeServerStop(f func(cc infra.Resolver) error) infra.Glacier {
-	impl.beforeServerStop = f
+// BeforeServerStop add a hook func executed before server stop
+func (impl *framework) BeforeServerStop(f func(cc infra.Resolver) error, options ...infra.HookOption) infra.Glacier {
+	impl.beforeServerStopHooks = impl.beforeServerStopHooks.add(newHookEntry(f, options...))
 	return impl
 }
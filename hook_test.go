@@ -0,0 +1,97 @@
+package glacier
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+type hookAggregateProvider struct{ calls *[]string }
+
+func (hookAggregateProvider) Register(binder infra.Binder) {}
+func (p hookAggregateProvider) Hooks() infra.Hooks {
+	return infra.Hooks{Init: []infra.InitHook{{
+		Name:     "aggregated",
+		Priority: -1,
+		Fn: func(fc infra.FlagContext) error {
+			*p.calls = append(*p.calls, "aggregated")
+			return nil
+		},
+	}}}
+}
+
+type hookParentProvider struct{ calls *[]string }
+
+func (hookParentProvider) Register(binder infra.Binder) {}
+func (p hookParentProvider) Aggregates() []infra.Provider {
+	return []infra.Provider{hookAggregateProvider{calls: p.calls}}
+}
+
+func TestInitHooks(t *testing.T) {
+	calls := make([]string, 0)
+	hook := func(name string, err error) func(fc infra.FlagContext) error {
+		return func(fc infra.FlagContext) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	impl := New("1.0", 1).(*framework)
+	impl.Init(hook("second", errors.New("failed")), SetHookNameOption("second"), SetHookPriorityOption(10))
+	impl.Init(hook("first", nil), SetHookNameOption("first"))
+	impl.Init(func(fc infra.FlagContext) error { panic("oops") }, SetHookNameOption("panic"), SetHookPriorityOption(10))
+	impl.Provider(hookParentProvider{calls: &calls})
+
+	err := impl.Start(nil)
+
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) || len(hookErr.Failures) != 2 {
+		t.Fatalf("expect 2 failed init hooks, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "second: failed") || !strings.Contains(err.Error(), "panic: panic: oops") {
+		t.Errorf("failures should contain hook names: %v", err)
+	}
+
+	if strings.Join(calls, ",") != "aggregated,first,second" {
+		t.Errorf("unexpected hook order: %v", calls)
+	}
+}
+
+type stopHookProvider struct{ load bool }
+
+func (stopHookProvider) Register(binder infra.Binder) {}
+func (p stopHookProvider) ShouldLoad() bool           { return p.load }
+func (p stopHookProvider) Hooks() infra.Hooks {
+	return infra.Hooks{BeforeServerStop: []infra.BeforeServerStopHook{{
+		Name: "stop",
+		Fn:   func(resolver infra.Resolver) error { return nil },
+	}}}
+}
+
+func TestStopHooksOfSkippedProvider(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Provider(stopHookProvider{load: false})
+	impl.cc = ioc.New()
+
+	if err := impl.registerProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(impl.beforeServerStopHooks) != 0 {
+		t.Fatalf("stop hooks of skipped provider should not be collected, got %d", len(impl.beforeServerStopHooks))
+	}
+
+	impl = New("1.0", 1).(*framework)
+	impl.Provider(stopHookProvider{load: true})
+	impl.cc = ioc.New()
+
+	if err := impl.registerProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(impl.beforeServerStopHooks) != 1 || impl.beforeServerStopHooks[0].name != "stop" {
+		t.Fatalf("expect stop hook of loaded provider, got %+v", impl.beforeServerStopHooks)
+	}
+}
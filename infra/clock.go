@@ -0,0 +1,31 @@
+package infra
+
+import "time"
+
+// Clock 时间源，框架中定时任务触发、停机超时、启动耗时统计等与时间相关的操作都通过它完成，
+// 测试时可以替换为能够手动推进时间的实现
+type Clock interface {
+	// Now 返回当前时间
+	Now() time.Time
+	// Since 返回从 t 到当前时间经过的时长
+	Since(t time.Time) time.Duration
+	// After 等待 d 之后向返回的 channel 发送当前时间
+	After(d time.Duration) <-chan time.Time
+	// NewTimer 创建一个在 d 之后触发的 Timer
+	NewTimer(d time.Duration) Timer
+	// Sleep 阻塞 d 时长
+	Sleep(d time.Duration)
+}
+
+// Timer 由 Clock 创建的定时器
+type Timer interface {
+	// C 定时器触发时，会向该 channel 发送当前时间
+	C() <-chan time.Time
+	// Stop 停止定时器，定时器已经触发或者已经停止时返回 false
+	Stop() bool
+}
+
+// ClockAware 实现该接口的对象（比如 Graceful）会在创建后被注入框架使用的 Clock
+type ClockAware interface {
+	SetClock(clock Clock)
+}
@@ -16,7 +16,9 @@ func (nodes GraphvizNodes) Draw() string {
 	graph := `digraph G {
     node [shape = "box" style = "filled,rounded" fillcolor = "gold"]
 `
+	// clusterNames 记录 cluster 首次出现的顺序，保证输出结果是确定的
 	clusters := make(map[string][]string)
+	clusterNames := make([]string, 0)
 	var cluster []string
 	var clusterName string
 	for _, node := range nodes {
@@ -27,6 +29,9 @@ func (nodes GraphvizNodes) Draw() string {
 		}
 
 		if node.Type == GraphvizNodeTypeClusterEnd {
+			if _, ok := clusters[clusterName]; !ok {
+				clusterNames = append(clusterNames, clusterName)
+			}
 			clusters[clusterName] = cluster
 			clusterName = ""
 			cluster = nil
@@ -45,7 +50,8 @@ func (nodes GraphvizNodes) Draw() string {
 		}
 	}
 
-	for name, cluster := range clusters {
+	for _, name := range clusterNames {
+		cluster := clusters[name]
 		graph += fmt.Sprintf(`    subgraph cluster_%s {
         label = "%s"
         style = "rounded,dashed,filled"
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/mylxsw/go-ioc"
@@ -13,6 +14,8 @@ import (
 const (
 	VersionKey     string = "version"
 	StartupTimeKey string = "startup_time"
+	// ProfileKey 当前运行环境在容器中绑定的 key，值的类型为 infra.Profile
+	ProfileKey string = "profile"
 )
 
 var (
@@ -24,8 +27,66 @@ var (
 	PrintGraph = false
 )
 
+// ShutdownPhase 停机阶段，停机时按照 Order 从小到大依次执行各阶段的 handler，同一阶段内的 handler 并发执行
+// Order 相同的阶段视为同一个阶段，Timeout 为该阶段的超时时间，为 0 时使用整个停机过程剩余的时间
+// 所有阶段共用 Graceful 的停机超时时间，阶段的 Timeout 超过剩余时间时以剩余时间为准
+type ShutdownPhase struct {
+	Name    string
+	Order   int
+	Timeout time.Duration
+}
+
+var (
+	// ShutdownPhaseStopTraffic 停止接收流量，比如关闭 HTTP 服务、停止定时任务调度
+	ShutdownPhaseStopTraffic = ShutdownPhase{Name: "stop-traffic", Order: 100}
+	// ShutdownPhaseDrainAsyncJobs 关闭异步任务队列，等待队列中的异步任务执行完毕
+	ShutdownPhaseDrainAsyncJobs = ShutdownPhase{Name: "drain-async-jobs", Order: 150}
+	// ShutdownPhaseDrainWorkers 等待正在执行的任务完成，AddShutdownHandler 注册的 handler 默认属于该阶段
+	// 框架会在该阶段取消传递给 DaemonProvider、Service 以及异步任务的 context
+	ShutdownPhaseDrainWorkers = ShutdownPhase{Name: "drain-workers", Order: 200}
+	// ShutdownPhaseCloseResources 关闭数据库连接池等资源
+	ShutdownPhaseCloseResources = ShutdownPhase{Name: "close-resources", Order: 300}
+	// ShutdownPhaseFinal 最后执行的清理操作
+	ShutdownPhaseFinal = ShutdownPhase{Name: "final", Order: 400}
+)
+
+// ShutdownPhaseStat 停机阶段执行统计
+type ShutdownPhaseStat struct {
+	Phase    ShutdownPhase
+	Handlers int
+	Took     time.Duration
+	TimedOut bool
+}
+
+// ShutdownReporter 实现该接口的 Graceful 可以在停机完成后提供各阶段的执行统计
+type ShutdownReporter interface {
+	ShutdownStats() []ShutdownPhaseStat
+}
+
+// PhasedGraceful 实现该接口的 Graceful 支持按照停机阶段注册 handler
+type PhasedGraceful interface {
+	// AddShutdownHandlerInPhase 在指定的停机阶段添加 handler
+	AddShutdownHandlerInPhase(phase ShutdownPhase, h func())
+}
+
+// ShutdownPhaseTimeoutAware 实现该接口的 Graceful 支持覆盖停机阶段的超时时间
+type ShutdownPhaseTimeoutAware interface {
+	SetShutdownPhaseTimeout(phase ShutdownPhase, timeout time.Duration)
+}
+
+// AddShutdownHandlerInPhase 在指定的停机阶段添加 handler，gf 没有实现 PhasedGraceful 接口时等同于 AddShutdownHandler
+func AddShutdownHandlerInPhase(gf Graceful, phase ShutdownPhase, h func()) {
+	if pg, ok := gf.(PhasedGraceful); ok {
+		pg.AddShutdownHandlerInPhase(phase, h)
+		return
+	}
+
+	gf.AddShutdownHandler(h)
+}
+
 type Graceful interface {
 	AddReloadHandler(h func())
+	// AddShutdownHandler 添加停机 handler，实现了 PhasedGraceful 接口时等同于在 ShutdownPhaseDrainWorkers 阶段添加
 	AddShutdownHandler(h func())
 	// AddPreShutdownHandler 在所有服务停止之前执行，用于执行一些清理操作，该操作会阻塞服务停止，直到该操作完成，不受超时时间限制
 	AddPreShutdownHandler(h func())
@@ -64,6 +125,300 @@ type Reloadable interface {
 	Reload()
 }
 
+// RestartPolicy 服务退出后的重启策略
+type RestartPolicy int
+
+const (
+	// RestartNever 服务退出后不再重启
+	RestartNever RestartPolicy = iota
+	// RestartAlways 服务退出后总是重启
+	RestartAlways
+	// RestartOnFailure 服务返回错误退出时重启
+	RestartOnFailure
+)
+
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartAlways:
+		return "always"
+	case RestartOnFailure:
+		return "on-failure"
+	}
+
+	return "never"
+}
+
+// Supervision 服务监管配置
+type Supervision struct {
+	// Policy 重启策略
+	Policy RestartPolicy
+	// MaxRestarts 最大重启次数，为 0 时不限制
+	MaxRestarts int
+	// InitialBackoff 第一次重启前的等待时间，之后每次重启等待时间翻倍，默认为 1s
+	InitialBackoff time.Duration
+	// MaxBackoff 重启前等待时间的上限，默认为 1m
+	MaxBackoff time.Duration
+	// Critical 关键服务，服务因为错误（包括 panic）彻底停止（不再重启）时触发应用停机，Start 返回 nil 时不会触发停机
+	Critical bool
+}
+
+// Supervisable is an interface for service which should be supervised by framework
+type Supervisable interface {
+	Supervision() Supervision
+}
+
+// PanicPolicy 模块（DaemonProvider 的 Daemon 方法、Service 的 Start 方法）发生 panic 后的处理策略
+type PanicPolicy int
+
+const (
+	// PanicPolicyShutdown 触发应用停机，默认策略
+	PanicPolicyShutdown PanicPolicy = iota
+	// PanicPolicyRestart 重新启动该模块
+	PanicPolicyRestart
+	// PanicPolicyIgnore 忽略，该模块停止运行，应用继续运行
+	PanicPolicyIgnore
+)
+
+func (p PanicPolicy) String() string {
+	switch p {
+	case PanicPolicyRestart:
+		return "restart"
+	case PanicPolicyIgnore:
+		return "ignore"
+	}
+
+	return "shutdown"
+}
+
+// PanicPolicyAware 实现该接口的 Provider/Service 可以指定自己发生 panic 后的处理策略
+type PanicPolicyAware interface {
+	PanicPolicy() PanicPolicy
+}
+
+// PanicInfo 模块 panic 信息
+type PanicInfo struct {
+	// Module 模块名称
+	Module string
+	// Err panic 的值
+	Err interface{}
+	// Stack panic 时的调用栈
+	Stack []byte
+	// Policy 该模块的 panic 处理策略
+	Policy PanicPolicy
+}
+
+// PanicHandler 模块 panic 时的回调，可以用于上报错误
+type PanicHandler func(info PanicInfo)
+
+// ModuleManager 运行时模块管理，用于在应用启动后挂载和卸载模块
+// 每个挂载的模块拥有独立的子容器和可取消的 context，模块中注册的绑定只在子容器中可见，
+// 模块通过 Graceful 注册的停机 handler 会在模块卸载时执行，模块内调用 Graceful.Shutdown 只会卸载模块自身
+type ModuleManager interface {
+	// Attach 挂载一组 Provider/Service，name 为模块名称，同名模块只能挂载一次，应用开始停机之后不能再挂载模块
+	Attach(name string, modules ...interface{}) error
+	// Detach 卸载模块，停止模块的 Daemon 和 Service 并执行模块注册的停机 handler，ctx 用于控制等待模块退出的时间，
+	// ctx 结束时直接返回错误，不再等待停机 handler 执行完毕
+	Detach(ctx context.Context, name string) error
+	// Modules 返回所有已经挂载的模块名称
+	Modules() []string
+}
+
+// ScopeKind 作用域类型
+type ScopeKind string
+
+const (
+	// ScopeHTTP 每个 HTTP 请求一个作用域
+	ScopeHTTP ScopeKind = "http"
+	// ScopeCron 定时任务每次执行一个作用域
+	ScopeCron ScopeKind = "cron"
+	// ScopeEvent 每次事件分发（每个监听器）一个作用域
+	ScopeEvent ScopeKind = "event"
+	// ScopeAsync 异步任务每次执行一个作用域
+	ScopeAsync ScopeKind = "async"
+)
+
+// Scope 一次操作（HTTP 请求、定时任务执行、事件分发、异步任务）对应的依赖注入作用域
+// 作用域绑定在同一个作用域中只会创建一次，作用域结束时，实现了 Close() 或 Close() error 方法的对象按照创建顺序的逆序释放
+type Scope interface {
+	Container
+	// Kind 作用域类型
+	Kind() ScopeKind
+	// Context 创建作用域时传入的 context，作用域绑定的初始化函数可以依赖 Scope 获取
+	Context() context.Context
+	// Close 结束作用域，释放作用域中创建的对象，重复调用无效
+	Close() error
+}
+
+// ScopeFactory 管理作用域绑定，用于创建作用域
+type ScopeFactory interface {
+	// Scoped 添加作用域绑定，参数与 Singleton 一致，只对之后创建的作用域生效
+	Scoped(initializers ...interface{})
+	// HasScoped 是否添加了作用域绑定，没有作用域绑定时 HTTP 请求不会创建作用域
+	HasScoped() bool
+	// NewScope 创建一个作用域，parent 为作用域的父容器，为 nil 时使用全局容器
+	NewScope(ctx context.Context, kind ScopeKind, parent Container) Scope
+}
+
+// OpenScope 使用 resolver 中绑定的 ScopeFactory 创建作用域，resolver 作为作用域的父容器
+// resolver 中没有绑定 ScopeFactory 时返回 nil，比如单独使用 web、scheduler、event 包时
+func OpenScope(ctx context.Context, resolver Resolver, kind ScopeKind) Scope {
+	factory, err := resolver.Get(new(ScopeFactory))
+	if err != nil {
+		return nil
+	}
+
+	parent, _ := resolver.(Container)
+	return factory.(ScopeFactory).NewScope(ctx, kind, parent)
+}
+
+// BindingLifetime 容器绑定的生命周期
+type BindingLifetime string
+
+const (
+	BindingSingleton BindingLifetime = "singleton"
+	BindingPrototype BindingLifetime = "prototype"
+	BindingValue     BindingLifetime = "value"
+	// BindingExport ScopedProvider 导出到全局容器的绑定，生命周期由子容器中的绑定决定
+	BindingExport BindingLifetime = "export"
+	// BindingScoped 作用域绑定，在每个作用域中只会创建一次
+	BindingScoped BindingLifetime = "scoped"
+)
+
+// BindingConflictPolicy 不同模块绑定同一个 key 时的处理策略
+type BindingConflictPolicy int
+
+const (
+	// BindingConflictWarn 输出告警日志，后绑定的覆盖先绑定的，默认策略
+	BindingConflictWarn BindingConflictPolicy = iota
+	// BindingConflictFail 绑定失败
+	BindingConflictFail
+	// BindingConflictIgnore 忽略冲突
+	BindingConflictIgnore
+)
+
+func (p BindingConflictPolicy) String() string {
+	switch p {
+	case BindingConflictFail:
+		return "fail"
+	case BindingConflictIgnore:
+		return "ignore"
+	}
+
+	return "warn"
+}
+
+// BindingInfo 容器中一个绑定的信息
+type BindingInfo struct {
+	Key      string          `json:"key"`
+	Lifetime BindingLifetime `json:"lifetime"`
+	// Module 绑定来源，glacier 表示框架内置的绑定，app 表示通过 Glacier.Singleton/Prototype/PreBind 添加的绑定，其它为模块名称
+	Module string `json:"module"`
+	// Scope 绑定所在的容器，为空表示全局容器，ScopedProvider 的子容器为其名称，运行时挂载的模块为 module:<模块名称>，
+	// 模块中 ScopedProvider 的子容器为 module:<模块名称>/<ScopedProvider 名称>
+	Scope string `json:"scope,omitempty"`
+	// Resolved 对象是否已经被创建过，条件绑定（WithCondition）无法追踪，总是为 false
+	Resolved bool `json:"resolved"`
+	// Overrides 被该绑定覆盖的模块
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+// HealthChecker 健康检查接口，Provider 和 Service 实现该接口后会自动注册到健康检查中心
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// StartupStepKind 启动步骤类型
+type StartupStepKind string
+
+const (
+	StartupStepShouldLoad StartupStepKind = "ShouldLoad"
+	StartupStepRegister   StartupStepKind = "Register"
+	StartupStepBoot       StartupStepKind = "Boot"
+	StartupStepInit       StartupStepKind = "Init"
+)
+
+// StartupStep 模块在启动过程中某一个步骤的耗时
+type StartupStep struct {
+	// Module 模块名称
+	Module string
+	// Step 步骤类型
+	Step StartupStepKind
+	// Duration 步骤耗时
+	Duration time.Duration
+	// Slow 耗时是否超过了慢模块阈值
+	Slow bool
+}
+
+// StartupReport 应用启动耗时报告
+type StartupReport struct {
+	// Steps 按照执行顺序排列的所有模块启动步骤
+	Steps []StartupStep
+	// Took 从创建应用到应用就绪的总耗时，应用尚未就绪时为 0
+	Took time.Duration
+}
+
+// Slowest 返回耗时最长的 n 个步骤，n <= 0 时返回全部步骤
+func (r StartupReport) Slowest(n int) []StartupStep {
+	steps := append([]StartupStep{}, r.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Duration > steps[j].Duration })
+
+	if n > 0 && n < len(steps) {
+		return steps[:n]
+	}
+
+	return steps
+}
+
+const (
+	ProfileDev  = "dev"
+	ProfileTest = "test"
+	ProfileProd = "prod"
+)
+
+// Profile 当前激活的运行环境，比如 dev/test/prod，为空表示没有指定运行环境
+type Profile string
+
+func (p Profile) String() string {
+	return string(p)
+}
+
+// Is 判断当前环境是否为 profiles 中的任意一个
+func (p Profile) Is(profiles ...string) bool {
+	for _, profile := range profiles {
+		if string(p) == profile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProfileModule 实现该接口的 Provider/Service 只会在指定的运行环境中加载
+type ProfileModule interface {
+	Profiles() []string
+}
+
+// ProfileFlagContext 框架传递给 Init 钩子以及绑定到容器中的 FlagContext 都实现了该接口，可以获取当前的运行环境
+type ProfileFlagContext interface {
+	FlagContext
+	Profile() Profile
+}
+
+// ActiveProfile 返回 FlagContext 中的当前运行环境，flagCtx 没有实现 ProfileFlagContext 时返回空
+func ActiveProfile(flagCtx FlagContext) Profile {
+	if pc, ok := flagCtx.(ProfileFlagContext); ok {
+		return pc.Profile()
+	}
+
+	return ""
+}
+
+// ProfileRegistrar 注册只在指定运行环境中加载的 Provider/Service
+type ProfileRegistrar interface {
+	Provider(providers ...Provider)
+	Service(services ...Service)
+}
+
 // Nameable is an interface for service/provider name
 type Nameable interface {
 	Name() string
@@ -82,6 +437,22 @@ type Priority interface {
 	Priority() int
 }
 
+// ProviderDependency Provider 依赖声明接口
+// 实现该接口后，DependsOn 返回的 Provider 会先于当前 Provider 加载，依赖关系之外的顺序仍由 Priority 决定
+type ProviderDependency interface {
+	DependsOn() []Provider
+}
+
+// ServiceDependency Service 依赖声明接口
+// 实现该接口后，DependsOn 返回的 Service 会先于当前 Service 初始化（Init）和启动，并且晚于当前 Service 停止
+//
+// Init 按照依赖顺序同步执行，被依赖的 Service 的 Init 总是在当前 Service 的 Init 之前完成；
+// Start 在独立的 goroutine 中执行，依赖关系只保证 Start 的调用顺序，不保证被依赖的 Service 在当前 Service 的 Start
+// 被调用前已经就绪，如果需要等待依赖就绪，应当在 Init 中完成依赖的准备工作
+type ServiceDependency interface {
+	DependsOn() []Service
+}
+
 type ProviderBoot interface {
 	// Boot starts the module
 	// this method is called one by one synchronous after all register methods called
@@ -96,11 +467,26 @@ type DaemonProvider interface {
 	Daemon(ctx context.Context, resolver Resolver)
 }
 
+// ScopedProvider 实现该接口的 Provider 会在独立的子容器中注册，Register、Boot、Daemon 方法接收的都是该子容器
+// 子容器中的绑定对其它模块不可见，只有 Exports 中声明的类型会被发布到全局容器
+type ScopedProvider interface {
+	Provider
+	// Exports 返回需要导出的类型，接口类型使用 (*Interface)(nil) 的形式，其它类型使用该类型的零值，比如 (*Struct)(nil)
+	Exports() []interface{}
+}
+
 // ProviderAggregate Provider 聚合，所有实现该接口的 Provider 在加载之前将会先加载该集合中的 Provider
 type ProviderAggregate interface {
 	Aggregates() []Provider
 }
 
+// HookAggregate 实现该接口的 Provider（包括 ProviderAggregate 聚合的 Provider）可以为应用添加钩子
+// Init、PreBind 钩子在调用 Glacier.Provider 时收集，执行时模块尚未加载，因此不受 ShouldLoad 的影响；
+// BeforeServerStop 钩子在 Provider 过滤之后收集，只有实际加载的 Provider 提供的钩子才会执行
+type HookAggregate interface {
+	Hooks() Hooks
+}
+
 type ListenerBuilder interface {
 	Build(resolver Resolver) (net.Listener, error)
 }
@@ -131,6 +517,157 @@ type Logger interface {
 	Criticalf(format string, v ...interface{})
 }
 
+// AsyncJobStatus 异步任务状态
+type AsyncJobStatus int
+
+const (
+	AsyncJobPending AsyncJobStatus = iota
+	AsyncJobRunning
+	AsyncJobSucceeded
+	AsyncJobFailed
+	AsyncJobRejected
+)
+
+func (s AsyncJobStatus) String() string {
+	switch s {
+	case AsyncJobRunning:
+		return "running"
+	case AsyncJobSucceeded:
+		return "succeeded"
+	case AsyncJobFailed:
+		return "failed"
+	case AsyncJobRejected:
+		return "rejected"
+	}
+
+	return "pending"
+}
+
+// AsyncJob 异步任务句柄，用于获取异步任务的执行状态和结果
+type AsyncJob interface {
+	// Name 任务名称
+	Name() string
+	// Status 任务当前状态
+	Status() AsyncJobStatus
+	// Done 任务结束（成功、失败或者被拒绝）后关闭
+	Done() <-chan struct{}
+	// Err 任务执行结果，任务未结束时返回 nil
+	Err() error
+	// Wait 等待任务结束并返回执行结果，ctx 结束时返回 ctx.Err()
+	Wait(ctx context.Context) error
+}
+
+// AsyncJobOptions 异步任务配置
+type AsyncJobOptions struct {
+	// Name 任务名称，默认为任务函数名
+	Name string
+	// Timeout 单次执行的超时时间，任务函数可以通过注入 context.Context 感知超时，执行结果以任务函数的返回值为准
+	Timeout time.Duration
+	// MaxRetries 失败后的最大重试次数
+	MaxRetries int
+	// RetryBackoff 第一次重试前的等待时间，之后每次重试等待时间翻倍
+	RetryBackoff time.Duration
+}
+
+// AsyncOption 异步任务配置项
+type AsyncOption func(opts *AsyncJobOptions)
+
+// HookOptions Init、PreBind、BeforeServerStop 钩子配置
+type HookOptions struct {
+	// Name 钩子名称，默认为钩子函数名，钩子执行失败时用于定位问题
+	Name string
+	// Priority 钩子优先级，值越小越先执行，优先级相同时按照添加顺序执行，默认为 0
+	Priority int
+}
+
+// HookOption 钩子配置项
+type HookOption func(opts *HookOptions)
+
+// InitHook 初始化钩子，在 Glacier 初始化之前执行
+type InitHook struct {
+	Name     string
+	Priority int
+	Fn       func(fc FlagContext) error
+}
+
+// PreBindHook 预绑定钩子，在容器中第一次进行对象实例化之前执行
+type PreBindHook struct {
+	Name     string
+	Priority int
+	Fn       func(binder Binder)
+}
+
+// BeforeServerStopHook 服务停止前执行的钩子
+type BeforeServerStopHook struct {
+	Name     string
+	Priority int
+	Fn       func(resolver Resolver) error
+}
+
+// Hooks 模块提供的钩子集合
+type Hooks struct {
+	Init             []InitHook
+	PreBind          []PreBindHook
+	BeforeServerStop []BeforeServerStopHook
+}
+
+// ReadyHookPolicy OnServerReady 钩子最终执行失败时的处理策略
+type ReadyHookPolicy int
+
+const (
+	// ReadyHookLog 输出错误日志，默认策略
+	ReadyHookLog ReadyHookPolicy = iota
+	// ReadyHookRetry 按照 MaxRetries 和 RetryBackoff 重试，重试之后仍然失败时输出错误日志
+	ReadyHookRetry
+	// ReadyHookAbort 停止应用，该策略的钩子总是 Required
+	ReadyHookAbort
+)
+
+func (p ReadyHookPolicy) String() string {
+	switch p {
+	case ReadyHookRetry:
+		return "retry"
+	case ReadyHookAbort:
+		return "abort"
+	}
+
+	return "log"
+}
+
+// ReadyHookOptions OnServerReady 钩子配置
+type ReadyHookOptions struct {
+	// Name 钩子名称，默认为钩子函数名
+	Name string
+	// Group 钩子分组，同一个分组中的钩子按照添加顺序依次执行，前一个钩子失败时后续钩子不再执行，
+	// 不同分组以及没有分组的钩子之间并发执行
+	Group string
+	// Timeout 单次执行的超时时间，钩子函数可以通过注入 context.Context 感知超时
+	Timeout time.Duration
+	// Policy 钩子最终执行失败时的处理策略
+	Policy ReadyHookPolicy
+	// MaxRetries 失败后的最大重试次数
+	MaxRetries int
+	// RetryBackoff 第一次重试前的等待时间，之后每次重试等待时间翻倍
+	RetryBackoff time.Duration
+	// Required 应用只有在所有 Required 钩子都执行成功之后才会标记为就绪
+	Required bool
+}
+
+// ReadyHookOption OnServerReady 钩子配置项
+type ReadyHookOption func(opts *ReadyHookOptions)
+
+// AsyncOverflowPolicy 异步任务队列已满时的处理策略
+type AsyncOverflowPolicy int
+
+const (
+	// AsyncOverflowBlock 阻塞等待队列有空闲位置
+	AsyncOverflowBlock AsyncOverflowPolicy = iota
+	// AsyncOverflowReject 直接拒绝新提交的任务
+	AsyncOverflowReject
+	// AsyncOverflowDropOldest 丢弃队列中最早的任务，只能用于容量大于 0 的队列
+	AsyncOverflowDropOldest
+)
+
 type Glacier interface {
 	SetLogger(logger Logger) Glacier
 
@@ -142,25 +679,66 @@ type Glacier interface {
 	Provider(providers ...Provider)
 	// Service 注册一个 Service
 	Service(services ...Service)
-	// Async 注册一个异步任务
+	// Async 注册异步任务，应用启动前提交的任务会在启动后执行，停机开始后提交的任务会被拒绝
 	Async(asyncJobs ...interface{})
+	// AsyncJob 提交一个异步任务，返回任务句柄，用于设置任务的超时、重试，以及获取任务的执行结果
+	AsyncJob(fn interface{}, options ...AsyncOption) AsyncJob
+	// WithAsyncQueue 设置异步任务队列容量以及队列已满时的处理策略
+	WithAsyncQueue(size int, policy AsyncOverflowPolicy) Glacier
 
 	// Graceful 设置优雅停机实现
 	Graceful(builder func() Graceful) Glacier
+	// WithShutdownPhaseTimeout 设置停机阶段的超时时间，Graceful 实现了 ShutdownPhaseTimeoutAware 接口时生效
+	WithShutdownPhaseTimeout(phase ShutdownPhase, timeout time.Duration) Glacier
+	// WithProfile 设置当前运行环境的来源，依次从命令行选项 flagName、环境变量 envName 中读取，都没有指定时使用 defaultProfile
+	WithProfile(flagName string, envName string, defaultProfile string) Glacier
+	// ForProfiles 返回用于注册只在指定运行环境中加载的 Provider/Service 的注册器
+	ForProfiles(profiles ...string) ProfileRegistrar
+	// WithClock 设置框架使用的时间源，定时任务触发、停机超时、启动耗时统计等都会使用它，一般用于测试
+	WithClock(clock Clock) Glacier
+	// WithPanicHandler 设置模块 panic 时的回调
+	WithPanicHandler(handler PanicHandler) Glacier
+	// WithStartupReport 设置是否在应用就绪后输出启动耗时报告，以及单个模块步骤的慢启动告警阈值（0 表示不告警）
+	WithStartupReport(print bool, slowThreshold time.Duration) Glacier
+	// StartupReport 返回应用启动耗时报告
+	StartupReport() StartupReport
+	// BootPlan 在不启动应用的情况下计算应用的启动计划，不能与 Start 同时使用
+	// Init、PreBind 钩子以及模块的 ShouldLoad 方法会被执行，用于确定各模块是否加载
+	BootPlan(cliCtx FlagContext) (BootPlan, error)
+	// WithBindingConflictPolicy 设置不同模块绑定同一个 key 时的处理策略
+	WithBindingConflictPolicy(policy BindingConflictPolicy) Glacier
+	// Bindings 返回容器中所有记录的绑定，按照绑定顺序排列
+	Bindings() []BindingInfo
+	// Validate 校验容器绑定关系是否完整，一次性返回所有缺失的绑定，并在一次性容器中注册所有的 Provider、Service，不会启动应用，不能与 Start 同时使用
+	Validate(cliCtx FlagContext) error
 
 	// OnServerReady call a function a server ready
 	OnServerReady(ffs ...interface{})
+	// OnServerReadyHook 添加一个可以配置分组、超时、失败处理策略的 OnServerReady 钩子
+	OnServerReadyHook(fn interface{}, options ...ReadyHookOption)
+	// OnLifecycleEvent 订阅框架生命周期事件，listener 形式为 func(evt lifecycle.XXX)
+	OnLifecycleEvent(listeners ...interface{})
 
 	// Start 应用入口
 	Start(cliCtx FlagContext) error
-	// Init Glacier 初始化之前执行，一般用于设置一些基本配置，比如日志等
-	Init(f func(fc FlagContext) error) Glacier
-	// BeforeServerStop 服务停止前的回调
-	BeforeServerStop(f func(resolver Resolver) error) Glacier
-	PreBind(fn func(binder Binder)) Glacier
+	// Run 以非阻塞的方式启动应用，返回应用句柄，ctx 被取消时触发优雅停机
+	Run(ctx context.Context, cliCtx FlagContext) Application
+	// StartAsync 以非阻塞的方式启动应用，等同于 Run(context.Background(), cliCtx)
+	StartAsync(cliCtx FlagContext) Application
+	// Exec 以命令模式执行 handler，只注册和启动 Provider，不启动 Daemon、Service，handler 执行完毕后执行 Graceful 的停机阶段，返回命令的退出码
+	Exec(cliCtx FlagContext, handler interface{}) (int, error)
+	// Init Glacier 初始化之前执行，一般用于设置一些基本配置，比如日志等，多次调用会按照优先级依次执行
+	Init(f func(fc FlagContext) error, options ...HookOption) Glacier
+	// BeforeServerStop 服务停止前的回调，多次调用会按照优先级依次执行
+	BeforeServerStop(f func(resolver Resolver) error, options ...HookOption) Glacier
+	// PreBind 预绑定钩子，多次调用会按照优先级依次执行
+	PreBind(fn func(binder Binder), options ...HookOption) Glacier
 
 	Singleton(ins ...interface{}) Glacier
 	Prototype(ins ...interface{}) Glacier
+	// Scoped 添加作用域绑定，每个 HTTP 请求、定时任务执行、事件分发、异步任务都会创建独立的作用域，
+	// 作用域绑定在同一个作用域中只会创建一次，作用域结束时实现了 Close 方法的对象会被释放
+	Scoped(ins ...interface{}) Glacier
 	Resolve(resolver interface{}) error
 	MustResolve(resolver interface{})
 	Container() Container
@@ -172,13 +750,60 @@ type Container ioc.Container
 type Binder ioc.Binder
 type Resolver ioc.Resolver
 
+// Application 通过 Run/StartAsync 以非阻塞方式启动的应用句柄，用于嵌入到其它程序或者测试中
+type Application interface {
+	// Ready 应用就绪（所有 Required 的 OnServerReady 钩子执行成功）后关闭，启动失败时不会关闭
+	Ready() <-chan struct{}
+	// Done 应用退出（启动失败或者停机完成）后关闭
+	Done() <-chan struct{}
+	// Stop 触发优雅停机并等待应用退出，ctx 用于控制等待的时间
+	Stop(ctx context.Context) error
+	// Wait 等待应用退出，返回启动失败或者停机时的错误，ReadyHookAbort 策略的钩子执行失败导致停机时返回该钩子的错误
+	Wait() error
+	// Resolver 返回应用的容器，会等待容器创建完成，容器创建之前应用就已经退出时返回 nil
+	Resolver() Resolver
+}
+
 type Hook interface {
 	// OnServerReady call a function a server ready
 	OnServerReady(ffs ...interface{})
 }
 
+// ReadyHookAware 实现该接口的 Hook 支持添加可以配置分组、超时、失败处理策略的 OnServerReady 钩子
+type ReadyHookAware interface {
+	OnServerReadyHook(fn interface{}, options ...ReadyHookOption)
+}
+
+// OnServerReadyHook 添加一个可以配置分组、超时、失败处理策略的 OnServerReady 钩子，hook 没有实现 ReadyHookAware 接口时等同于 OnServerReady，options 被忽略
+func OnServerReadyHook(hook Hook, fn interface{}, options ...ReadyHookOption) {
+	if ra, ok := hook.(ReadyHookAware); ok {
+		ra.OnServerReadyHook(fn, options...)
+		return
+	}
+
+	hook.OnServerReady(fn)
+}
+
+// WithCondition 创建条件绑定，onCondition 返回 true 时才会绑定 init
 func WithCondition(init interface{}, onCondition interface{}) ioc.Conditional {
-	return ioc.WithCondition(init, onCondition)
+	return conditional{Conditional: ioc.WithCondition(init, onCondition), init: init, onCondition: onCondition}
+}
+
+// conditional 包装 ioc.Conditional，保留条件绑定的初始化函数和条件函数，用于推导绑定的 key 以及判断是否绑定成功
+type conditional struct {
+	ioc.Conditional
+	init        interface{}
+	onCondition interface{}
+}
+
+// Initializer 返回条件绑定的初始化函数
+func (c conditional) Initializer() interface{} {
+	return c.init
+}
+
+// Condition 返回条件绑定的条件函数
+func (c conditional) Condition() interface{} {
+	return c.onCondition
 }
 
 // Autowire Automatically inject dependencies into obj and return obj for convenient chaining.
@@ -0,0 +1,159 @@
+package infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BootPlanModuleKind 启动计划中的模块类型
+type BootPlanModuleKind string
+
+const (
+	BootPlanProvider BootPlanModuleKind = "provider"
+	BootPlanService  BootPlanModuleKind = "service"
+)
+
+// BootPlanModule 启动计划中的模块
+type BootPlanModule struct {
+	Name string             `json:"name"`
+	Kind BootPlanModuleKind `json:"kind"`
+	// Priority 模块优先级，未实现 Priority 接口的模块为默认值 1000
+	Priority int `json:"priority"`
+	// Level 模块在依赖关系中所处的层级，没有依赖的模块层级为 0
+	Level int `json:"level"`
+	// AggregatedBy 通过 ProviderAggregate 引入该模块的 Provider 名称
+	AggregatedBy string   `json:"aggregated_by,omitempty"`
+	DependsOn    []string `json:"depends_on,omitempty"`
+	// Capabilities 模块实现的可选接口，比如 Boot、Daemon、Init、Stop、Reload、Health
+	Capabilities []string `json:"capabilities,omitempty"`
+	// SkipReason 模块不会被加载的原因，为空表示模块会被加载
+	SkipReason string `json:"skip_reason,omitempty"`
+}
+
+// BootPlanStep 启动计划中的一个执行步骤
+type BootPlanStep struct {
+	ID    string `json:"id"`
+	Stage string `json:"stage"`
+	Name  string `json:"name"`
+	// Module 该步骤所属的模块名称，框架自身的步骤为空
+	Module string `json:"module,omitempty"`
+	// Async 是否在独立的 Goroutine 中执行，后续步骤不会等待异步步骤完成
+	Async bool `json:"async"`
+	// After 该步骤开始前必须已经开始执行的步骤 ID
+	After []string `json:"after,omitempty"`
+}
+
+// BootPlan 应用启动计划，在不启动应用的情况下计算得出，输出顺序与实际执行顺序一致
+type BootPlan struct {
+	// Modules 按照加载顺序排列的模块，先 Provider 后 Service，同类模块中未加载的模块排在最后
+	Modules []BootPlanModule `json:"modules"`
+	Steps   []BootPlanStep   `json:"steps"`
+}
+
+// stages 按照首次出现的顺序返回所有阶段及其包含的步骤
+func (plan BootPlan) stages() ([]string, map[string][]BootPlanStep) {
+	names := make([]string, 0)
+	stages := make(map[string][]BootPlanStep)
+	for _, step := range plan.Steps {
+		if _, ok := stages[step.Stage]; !ok {
+			names = append(names, step.Stage)
+		}
+
+		stages[step.Stage] = append(stages[step.Stage], step)
+	}
+
+	return names, stages
+}
+
+// DOT 以 Graphviz DOT 格式输出启动计划
+func (plan BootPlan) DOT() string {
+	var buf strings.Builder
+	buf.WriteString("digraph G {\n    node [shape = \"box\" style = \"filled,rounded\" fillcolor = \"gold\"]\n")
+
+	names, stages := plan.stages()
+	for i, name := range names {
+		fmt.Fprintf(&buf, "    subgraph cluster_%d {\n        label = %s\n        style = \"rounded,dashed,filled\"\n        color = \"deepskyblue\"\n        fillcolor = \"aliceblue\"\n", i, dotQuote(name))
+		for _, step := range stages[name] {
+			style := ""
+			if step.Module != "" {
+				style = " fillcolor = \"chartreuse\""
+			}
+
+			fmt.Fprintf(&buf, "        %s [label = %s%s]\n", step.ID, dotQuote(step.Name), style)
+		}
+		buf.WriteString("    }\n")
+	}
+
+	for _, step := range plan.Steps {
+		for _, after := range step.After {
+			if step.Async {
+				fmt.Fprintf(&buf, "    %s -> %s [style = \"dashed\"];\n", after, step.ID)
+			} else {
+				fmt.Fprintf(&buf, "    %s -> %s;\n", after, step.ID)
+			}
+		}
+	}
+
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// Mermaid 以 Mermaid flowchart 格式输出启动计划
+func (plan BootPlan) Mermaid() string {
+	var buf strings.Builder
+	buf.WriteString("flowchart TD\n")
+
+	names, stages := plan.stages()
+	for i, name := range names {
+		fmt.Fprintf(&buf, "    subgraph stage_%d [%s]\n", i, mermaidQuote(name))
+		for _, step := range stages[name] {
+			fmt.Fprintf(&buf, "        %s[%s]\n", step.ID, mermaidQuote(step.Name))
+		}
+		buf.WriteString("    end\n")
+	}
+
+	for _, step := range plan.Steps {
+		for _, after := range step.After {
+			if step.Async {
+				fmt.Fprintf(&buf, "    %s -.-> %s\n", after, step.ID)
+			} else {
+				fmt.Fprintf(&buf, "    %s --> %s\n", after, step.ID)
+			}
+		}
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// JSON 以 JSON 格式输出启动计划
+func (plan BootPlan) JSON() (string, error) {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Export 按照指定格式（dot/mermaid/json）输出启动计划
+func (plan BootPlan) Export(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "dot":
+		return plan.DOT(), nil
+	case "mermaid":
+		return plan.Mermaid(), nil
+	case "json":
+		return plan.JSON()
+	default:
+		return "", fmt.Errorf("unsupported boot plan format: %s", format)
+	}
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,38 @@
+package glacier
+
+import (
+	"github.com/mylxsw/glacier/event"
+	"github.com/mylxsw/glacier/lifecycle"
+	"github.com/mylxsw/glacier/log"
+)
+
+// newLifecycleManager 创建生命周期事件管理器，事件同步分发，监听函数在框架执行流程中直接调用
+func newLifecycleManager() event.Manager {
+	return event.NewEventManager(event.NewMemoryEventStore(false, 0))
+}
+
+// OnLifecycleEvent 订阅框架生命周期事件，listener 形式为 func(evt lifecycle.XXX)
+func (impl *framework) OnLifecycleEvent(listeners ...interface{}) {
+	impl.lifecycle.Listen(listeners...)
+}
+
+// publishLifecycleEvent 发布生命周期事件，监听函数的 panic 不会影响框架的执行流程
+func (impl *framework) publishLifecycleEvent(evt interface{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("[glacier] lifecycle listener for %T failed: %v", evt, err)
+		}
+	}()
+
+	_ = impl.lifecycle.Publish(evt)
+}
+
+// lifecycleStage 发布阶段开始事件，返回的函数用于发布阶段结束事件
+func (impl *framework) lifecycleStage(stage string) func() {
+	startTs := impl.clock.Now()
+	impl.publishLifecycleEvent(lifecycle.StageStarted{Stage: stage, Time: startTs})
+
+	return func() {
+		impl.publishLifecycleEvent(lifecycle.StageFinished{Stage: stage, Time: impl.clock.Now(), Duration: impl.clock.Since(startTs)})
+	}
+}
@@ -0,0 +1,115 @@
+// Package lifecycle 定义了 Glacier 框架生命周期事件
+//
+// 生命周期事件与 DEBUG 模式无关，总是会被发布，订阅方式与 event 包一致，监听函数的参数为具体的事件类型
+//
+//	ins.OnLifecycleEvent(func(evt lifecycle.ProviderBooted) {
+//		metrics.Observe("provider_boot", evt.Name, evt.Duration)
+//	})
+package lifecycle
+
+import "time"
+
+// Listener 生命周期事件订阅
+type Listener interface {
+	Listen(listeners ...interface{})
+}
+
+const (
+	StageInit     = "initStage"
+	StageDIBind   = "diBindStage"
+	StageBoot     = "bootStage"
+	StageReady    = "readyStage"
+	StageShutdown = "shutdownStage"
+)
+
+// StageStarted 框架某个阶段开始执行
+type StageStarted struct {
+	Stage string
+	Time  time.Time
+}
+
+// StageFinished 框架某个阶段执行完毕
+type StageFinished struct {
+	Stage    string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ProviderRegistered Provider 的 Register 方法执行完毕
+type ProviderRegistered struct {
+	Name     string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ProviderBooted Provider 的 Boot 方法执行完毕
+type ProviderBooted struct {
+	Name     string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// DaemonStarted DaemonProvider 的 Daemon 方法开始执行
+type DaemonStarted struct {
+	Name string
+	Time time.Time
+}
+
+// DaemonStopped DaemonProvider 的 Daemon 方法执行结束，Duration 为运行时长
+type DaemonStopped struct {
+	Name     string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ServiceInitialized Service 的 Init 方法执行完毕
+type ServiceInitialized struct {
+	Name     string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ServiceStarted Service 的 Start 方法开始执行，服务重启时会再次发布
+type ServiceStarted struct {
+	Name string
+	Time time.Time
+}
+
+// ServiceStopped Service 的 Start 方法执行结束，Duration 为运行时长，Err 为服务返回的错误
+type ServiceStopped struct {
+	Name     string
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// ModuleAttached 应用启动后通过 ModuleManager 挂载了一个模块，Duration 为挂载耗时
+type ModuleAttached struct {
+	Name     string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ModuleDetached 通过 ModuleManager 卸载了一个模块，Duration 为卸载耗时
+type ModuleDetached struct {
+	Name     string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ApplicationReady 应用启动完成，Duration 为从应用创建到启动完成的耗时
+type ApplicationReady struct {
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ShutdownStarted 应用开始停机
+type ShutdownStarted struct {
+	Time time.Time
+}
+
+// ShutdownFinished 应用停机完成，Duration 为停机耗时
+type ShutdownFinished struct {
+	Time     time.Time
+	Duration time.Duration
+}
@@ -0,0 +1,69 @@
+package glacier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
+)
+
+type lifecycleProvider struct{}
+
+func (lifecycleProvider) Register(binder infra.Binder) {}
+func (lifecycleProvider) Boot(resolver infra.Resolver) {}
+
+func TestLifecycleEvents(t *testing.T) {
+	var lock sync.Mutex
+	events := make([]string, 0)
+	record := func(format string, args ...interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		events = append(events, fmt.Sprintf(format, args...))
+	}
+
+	impl := New("1.0", 1).(*framework)
+	impl.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	impl.Provider(lifecycleProvider{})
+	impl.OnLifecycleEvent(
+		func(evt lifecycle.StageStarted) { record("%s started", evt.Stage) },
+		func(evt lifecycle.StageFinished) { record("%s finished", evt.Stage) },
+		func(evt lifecycle.ProviderRegistered) { record("provider registered") },
+		// 监听函数的 panic 不会影响框架的执行流程
+		func(evt lifecycle.ProviderBooted) { panic("listener failed") },
+		func(evt lifecycle.ApplicationReady) { record("application ready") },
+		func(evt lifecycle.ShutdownStarted) { record("shutdown started") },
+		func(evt lifecycle.ShutdownFinished) { record("shutdown finished") },
+	)
+
+	app := impl.StartAsync(NewFlagContext())
+	select {
+	case <-app.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("application is not ready")
+	}
+
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"initStage started", "initStage finished",
+		"diBindStage started", "diBindStage finished",
+		"bootStage started", "provider registered", "bootStage finished",
+		"readyStage started", "readyStage finished", "application ready",
+		"shutdown started", "shutdownStage started", "shutdownStage finished", "shutdown finished",
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("unexpected lifecycle events:\n%v\nexpected:\n%v", events, expected)
+	}
+}
@@ -0,0 +1,409 @@
+package glacier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/glacier/health"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
+	"github.com/mylxsw/glacier/log"
+	"github.com/mylxsw/go-ioc"
+)
+
+// moduleManager 运行时模块管理，应用停机时会自动卸载所有已挂载的模块
+type moduleManager struct {
+	impl *framework
+
+	// attachLock 保证模块依次挂载，lock 只用于保护 modules
+	attachLock sync.Mutex
+	lock       sync.Mutex
+	modules    map[string]*attachedModule
+	// closed 应用停机时设置为 true，之后不能再挂载模块，受 attachLock 保护
+	closed bool
+	// detachTimeout 应用停机时卸载所有模块的超时时间，0 表示不限制
+	detachTimeout time.Duration
+}
+
+func newModuleManager(impl *framework) *moduleManager {
+	return &moduleManager{impl: impl, modules: make(map[string]*attachedModule)}
+}
+
+// attachedModule 运行时挂载的模块
+type attachedModule struct {
+	name      string
+	cc        ioc.Container
+	gf        *moduleGraceful
+	providers []*providerEntry
+	services  []*serviceEntry
+	// healthChecks 模块注册的健康检查名称，模块卸载时移除
+	healthChecks []string
+	wg           sync.WaitGroup
+}
+
+// bindingScope 模块绑定记录使用的作用域
+func (mod *attachedModule) bindingScope() string {
+	return "module:" + mod.name
+}
+
+// Attach 挂载一组 Provider/Service，name 为模块名称，同名模块只能挂载一次
+func (m *moduleManager) Attach(name string, modules ...interface{}) (err error) {
+	if m.impl.currentStatus() != Started {
+		return fmt.Errorf("[glacier] module %s can only be attached after application started", name)
+	}
+
+	m.attachLock.Lock()
+	defer m.attachLock.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("[glacier] module %s can not be attached since application is shutting down", name)
+	}
+
+	m.lock.Lock()
+	_, exist := m.modules[name]
+	m.lock.Unlock()
+
+	if exist {
+		return fmt.Errorf("[glacier] module %s has already been attached", name)
+	}
+
+	var gf infra.Graceful
+	var parentCtx context.Context
+	m.impl.cc.MustResolve(func(g infra.Graceful, ctx context.Context) {
+		gf, parentCtx = g, ctx
+	})
+
+	startTs := m.impl.clock.Now()
+	ctx, cancel := context.WithCancel(parentCtx)
+	// 模块的 Daemon 和 Service 异常退出时只卸载模块自身，不会导致整个应用停机
+	mod := &attachedModule{name: name, cc: ioc.Extend(m.impl.cc), gf: newModuleGraceful(gf, func() { m.detachOnShutdown(name) })}
+	mod.gf.AddShutdownHandler(cancel)
+
+	// 挂载失败时，清理已经启动的部分
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("[glacier] attach module %s failed with a panic: %v", name, rec)
+		}
+
+		if err != nil {
+			_ = m.shutdownModule(context.Background(), mod)
+		}
+	}()
+
+	if err := mod.resolveEntries(modules); err != nil {
+		return err
+	}
+
+	mod.cc.MustSingletonOverride(func() infra.Resolver { return mod.cc })
+	mod.cc.MustSingletonOverride(func() infra.Binder { return mod.cc })
+	mod.cc.MustSingletonOverride(func() infra.Graceful { return mod.gf })
+	mod.cc.MustSingletonOverride(func() context.Context { return ctx })
+
+	if err := m.impl.startModule(ctx, mod); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	m.modules[name] = mod
+	m.lock.Unlock()
+
+	m.impl.publishLifecycleEvent(lifecycle.ModuleAttached{Name: name, Time: m.impl.clock.Now(), Duration: m.impl.clock.Since(startTs)})
+
+	if infra.DEBUG {
+		log.Debugf("[glacier] module %s attached, %d providers, %d services", name, len(mod.providers), len(mod.services))
+	}
+
+	return nil
+}
+
+// Detach 卸载模块，停止模块的 Daemon 和 Service 并执行模块注册的停机 handler
+func (m *moduleManager) Detach(ctx context.Context, name string) error {
+	m.lock.Lock()
+	mod, ok := m.modules[name]
+	delete(m.modules, name)
+	m.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("[glacier] module %s is not attached", name)
+	}
+
+	startTs := m.impl.clock.Now()
+	defer func() {
+		m.impl.publishLifecycleEvent(lifecycle.ModuleDetached{Name: name, Time: m.impl.clock.Now(), Duration: m.impl.clock.Since(startTs)})
+	}()
+
+	return m.shutdownModule(ctx, mod)
+}
+
+// detachOnShutdown 模块内调用 Graceful.Shutdown 时异步卸载模块，等待正在进行的挂载完成之后再执行
+func (m *moduleManager) detachOnShutdown(name string) {
+	go func() {
+		m.attachLock.Lock()
+		m.attachLock.Unlock()
+
+		m.lock.Lock()
+		_, ok := m.modules[name]
+		m.lock.Unlock()
+
+		// 模块挂载失败或者已经被卸载
+		if !ok {
+			return
+		}
+
+		log.Warningf("[glacier] module %s requested shutdown, detaching it", name)
+		if err := m.Detach(context.Background(), name); err != nil {
+			log.Errorf("[glacier] detach module %s failed: %v", name, err)
+		}
+	}()
+}
+
+// shutdownModule 停止模块，并移除模块注册的健康检查和绑定记录
+func (m *moduleManager) shutdownModule(ctx context.Context, mod *attachedModule) error {
+	err := mod.shutdown(ctx)
+
+	if len(mod.healthChecks) > 0 {
+		m.impl.cc.MustResolve(func(registry health.Registry) {
+			for _, name := range mod.healthChecks {
+				registry.Unregister(name)
+			}
+		})
+	}
+
+	m.impl.bindings.removeScope(mod.bindingScope())
+	return err
+}
+
+// Modules 返回所有已经挂载的模块名称
+func (m *moduleManager) Modules() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// setup 应用启动完成之前调用，注册应用停机时卸载所有模块以及重新加载时执行模块 reload handler 的回调
+// detachTimeout 为卸载所有模块的超时时间
+func (m *moduleManager) setup(gf infra.Graceful, detachTimeout time.Duration) {
+	m.detachTimeout = detachTimeout
+	gf.AddShutdownHandler(m.detachAll)
+	gf.AddReloadHandler(m.reloadAll)
+}
+
+// detachAll 应用停机时卸载所有模块，等待正在进行的挂载完成，之后不再接受新的挂载
+func (m *moduleManager) detachAll() {
+	m.attachLock.Lock()
+	defer m.attachLock.Unlock()
+
+	m.closed = true
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if m.detachTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, m.detachTimeout)
+	}
+	defer cancel()
+
+	for _, name := range m.Modules() {
+		if err := m.Detach(ctx, name); err != nil {
+			log.Errorf("[glacier] detach module %s failed: %v", name, err)
+		}
+	}
+}
+
+// reloadAll 应用重新加载时，执行所有模块注册的 reload handler
+func (m *moduleManager) reloadAll() {
+	m.lock.Lock()
+	modules := make([]*attachedModule, 0, len(m.modules))
+	for _, mod := range m.modules {
+		modules = append(modules, mod)
+	}
+	m.lock.Unlock()
+
+	for _, mod := range modules {
+		mod.gf.reload()
+	}
+}
+
+// resolveEntries 将挂载的对象区分为 Provider 和 Service，过滤和排序在 startModule 中执行
+func (mod *attachedModule) resolveEntries(modules []interface{}) error {
+	for _, module := range modules {
+		validateShouldLoadMethod(reflect.TypeOf(module))
+
+		switch m := module.(type) {
+		case infra.Provider:
+			p := newProviderEntry(m)
+			mod.providers = append(append(mod.providers, resolveProviderAggregate(p)...), p)
+		case infra.Service:
+			mod.services = append(mod.services, newServiceEntry(m))
+		default:
+			return fmt.Errorf("[glacier] module %s: %T is neither a provider nor a service", mod.name, module)
+		}
+	}
+
+	return nil
+}
+
+// shutdown 执行模块注册的停机 handler，并等待模块的 Daemon 和 Service 退出，ctx 结束时不再等待
+func (mod *attachedModule) shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		mod.gf.shutdown()
+		mod.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("[glacier] module %s detach timeout: %w", mod.name, ctx.Err())
+	}
+}
+
+// startModule 使用与 bootStage 相同的流程启动模块：过滤（ShouldLoad、Profile）并按照依赖关系排序、注册、初始化、
+// 启动 Daemon 和 Service，模块中所有的方法都使用模块自己的子容器，依赖应用启动时已经加载的模块视为依赖已经满足
+func (impl *framework) startModule(ctx context.Context, mod *attachedModule) error {
+	providers, _, err := impl.filterProviderEntries(mod.cc, mod.providers, impl.providers, false)
+	if err != nil {
+		return err
+	}
+
+	services, _, err := impl.filterServiceEntries(mod.cc, mod.services, impl.services, false)
+	if err != nil {
+		return err
+	}
+
+	mod.providers, mod.services = providers, services
+
+	if err := impl.registerProviderEntries(mod.cc, mod.bindingScope(), providers); err != nil {
+		return err
+	}
+
+	if err := impl.registerServiceEntries(mod.cc, services); err != nil {
+		return err
+	}
+
+	impl.cc.MustResolve(func(registry health.Registry) {
+		mod.healthChecks = impl.registerHealthCheckerEntries(registry, mod.bindingScope()+"/", providers, services)
+	})
+
+	if err := impl.initServiceEntries(mod.cc, services); err != nil {
+		return err
+	}
+
+	if err := impl.bootProviderEntries(providers); err != nil {
+		return err
+	}
+
+	if err := impl.startDaemonProviderEntries(ctx, mod.gf, providers, &mod.wg); err != nil {
+		return err
+	}
+
+	return impl.startServiceEntries(ctx, mod.gf, services, &mod.wg)
+}
+
+// moduleGraceful 模块内使用的 Graceful 实现，模块注册的 handler 只在模块卸载或者重新加载时执行
+// Reload 方法作用于整个应用，Shutdown 方法只卸载模块自身
+type moduleGraceful struct {
+	parent     infra.Graceful
+	onShutdown func()
+	once       sync.Once
+
+	lock                sync.Mutex
+	reloadHandlers      []func()
+	preShutdownHandlers []func()
+	shutdownHandlers    []moduleShutdownHandler
+}
+
+type moduleShutdownHandler struct {
+	phase infra.ShutdownPhase
+	h     func()
+}
+
+func newModuleGraceful(parent infra.Graceful, onShutdown func()) *moduleGraceful {
+	return &moduleGraceful{parent: parent, onShutdown: onShutdown}
+}
+
+func (gf *moduleGraceful) AddReloadHandler(h func()) {
+	gf.lock.Lock()
+	defer gf.lock.Unlock()
+
+	gf.reloadHandlers = append(gf.reloadHandlers, h)
+}
+
+func (gf *moduleGraceful) AddShutdownHandler(h func()) {
+	gf.AddShutdownHandlerInPhase(infra.ShutdownPhaseDrainWorkers, h)
+}
+
+func (gf *moduleGraceful) AddShutdownHandlerInPhase(phase infra.ShutdownPhase, h func()) {
+	gf.lock.Lock()
+	defer gf.lock.Unlock()
+
+	gf.shutdownHandlers = append(gf.shutdownHandlers, moduleShutdownHandler{phase: phase, h: h})
+}
+
+func (gf *moduleGraceful) AddPreShutdownHandler(h func()) {
+	gf.lock.Lock()
+	defer gf.lock.Unlock()
+
+	gf.preShutdownHandlers = append(gf.preShutdownHandlers, h)
+}
+
+func (gf *moduleGraceful) Reload() {
+	gf.parent.Reload()
+}
+
+func (gf *moduleGraceful) Shutdown() {
+	gf.once.Do(gf.onShutdown)
+}
+
+func (gf *moduleGraceful) Start() error {
+	return errors.New("[glacier] graceful of an attached module can not be started")
+}
+
+func (gf *moduleGraceful) reload() {
+	gf.lock.Lock()
+	handlers := append([]func(){}, gf.reloadHandlers...)
+	gf.lock.Unlock()
+
+	for _, h := range handlers {
+		runModuleHandler("reload", h)
+	}
+}
+
+// shutdown 先执行 pre-shutdown handler，再按照停机阶段的顺序依次执行 shutdown handler
+func (gf *moduleGraceful) shutdown() {
+	gf.lock.Lock()
+	preHandlers := append([]func(){}, gf.preShutdownHandlers...)
+	handlers := append([]moduleShutdownHandler{}, gf.shutdownHandlers...)
+	gf.lock.Unlock()
+
+	for _, h := range preHandlers {
+		runModuleHandler("pre-shutdown", h)
+	}
+
+	sort.SliceStable(handlers, func(i, j int) bool { return handlers[i].phase.Order < handlers[j].phase.Order })
+	for _, h := range handlers {
+		runModuleHandler("shutdown", h.h)
+	}
+}
+
+func runModuleHandler(kind string, h func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("[glacier] module %s handler failed: %v", kind, err)
+		}
+	}()
+
+	h()
+}
@@ -0,0 +1,190 @@
+package glacier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/health"
+	"github.com/mylxsw/glacier/infra"
+)
+
+type pluginConfig struct{ Tenant string }
+
+type pluginProvider struct {
+	stopped chan struct{}
+	closed  chan struct{}
+}
+
+func (p pluginProvider) Register(binder infra.Binder) {
+	binder.MustSingleton(func() *pluginConfig { return &pluginConfig{Tenant: "t1"} })
+}
+
+func (p pluginProvider) Boot(resolver infra.Resolver) {
+	resolver.MustResolve(func(gf infra.Graceful) {
+		gf.AddShutdownHandler(func() { close(p.closed) })
+	})
+}
+
+func (p pluginProvider) Daemon(ctx context.Context, resolver infra.Resolver) {
+	<-ctx.Done()
+	close(p.stopped)
+}
+
+func (p pluginProvider) Health(ctx context.Context) error { return nil }
+
+func (p pluginProvider) DependsOn() []infra.Provider {
+	return []infra.Provider{pluginDependencyProvider{}}
+}
+
+// pluginDependencyProvider 优先级低于 pluginProvider，但是被 pluginProvider 依赖，因此需要先注册
+type pluginDependencyProvider struct{ registered *bool }
+
+func (p pluginDependencyProvider) Register(binder infra.Binder) {
+	*p.registered = true
+}
+
+func (p pluginDependencyProvider) Priority() int { return 2000 }
+
+type pluginSkippedProvider struct{}
+
+func (pluginSkippedProvider) Register(binder infra.Binder) { panic("should not be registered") }
+
+func (pluginSkippedProvider) ShouldLoad(resolver infra.Resolver) bool { return false }
+
+func TestModuleManager(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	app := startAsyncTestApp(t, impl)
+	defer app.Stop(context.Background())
+
+	var registered bool
+	plugin := pluginProvider{stopped: make(chan struct{}), closed: make(chan struct{})}
+	if err := impl.modules.Attach("tenant-1", pluginSkippedProvider{}, plugin, pluginDependencyProvider{registered: &registered}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := impl.modules.Attach("tenant-1", plugin); err == nil {
+		t.Error("expect error when attaching a module twice")
+	}
+
+	if !registered {
+		t.Error("dependency of a module provider should be registered")
+	}
+
+	if impl.cc.HasBound(&pluginConfig{}) || len(impl.modules.Modules()) != 1 {
+		t.Error("bindings of an attached module should be private")
+	}
+
+	hasModuleBinding := func() bool {
+		for _, b := range impl.Bindings() {
+			if b.Scope == "module:tenant-1" {
+				return true
+			}
+		}
+		return false
+	}
+
+	var registry health.Registry
+	impl.cc.MustResolve(func(r health.Registry) { registry = r })
+
+	if !hasModuleBinding() || len(registry.Check(context.Background()).Checks) != 1 {
+		t.Error("bindings and health checkers of an attached module should be registered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := impl.modules.Detach(ctx, "tenant-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case <-plugin.stopped:
+	default:
+		t.Error("daemon should be stopped after detach")
+	}
+
+	select {
+	case <-plugin.closed:
+	default:
+		t.Error("shutdown handlers should be invoked after detach")
+	}
+
+	if len(impl.modules.Modules()) != 0 {
+		t.Errorf("unexpected modules: %v", impl.modules.Modules())
+	}
+
+	if hasModuleBinding() || len(registry.Check(context.Background()).Checks) != 0 {
+		t.Error("bindings and health checkers of a detached module should be removed")
+	}
+}
+
+func TestModulePanicDetachesModule(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	app := startAsyncTestApp(t, impl)
+	defer app.Stop(context.Background())
+
+	if err := impl.modules.Attach("tenant-1", &panicDaemonProvider{policy: infra.PanicPolicyShutdown, panics: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.After(time.Second)
+	for len(impl.modules.Modules()) != 0 {
+		select {
+		case <-deadline:
+			t.Fatal("module should be detached after its daemon panics")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	select {
+	case <-app.Done():
+		t.Error("a panic in an attached module should not shutdown the application")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type hangingShutdownProvider struct{ release chan struct{} }
+
+func (p hangingShutdownProvider) Register(binder infra.Binder) {}
+
+func (p hangingShutdownProvider) Boot(resolver infra.Resolver) {
+	resolver.MustResolve(func(gf infra.Graceful) {
+		gf.AddShutdownHandler(func() { <-p.release })
+	})
+}
+
+func TestModuleDetachDeadline(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	app := startAsyncTestApp(t, impl)
+	defer app.Stop(context.Background())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	if err := impl.modules.Attach("tenant-1", hangingShutdownProvider{release: release}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 停机 handler 阻塞时，Detach 在 ctx 超时后返回
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() { done <- impl.modules.Detach(ctx, "tenant-1") }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expect detach timeout error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("detach should return once ctx is done")
+	}
+
+	// 应用停机卸载所有模块之后，不能再挂载模块
+	impl.modules.detachAll()
+	if err := impl.modules.Attach("tenant-2", pluginDependencyProvider{registered: new(bool)}); err == nil {
+		t.Error("expect error when attaching a module after detachAll")
+	}
+}
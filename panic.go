@@ -0,0 +1,133 @@
+package glacier
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
+	"github.com/mylxsw/glacier/log"
+)
+
+const (
+	defaultPanicRestartBackoff    = time.Second
+	defaultPanicRestartMaxBackoff = time.Minute
+)
+
+// WithPanicHandler 设置模块 panic 时的回调
+func (impl *framework) WithPanicHandler(handler infra.PanicHandler) infra.Glacier {
+	impl.panicHandler = handler
+	return impl
+}
+
+// resolvePanicPolicy 获取模块的 panic 处理策略，未实现 infra.PanicPolicyAware 接口的模块默认触发应用停机
+func resolvePanicPolicy(module interface{}) infra.PanicPolicy {
+	if p, ok := module.(infra.PanicPolicyAware); ok {
+		return p.PanicPolicy()
+	}
+
+	return infra.PanicPolicyShutdown
+}
+
+// callWithRecover 执行 fn，如果 fn 发生 panic，返回 panic 信息
+func callWithRecover(name string, module interface{}, fn func()) (info *infra.PanicInfo) {
+	defer func() {
+		if err := recover(); err != nil {
+			info = &infra.PanicInfo{
+				Module: name,
+				Err:    err,
+				Stack:  debug.Stack(),
+				Policy: resolvePanicPolicy(module),
+			}
+		}
+	}()
+
+	fn()
+	return nil
+}
+
+// handlePanic 记录模块 panic 信息，并调用用户设置的 PanicHandler
+func (impl *framework) handlePanic(info infra.PanicInfo) {
+	log.Errorf("[glacier] module %s panic: %v (policy: %s), Stack: \n%s", info.Module, info.Err, info.Policy, info.Stack)
+
+	if impl.panicHandler == nil {
+		return
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("[glacier] panic handler for module %s failed: %v", info.Module, err)
+		}
+	}()
+
+	impl.panicHandler(info)
+}
+
+// shutdownOnPanic 模块 panic 后触发应用停机，应用已经在停机过程中时忽略
+func (impl *framework) shutdownOnPanic(gf infra.Graceful, info infra.PanicInfo) {
+	if impl.currentStatus() >= Stopping {
+		return
+	}
+
+	log.Errorf("[glacier] module %s panic, application will shutdown", info.Module)
+	gf.Shutdown()
+}
+
+// runDaemonProvider 执行 DaemonProvider 的 Daemon 方法，发生 panic 时按照模块的 panic 处理策略处理
+func (impl *framework) runDaemonProvider(ctx context.Context, gf infra.Graceful, resolver infra.Resolver, p *providerEntry, pp infra.DaemonProvider) {
+	backoff := defaultPanicRestartBackoff
+	for {
+		startTs := impl.clock.Now()
+		impl.publishLifecycleEvent(lifecycle.DaemonStarted{Name: p.Name(), Time: startTs})
+		info := callWithRecover(p.Name(), p.provider, func() { pp.Daemon(ctx, resolver) })
+		impl.publishLifecycleEvent(lifecycle.DaemonStopped{Name: p.Name(), Time: impl.clock.Now(), Duration: impl.clock.Since(startTs)})
+
+		if info == nil {
+			return
+		}
+
+		impl.handlePanic(*info)
+
+		switch info.Policy {
+		case infra.PanicPolicyIgnore:
+			return
+		case infra.PanicPolicyShutdown:
+			impl.shutdownOnPanic(gf, *info)
+			return
+		}
+
+		if impl.currentStatus() >= Stopping {
+			return
+		}
+
+		if infra.WARN {
+			log.Warningf("[glacier] daemon provider %s will be restarted in %s", p.Name(), backoff)
+		}
+
+		timer := impl.clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		backoff *= 2
+		if backoff > defaultPanicRestartMaxBackoff {
+			backoff = defaultPanicRestartMaxBackoff
+		}
+	}
+}
+
+// startService 执行 Service 的 Start 方法，发生 panic 时返回 panic 信息
+func (impl *framework) startService(s *serviceEntry) (info *infra.PanicInfo, err error) {
+	info = callWithRecover(s.Name(), s.service, func() { err = s.service.Start() })
+	if info != nil {
+		impl.handlePanic(*info)
+		err = fmt.Errorf("service %s panic: %v", s.Name(), info.Err)
+	}
+
+	return info, err
+}
@@ -0,0 +1,106 @@
+package glacier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/clock"
+	"github.com/mylxsw/glacier/infra"
+)
+
+type panicDaemonProvider struct {
+	policy infra.PanicPolicy
+	panics int
+	runs   int
+}
+
+func (p *panicDaemonProvider) Register(binder infra.Binder) {}
+
+func (p *panicDaemonProvider) Daemon(ctx context.Context, resolver infra.Resolver) {
+	p.runs++
+	if p.runs <= p.panics {
+		panic("oops")
+	}
+}
+
+func (p *panicDaemonProvider) PanicPolicy() infra.PanicPolicy { return p.policy }
+
+type panicService struct{}
+
+func (panicService) Start() error { panic("oops") }
+
+func TestDaemonPanicPolicies(t *testing.T) {
+	run := func(impl *framework, provider *panicDaemonProvider) (*readyTestGraceful, []infra.PanicInfo) {
+		infos := make([]infra.PanicInfo, 0)
+		impl.WithPanicHandler(func(info infra.PanicInfo) { infos = append(infos, info) })
+
+		gf := &readyTestGraceful{shutdown: make(chan struct{})}
+		impl.runDaemonProvider(context.Background(), gf, impl.cc, newProviderEntry(provider), provider)
+
+		return gf, infos
+	}
+
+	shutdownCalled := func(gf *readyTestGraceful) bool {
+		select {
+		case <-gf.shutdown:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// 默认策略：触发应用停机
+	provider := &panicDaemonProvider{policy: infra.PanicPolicyShutdown, panics: 1}
+	gf, infos := run(New("1.0", 1).(*framework), provider)
+	if !shutdownCalled(gf) || provider.runs != 1 || len(infos) != 1 || infos[0].Policy != infra.PanicPolicyShutdown {
+		t.Errorf("shutdown policy: shutdown=%v, runs=%d, infos=%v", shutdownCalled(gf), provider.runs, infos)
+	}
+
+	// 忽略：记录 panic，不重启也不停机
+	provider = &panicDaemonProvider{policy: infra.PanicPolicyIgnore, panics: 1}
+	gf, infos = run(New("1.0", 1).(*framework), provider)
+	if shutdownCalled(gf) || provider.runs != 1 || len(infos) != 1 {
+		t.Errorf("ignore policy: shutdown=%v, runs=%d, infos=%v", shutdownCalled(gf), provider.runs, infos)
+	}
+
+	// 重启：按照指数退避重启，直到 Daemon 正常返回
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	impl := New("1.0", 1).(*framework)
+	impl.WithClock(fake)
+
+	done := make(chan struct{})
+	provider = &panicDaemonProvider{policy: infra.PanicPolicyRestart, panics: 2}
+	go func() {
+		defer close(done)
+		gf, infos = run(impl, provider)
+	}()
+
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second} {
+		fake.BlockUntil(1)
+		fake.Advance(backoff)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("daemon provider should be restarted")
+	}
+
+	if shutdownCalled(gf) || provider.runs != 3 || len(infos) != 2 {
+		t.Errorf("restart policy: shutdown=%v, runs=%d, infos=%v", shutdownCalled(gf), provider.runs, infos)
+	}
+}
+
+func TestServicePanic(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	gf := &readyTestGraceful{shutdown: make(chan struct{})}
+
+	impl.superviseService(context.Background(), gf, newServiceEntry(panicService{}))
+
+	select {
+	case <-gf.shutdown:
+	default:
+		t.Error("service panic should shutdown application by default")
+	}
+}
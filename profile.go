@@ -0,0 +1,113 @@
+package glacier
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mylxsw/glacier/infra"
+)
+
+// WithProfile 设置当前运行环境的来源，依次从命令行选项 flagName、环境变量 envName 中读取，都没有指定时使用 defaultProfile
+// flagName 或者 envName 为空时，不从对应的来源读取
+func (impl *framework) WithProfile(flagName string, envName string, defaultProfile string) infra.Glacier {
+	if impl.status >= Initialized {
+		panic("[glacier] can not invoke this method after Glacier has been initialize")
+	}
+
+	impl.profileFlag = flagName
+	impl.profileEnv = envName
+	impl.defaultProfile = defaultProfile
+	return impl
+}
+
+// ForProfiles 返回用于注册只在指定运行环境中加载的 Provider/Service 的注册器
+func (impl *framework) ForProfiles(profiles ...string) infra.ProfileRegistrar {
+	return &profileRegistrar{impl: impl, profiles: profiles}
+}
+
+type profileRegistrar struct {
+	impl     *framework
+	profiles []string
+}
+
+func (r *profileRegistrar) Provider(providers ...infra.Provider) {
+	r.impl.Provider(providers...)
+	for _, p := range r.impl.providers[len(r.impl.providers)-len(providers):] {
+		p.profiles = append(p.profiles, r.profiles...)
+	}
+}
+
+func (r *profileRegistrar) Service(services ...infra.Service) {
+	r.impl.Service(services...)
+	for _, s := range r.impl.services[len(r.impl.services)-len(services):] {
+		s.profiles = append(s.profiles, r.profiles...)
+	}
+}
+
+// activateProfile 确定当前的运行环境，返回附带运行环境的 FlagContext
+func (impl *framework) activateProfile(flagCtx infra.FlagContext) infra.FlagContext {
+	profile := impl.defaultProfile
+	if impl.profileEnv != "" {
+		if val := os.Getenv(impl.profileEnv); val != "" {
+			profile = val
+		}
+	}
+
+	if impl.profileFlag != "" {
+		if val := flagCtx.String(impl.profileFlag); val != "" {
+			profile = val
+		}
+	}
+
+	impl.profile = infra.Profile(profile)
+	return impl.withProfile(flagCtx)
+}
+
+// withProfile 为 FlagContext 附加当前的运行环境
+func (impl *framework) withProfile(flagCtx infra.FlagContext) infra.FlagContext {
+	if pc, ok := flagCtx.(*profileFlagContext); ok && pc.profile == impl.profile {
+		return flagCtx
+	}
+
+	return &profileFlagContext{FlagContext: flagCtx, profile: impl.profile}
+}
+
+// profileSkipReason 模块声明的运行环境与当前运行环境不匹配时，返回模块不会被加载的原因
+// declared 为注册时通过 ForProfiles 指定的运行环境，module 实现了 infra.ProfileModule 时，同时需要满足其声明的运行环境
+func (impl *framework) profileSkipReason(declared []string, module interface{}) string {
+	if len(declared) > 0 && !impl.profile.Is(declared...) {
+		return profileMismatch(declared, impl.profile)
+	}
+
+	if pm, ok := module.(infra.ProfileModule); ok {
+		if profiles := pm.Profiles(); len(profiles) > 0 && !impl.profile.Is(profiles...) {
+			return profileMismatch(profiles, impl.profile)
+		}
+	}
+
+	return ""
+}
+
+func profileMismatch(profiles []string, active infra.Profile) string {
+	if active == "" {
+		active = "none"
+	}
+
+	return fmt.Sprintf("profile %s not active (active: %s)", strings.Join(profiles, "|"), active)
+}
+
+// profileFlagContext 附带当前运行环境的 FlagContext
+type profileFlagContext struct {
+	infra.FlagContext
+	profile infra.Profile
+}
+
+func (f *profileFlagContext) Profile() infra.Profile {
+	return f.profile
+}
+
+// Unwrap 返回原始的 FlagContext，比如使用命令行启动时的 *cli.Context
+func (f *profileFlagContext) Unwrap() infra.FlagContext {
+	return f.FlagContext
+}
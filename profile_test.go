@@ -0,0 +1,74 @@
+package glacier
+
+import (
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+)
+
+type prodOnlyProvider struct{}
+
+func (prodOnlyProvider) Register(binder infra.Binder) {}
+func (prodOnlyProvider) Profiles() []string           { return []string{infra.ProfileProd} }
+
+type mockMailerProvider struct{}
+
+func (mockMailerProvider) Register(binder infra.Binder) {}
+
+type profileService struct{}
+
+func (profileService) Start() error { return nil }
+
+func TestProfiles(t *testing.T) {
+	t.Setenv("APP_PROFILE", infra.ProfileTest)
+
+	impl := New("1.0", 1).(*framework)
+	impl.WithProfile("profile", "APP_PROFILE", infra.ProfileDev)
+	impl.Provider(prodOnlyProvider{})
+	impl.ForProfiles(infra.ProfileDev, infra.ProfileTest).Provider(mockMailerProvider{})
+	impl.ForProfiles(infra.ProfileProd).Service(profileService{})
+
+	var initProfile infra.Profile
+	impl.Init(func(fc infra.FlagContext) error {
+		initProfile = infra.ActiveProfile(fc)
+		return nil
+	})
+
+	plan, err := impl.BootPlan(NewFlagContext())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if initProfile != infra.ProfileTest {
+		t.Errorf("expected profile test from env, got %q", initProfile)
+	}
+
+	skipped := make(map[string]string)
+	for _, m := range plan.Modules {
+		skipped[m.Name] = m.SkipReason
+	}
+
+	if reason := skipped[resolveNameable(prodOnlyProvider{})]; reason != "profile prod not active (active: test)" {
+		t.Errorf("unexpected skip reason for prod only provider: %q", reason)
+	}
+	if reason := skipped[resolveNameable(mockMailerProvider{})]; reason != "" {
+		t.Errorf("mock mailer provider should be loaded, got %q", reason)
+	}
+	if reason := skipped[resolveNameable(profileService{})]; reason == "" {
+		t.Error("prod service should be skipped")
+	}
+
+	// 命令行选项的优先级高于环境变量
+	flagCtx := NewFlagContext()
+	flagCtx.SetString("profile", infra.ProfileProd)
+	if err := impl.Validate(flagCtx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	impl.cc.MustResolve(func(fc infra.FlagContext) {
+		profile := impl.cc.MustGet(infra.ProfileKey).(infra.Profile)
+		if profile != infra.ProfileProd || infra.ActiveProfile(fc) != infra.ProfileProd {
+			t.Errorf("expected profile prod, got %q/%q", profile, infra.ActiveProfile(fc))
+		}
+	})
+}
@@ -8,13 +8,25 @@ import (
 	"sync"
 
 	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
 	"github.com/mylxsw/glacier/log"
+	"github.com/mylxsw/go-ioc"
 	"github.com/mylxsw/go-utils/array"
 )
 
 type providerEntry struct {
 	provider infra.Provider
 	name     string
+	// aggregatedBy 通过 ProviderAggregate 引入该 Provider 的模块名称
+	aggregatedBy string
+	// level Provider 在依赖关系中所处的层级
+	level int
+	// skipReason Provider 不会被加载的原因
+	skipReason string
+	// profiles 通过 ForProfiles 注册时指定的运行环境
+	profiles []string
+	// cc Provider 使用的容器，ScopedProvider 为独立的子容器，其它 Provider 为全局容器
+	cc ioc.Container
 }
 
 func newProviderEntry(provider infra.Provider) *providerEntry {
@@ -25,10 +37,23 @@ func (p providerEntry) Name() string {
 	return p.name
 }
 
+func (p providerEntry) module() interface{} {
+	return p.provider
+}
+
+func (p providerEntry) dependsOn() []interface{} {
+	if dep, ok := p.provider.(infra.ProviderDependency); ok {
+		return array.Map(dep.DependsOn(), func(item infra.Provider, _ int) interface{} { return item })
+	}
+
+	return nil
+}
+
 // Provider add a service provider
 func (impl *framework) Provider(providers ...infra.Provider) {
 	for _, p := range providers {
 		validateShouldLoadMethod(reflect.TypeOf(p))
+		impl.collectProviderHooks(p)
 	}
 
 	impl.providers = append(impl.providers, array.Map(providers, func(p infra.Provider, _ int) *providerEntry {
@@ -38,31 +63,65 @@ func (impl *framework) Provider(providers ...infra.Provider) {
 
 // registerProviders 注册所有的 Providers
 func (impl *framework) registerProviders() error {
+	providers, _, err := impl.filterProviderEntries(impl.cc, impl.providers, nil, true)
+	if err != nil {
+		return err
+	}
+
+	impl.providers = providers
+	impl.collectStopHooks(providers)
+	return impl.registerProviderEntries(impl.cc, "", providers)
+}
+
+// registerProviderEntries 依次执行 providers 的 Register 方法，providers 应该已经过滤并排好序
+// cc 为 providers 绑定对象使用的容器，scope 为记录绑定来源时使用的作用域，全局容器为空
+func (impl *framework) registerProviderEntries(cc ioc.Container, scope string, providers []*providerEntry) error {
 	var parentGraphNode *infra.GraphvizNode
 	var childGraphNodes []*infra.GraphvizNode
-	if infra.DEBUG && len(impl.providers) > 0 {
+	if infra.DEBUG && len(providers) > 0 {
 		parentGraphNode = impl.pushGraphvizNode("register providers", false)
 		parentGraphNode.Style = infra.GraphvizNodeStyleImportant
 	}
 
-	impl.providers = impl.providersFilter()
-	for _, p := range impl.providers {
+	for _, p := range providers {
 		if infra.DEBUG {
 			childGraphNodes = append(childGraphNodes, impl.pushGraphvizNode(fmt.Sprintf("register provider %s", p.Name()), false, parentGraphNode))
 			log.Debugf("[glacier] register provider %s", p.Name())
 		}
-		p.provider.Register(impl.cc)
+		p.cc = cc
+		binder := impl.binder(cc, p.Name(), scope)
+		if _, ok := p.provider.(infra.ScopedProvider); ok {
+			p.cc = newScopedContainer(cc)
+			binder = impl.binder(p.cc, p.Name(), joinBindingScope(scope, p.Name()))
+		}
+
+		startTs := impl.clock.Now()
+		p.provider.Register(binder)
+		took := impl.recordStartupStep(p.Name(), infra.StartupStepRegister, startTs)
+
+		if sp, ok := p.provider.(infra.ScopedProvider); ok {
+			if err := impl.exportScopedBindings(cc, scope, p, sp); err != nil {
+				return err
+			}
+		}
+
+		impl.publishLifecycleEvent(lifecycle.ProviderRegistered{Name: p.Name(), Time: impl.clock.Now(), Duration: took})
 	}
 
-	if infra.DEBUG && len(impl.providers) > 0 {
+	if infra.DEBUG && len(providers) > 0 {
 		impl.pushGraphvizNode("register providers done", false, childGraphNodes...)
-		log.Debugf("[glacier] all providers registered, total %d", len(impl.providers))
+		log.Debugf("[glacier] all providers registered, total %d", len(providers))
 	}
 
 	return nil
 }
 
 func (impl *framework) bootProviders() error {
+	return impl.bootProviderEntries(impl.providers)
+}
+
+// bootProviderEntries 依次执行 providers 的 Boot 方法，每个 Provider 使用注册时分配的容器
+func (impl *framework) bootProviderEntries(providers []*providerEntry) error {
 	var parentGraphNode *infra.GraphvizNode
 	var childGraphNodes []*infra.GraphvizNode
 	if infra.DEBUG {
@@ -71,10 +130,10 @@ func (impl *framework) bootProviders() error {
 	}
 
 	var bootedProviderCount int
-	for _, p := range impl.providers {
+	for _, p := range providers {
 		if reflect.ValueOf(p.provider).Kind() == reflect.Ptr {
-			if err := impl.cc.AutoWire(p); err != nil {
-				return fmt.Errorf("[glacier] can not autowire provider: %v", err)
+			if err := p.cc.AutoWire(p.provider); err != nil {
+				return fmt.Errorf("[glacier] can not autowire provider %s: %v", p.Name(), err)
 			}
 		}
 
@@ -84,7 +143,10 @@ func (impl *framework) bootProviders() error {
 				log.Debugf("[glacier] booting provider %s", p.Name())
 			}
 			bootedProviderCount++
-			providerBoot.Boot(impl.cc)
+			startTs := impl.clock.Now()
+			providerBoot.Boot(p.cc)
+			took := impl.recordStartupStep(p.Name(), infra.StartupStepBoot, startTs)
+			impl.publishLifecycleEvent(lifecycle.ProviderBooted{Name: p.Name(), Time: impl.clock.Now(), Duration: took})
 		}
 	}
 
@@ -97,7 +159,15 @@ func (impl *framework) bootProviders() error {
 }
 
 func (impl *framework) startDaemonProviders(ctx context.Context, wg *sync.WaitGroup) error {
-	daemonServiceProviderCount := len(array.Filter(impl.providers, func(p *providerEntry, _ int) bool {
+	var gf infra.Graceful
+	impl.cc.MustResolve(func(g infra.Graceful) { gf = g })
+
+	return impl.startDaemonProviderEntries(ctx, gf, impl.providers, wg)
+}
+
+// startDaemonProviderEntries 在独立的 goroutine 中执行 providers 的 Daemon 方法，Daemon 异常退出时的停机作用于 gf
+func (impl *framework) startDaemonProviderEntries(ctx context.Context, gf infra.Graceful, providers []*providerEntry, wg *sync.WaitGroup) error {
+	daemonServiceProviderCount := len(array.Filter(providers, func(p *providerEntry, _ int) bool {
 		_, ok := p.provider.(infra.DaemonProvider)
 		return ok
 	}))
@@ -110,7 +180,7 @@ func (impl *framework) startDaemonProviders(ctx context.Context, wg *sync.WaitGr
 	}
 
 	// 如果是 DaemonProvider，需要在单独的 Goroutine 执行，一般都是阻塞执行的
-	for _, p := range impl.providers {
+	for _, p := range providers {
 		if pp, ok := p.provider.(infra.DaemonProvider); ok {
 			wg.Add(1)
 
@@ -121,7 +191,7 @@ func (impl *framework) startDaemonProviders(ctx context.Context, wg *sync.WaitGr
 
 			go func(pp infra.DaemonProvider, p *providerEntry) {
 				defer wg.Done()
-				pp.Daemon(ctx, impl.cc)
+				impl.runDaemonProvider(ctx, gf, p.cc, p, pp)
 
 				if infra.DEBUG {
 					log.Debugf("[glacier] daemon provider %s has been stopped", p.Name())
@@ -143,6 +213,7 @@ func resolveProviderAggregate(provider *providerEntry) []*providerEntry {
 	if ex, ok := provider.provider.(infra.ProviderAggregate); ok {
 		for _, exp := range ex.Aggregates() {
 			pr := newProviderEntry(exp)
+			pr.aggregatedBy = provider.Name()
 			providers = append(append(providers, resolveProviderAggregate(pr)...), pr)
 		}
 	}
@@ -151,13 +222,33 @@ func resolveProviderAggregate(provider *providerEntry) []*providerEntry {
 }
 
 // providersFilter 预处理 providers，排除掉不需要加载的 providers
-func (impl *framework) providersFilter() []*providerEntry {
+func (impl *framework) providersFilter() ([]*providerEntry, error) {
+	providers, _, err := impl.filterProviders()
+	return providers, err
+}
+
+// filterProviders 返回排好序的需要加载的 providers，以及不需要加载的 providers
+func (impl *framework) filterProviders() ([]*providerEntry, []*providerEntry, error) {
+	return impl.filterProviderEntries(impl.cc, impl.providers, nil, false)
+}
+
+// filterProviderEntries 过滤并排序 entries，cc 为调用 ShouldLoad 方法使用的容器
+// loaded 为已经加载的 providers，依赖这些 provider 时视为依赖已经满足，record 为 true 时记录 ShouldLoad 的启动耗时
+func (impl *framework) filterProviderEntries(cc ioc.Container, entries []*providerEntry, loaded []*providerEntry, record bool) ([]*providerEntry, []*providerEntry, error) {
 	aggregates := make([]*providerEntry, 0)
-	for _, p := range impl.providers {
-		if !impl.shouldLoadModule(reflect.ValueOf(p.provider)) {
-			if infra.DEBUG {
-				log.Debugf("[glacier] provider %s is ignored because ShouldLoad()=false", p.Name())
-			}
+	skipped := make([]*providerEntry, 0)
+	for _, p := range entries {
+		if reason := impl.profileSkipReason(p.profiles, p.provider); reason != "" {
+			p.skipReason = reason
+		} else if !impl.shouldLoadModule(cc, p.Name(), reflect.ValueOf(p.provider), record) {
+			p.skipReason = "ShouldLoad()=false"
+		} else {
+			p.skipReason = ""
+		}
+
+		if p.skipReason != "" {
+			log.Infof("[glacier] provider %s is skipped because %s", p.Name(), p.skipReason)
+			skipped = append(skipped, p)
 			continue
 		}
 
@@ -176,7 +267,17 @@ func (impl *framework) providersFilter() []*providerEntry {
 	}
 
 	sort.Sort(Providers(aggregates))
-	return aggregates
+
+	sorted, levels, err := sortByDependency("provider", aggregates, skipped, loaded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, p := range sorted {
+		p.level = levels[i]
+	}
+
+	return sorted, skipped, nil
 }
 
 type Providers []*providerEntry
@@ -0,0 +1,85 @@
+package glacier
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+// newScopedContainer 创建 ScopedProvider 使用的子容器，子容器中找不到的绑定会从 parent 中查找
+func newScopedContainer(parent ioc.Container) ioc.Container {
+	cc := ioc.Extend(parent)
+	cc.MustSingletonOverride(func() infra.Resolver { return cc })
+	cc.MustSingletonOverride(func() infra.Binder { return cc })
+
+	return cc
+}
+
+// exportScopedBindings 将 ScopedProvider 声明导出的类型发布到 cc（Provider 所在的容器），导出的类型已经被其它模块绑定时返回冲突错误
+func (impl *framework) exportScopedBindings(cc ioc.Container, scope string, p *providerEntry, sp infra.ScopedProvider) error {
+	bound := make(map[interface{}]bool)
+	for _, k := range p.cc.Keys() {
+		bound[k] = true
+	}
+
+	for _, export := range sp.Exports() {
+		typ := exportedType(export)
+		if typ == nil {
+			return fmt.Errorf("[glacier] provider %s exports an invalid type: %v", p.Name(), export)
+		}
+
+		if !bound[typ] {
+			return fmt.Errorf("[glacier] provider %s exports %s, but it is not bound in the provider's container", p.Name(), typ)
+		}
+
+		err := impl.bindings.bind(scope, p.Name(), typ, infra.BindingExport, false, exportInitializer(p.cc, typ), func(initialize interface{}) (bool, error) {
+			return true, cc.Prototype(initialize)
+		})
+		if err != nil {
+			return fmt.Errorf("[glacier] provider %s exports %s failed: %v", p.Name(), typ, err)
+		}
+	}
+
+	return nil
+}
+
+// exportedType 解析导出声明对应的绑定类型，(*Interface)(nil) 解析为接口类型本身
+func exportedType(export interface{}) reflect.Type {
+	typ := reflect.TypeOf(export)
+	if typ == nil {
+		return nil
+	}
+
+	if typ.Kind() == reflect.Ptr && typ.Elem().Kind() == reflect.Interface {
+		return typ.Elem()
+	}
+
+	return typ
+}
+
+// exportInitializer 创建一个 func() (T, error) 形式的初始化函数，每次调用都从子容器中获取对象，
+// 因此导出对象的生命周期由子容器中的绑定方式决定
+func exportInitializer(cc ioc.Container, typ reflect.Type) interface{} {
+	fnType := reflect.FuncOf(nil, []reflect.Type{typ, errorKind}, false)
+	return reflect.MakeFunc(fnType, func([]reflect.Value) []reflect.Value {
+		val := reflect.New(typ).Elem()
+		ins, err := cc.Get(typ)
+		if err != nil {
+			return []reflect.Value{val, reflect.ValueOf(&err).Elem()}
+		}
+
+		val.Set(reflect.ValueOf(ins))
+		return []reflect.Value{val, reflect.Zero(errorKind)}
+	}).Interface()
+}
+
+// joinBindingScope 计算 ScopedProvider 子容器记录绑定时使用的作用域，parent 为 Provider 所在容器的作用域
+func joinBindingScope(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "/" + name
+}
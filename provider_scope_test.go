@@ -0,0 +1,63 @@
+package glacier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+type scopedRepo interface{ Name() string }
+
+type scopedRepoImpl struct{ name string }
+
+func (r scopedRepoImpl) Name() string { return r.name }
+
+type scopedPrivate struct{}
+
+type scopedProviderA struct{}
+
+func (scopedProviderA) Register(binder infra.Binder) {
+	binder.MustSingleton(func() *scopedPrivate { return &scopedPrivate{} })
+	binder.MustSingleton(func(p *scopedPrivate) scopedRepo { return scopedRepoImpl{name: "a"} })
+}
+func (scopedProviderA) Exports() []interface{} { return []interface{}{(*scopedRepo)(nil)} }
+
+type scopedProviderB struct{}
+
+func (scopedProviderB) Register(binder infra.Binder) {
+	binder.MustSingleton(func() scopedRepo { return scopedRepoImpl{name: "b"} })
+}
+func (scopedProviderB) Exports() []interface{} { return []interface{}{(*scopedRepo)(nil)} }
+
+func TestScopedProviderExports(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Provider(scopedProviderA{})
+	impl.cc = ioc.New()
+
+	if err := impl.registerProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	impl.cc.MustResolve(func(repo scopedRepo) {
+		if repo.Name() != "a" {
+			t.Errorf("unexpected repo: %s", repo.Name())
+		}
+	})
+
+	if _, err := impl.cc.Get((*scopedPrivate)(nil)); err == nil {
+		t.Error("private binding should not be visible in global container")
+	}
+}
+
+func TestScopedProviderExportConflict(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Provider(scopedProviderA{}, scopedProviderB{})
+	impl.cc = ioc.New()
+
+	err := impl.registerProviders()
+	if err == nil || !strings.Contains(err.Error(), "scopedProviderA") || !strings.Contains(err.Error(), "scopedProviderB") {
+		t.Fatalf("expect export conflict error with both module names, got %v", err)
+	}
+}
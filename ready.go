@@ -0,0 +1,341 @@
+package glacier
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
+	"github.com/mylxsw/glacier/log"
+)
+
+// defaultReadyHookRetries 使用 ReadyHookRetry 策略但是没有指定重试次数时的默认重试次数
+const defaultReadyHookRetries = 3
+
+// SetReadyHookNameOption 设置 OnServerReady 钩子名称
+func SetReadyHookNameOption(name string) infra.ReadyHookOption {
+	return func(opts *infra.ReadyHookOptions) {
+		opts.Name = name
+	}
+}
+
+// SetReadyHookGroupOption 设置 OnServerReady 钩子分组，同一个分组中的钩子按照添加顺序依次执行
+func SetReadyHookGroupOption(group string) infra.ReadyHookOption {
+	return func(opts *infra.ReadyHookOptions) {
+		opts.Group = group
+	}
+}
+
+// SetReadyHookTimeoutOption 设置 OnServerReady 钩子单次执行的超时时间
+func SetReadyHookTimeoutOption(timeout time.Duration) infra.ReadyHookOption {
+	return func(opts *infra.ReadyHookOptions) {
+		opts.Timeout = timeout
+	}
+}
+
+// SetReadyHookRetryOption 设置 OnServerReady 钩子失败后的重试次数，以及第一次重试前的等待时间
+func SetReadyHookRetryOption(maxRetries int, backoff time.Duration) infra.ReadyHookOption {
+	return func(opts *infra.ReadyHookOptions) {
+		if opts.Policy == infra.ReadyHookLog {
+			opts.Policy = infra.ReadyHookRetry
+		}
+
+		opts.MaxRetries = maxRetries
+		opts.RetryBackoff = backoff
+	}
+}
+
+// SetReadyHookAbortOption OnServerReady 钩子最终执行失败时停止应用
+func SetReadyHookAbortOption() infra.ReadyHookOption {
+	return func(opts *infra.ReadyHookOptions) {
+		opts.Policy = infra.ReadyHookAbort
+	}
+}
+
+// SetReadyHookRequiredOption 应用在该钩子执行成功之后才会标记为就绪
+func SetReadyHookRequiredOption() infra.ReadyHookOption {
+	return func(opts *infra.ReadyHookOptions) {
+		opts.Required = true
+	}
+}
+
+// readyHook OnServerReady 钩子
+type readyHook struct {
+	name string
+	fn   interface{}
+	opts infra.ReadyHookOptions
+}
+
+func newReadyHook(fn interface{}, options ...infra.ReadyHookOption) *readyHook {
+	hook := &readyHook{fn: fn}
+	for _, opt := range options {
+		opt(&hook.opts)
+	}
+
+	if hook.opts.Name == "" {
+		hook.opts.Name = runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	}
+
+	if hook.opts.Policy == infra.ReadyHookRetry && hook.opts.MaxRetries <= 0 {
+		hook.opts.MaxRetries = defaultReadyHookRetries
+	}
+
+	if hook.opts.Policy == infra.ReadyHookAbort {
+		hook.opts.Required = true
+	}
+
+	if hook.opts.RetryBackoff <= 0 {
+		hook.opts.RetryBackoff = defaultAsyncRetryBackoff
+	}
+
+	hook.name = hook.opts.Name
+	return hook
+}
+
+// OnServerReadyHook 添加一个可以配置分组、超时、失败处理策略的 OnServerReady 钩子
+func (impl *framework) OnServerReadyHook(fn interface{}, options ...infra.ReadyHookOption) {
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	if impl.status >= Started {
+		panic(fmt.Errorf("[glacier] can not call OnServerReadyHook since server has been started"))
+	}
+
+	if reflect.TypeOf(fn).Kind() != reflect.Func {
+		panic(fmt.Errorf("[glacier] argument for OnServerReadyHook [%T] must be a callable function", fn))
+	}
+
+	impl.onServerReadyHooks = append(impl.onServerReadyHooks, newReadyHook(fn, options...))
+}
+
+// call 执行一次钩子，钩子函数可以注入 context.Context，它会在超时或者应用停机时被取消
+func (hook *readyHook) call(ctx context.Context, resolver infra.Resolver) error {
+	if hook.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.opts.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("panic: %v", rec)
+			}
+		}()
+
+		results, err := resolver.CallWithProvider(hook.fn, resolver.Provider(func() context.Context { return ctx }))
+		if err == nil && len(results) > 0 {
+			if e, ok := results[len(results)-1].(error); ok && e != nil {
+				err = e
+			}
+		}
+
+		done <- err
+	}()
+
+	if hook.opts.Timeout <= 0 {
+		return <-done
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", hook.opts.Timeout)
+		}
+
+		return ctx.Err()
+	}
+}
+
+// run 执行钩子，失败后按照配置进行重试，应用停机后不再重试
+func (hook *readyHook) run(ctx context.Context, resolver infra.Resolver, clock infra.Clock) error {
+	backoff := hook.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := hook.call(ctx, resolver)
+		if err == nil || attempt >= hook.opts.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		if infra.WARN {
+			log.Warningf("[glacier] onServerReady hook [%s] failed: %v, retry in %s (%d/%d)", hook.name, err, backoff, attempt+1, hook.opts.MaxRetries)
+		}
+
+		timer := clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C():
+		}
+
+		backoff *= 2
+	}
+}
+
+// readyHookGroups 将钩子按照分组组织，没有分组的钩子各自为一组，分组按照其第一个钩子的添加顺序排列
+func readyHookGroups(hooks []*readyHook) [][]*readyHook {
+	groups := make([][]*readyHook, 0)
+	index := make(map[string]int)
+	for _, hook := range hooks {
+		if hook.opts.Group == "" {
+			groups = append(groups, []*readyHook{hook})
+			continue
+		}
+
+		if i, ok := index[hook.opts.Group]; ok {
+			groups[i] = append(groups[i], hook)
+			continue
+		}
+
+		index[hook.opts.Group] = len(groups)
+		groups = append(groups, []*readyHook{hook})
+	}
+
+	return groups
+}
+
+// readyStage 执行 OnServerReady 钩子，不同分组之间并发执行，所有 Required 钩子执行成功之后调用 onReady 将应用标记为就绪
+// 没有 Required 钩子时，onReady 会在该方法返回之前被调用
+// 返回的函数用于在停机之后获取 ReadyHookAbort 策略的钩子执行失败导致应用停机的错误，没有发生时返回 nil
+func (impl *framework) readyStage(ctx context.Context, resolver infra.Resolver, gf infra.Graceful, onReady func()) func() error {
+	finishStage := impl.lifecycleStage(lifecycle.StageReady)
+
+	if infra.DEBUG {
+		impl.pushGraphvizNode("readyStage", false).Type = infra.GraphvizNodeTypeClusterStart
+		defer func() {
+			impl.pushGraphvizNode("readyStage", false).Type = infra.GraphvizNodeTypeClusterEnd
+		}()
+	}
+
+	var childGraphNodes []*infra.GraphvizNode
+	var parentGraphNode *infra.GraphvizNode
+	if infra.DEBUG && len(impl.onServerReadyHooks) > 0 {
+		parentGraphNode = impl.pushGraphvizNode("invoke onServerReady hooks", true)
+		parentGraphNode.Style = infra.GraphvizNodeStyleHook
+	}
+
+	var wg, required sync.WaitGroup
+	var failedLock sync.Mutex
+	failed := make([]string, 0)
+	var aborted error
+
+	for _, group := range readyHookGroups(impl.onServerReadyHooks) {
+		pending := 0
+		for _, hook := range group {
+			if hook.opts.Required {
+				pending++
+			}
+
+			if infra.DEBUG {
+				childGraphNodes = append(childGraphNodes, impl.pushGraphvizNode("invoke onServerReady hook: "+hook.name, true, parentGraphNode))
+			}
+		}
+
+		wg.Add(1)
+		required.Add(pending)
+		go func(group []*readyHook, pending int) {
+			defer wg.Done()
+			defer func() {
+				// 分组中途失败时，尚未成功的 Required 钩子视为失败
+				for ; pending > 0; pending-- {
+					required.Done()
+				}
+			}()
+
+			for i, hook := range group {
+				if infra.DEBUG {
+					log.Debugf("[glacier] invoke onServerReady hook [%s]", hook.name)
+				}
+
+				err := hook.run(ctx, resolver, impl.clock)
+				if err == nil {
+					if hook.opts.Required {
+						pending--
+						required.Done()
+					}
+
+					continue
+				}
+
+				log.Errorf("[glacier] onServerReady hook [%s] failed: %v", hook.name, err)
+				if pending > 0 {
+					failedLock.Lock()
+					failed = append(failed, hook.name)
+					failedLock.Unlock()
+				}
+
+				if hook.opts.Policy == infra.ReadyHookAbort && ctx.Err() == nil {
+					log.Errorf("[glacier] application is shutting down because onServerReady hook [%s] failed", hook.name)
+
+					failedLock.Lock()
+					if aborted == nil {
+						aborted = fmt.Errorf("[glacier] application aborted because onServerReady hook [%s] failed: %w", hook.name, err)
+					}
+					failedLock.Unlock()
+
+					gf.Shutdown()
+				}
+
+				if infra.WARN && i < len(group)-1 {
+					log.Warningf("[glacier] the remaining %d onServerReady hooks in group [%s] are skipped", len(group)-i-1, hook.opts.Group)
+				}
+
+				return
+			}
+		}(group, pending)
+	}
+
+	gf.AddShutdownHandler(wg.Wait)
+
+	abortErr := func() error {
+		failedLock.Lock()
+		defer failedLock.Unlock()
+
+		return aborted
+	}
+
+	ready := func() {
+		finishStage()
+		impl.publishLifecycleEvent(lifecycle.ApplicationReady{Time: impl.clock.Now(), Duration: impl.clock.Since(impl.startTime)})
+
+		if infra.DEBUG {
+			impl.pushGraphvizNode("launched", false, childGraphNodes...)
+			log.Debugf("[glacier] application launched successfully, took %s", impl.clock.Since(impl.startTime))
+		}
+
+		onReady()
+	}
+
+	hasRequired := false
+	for _, hook := range impl.onServerReadyHooks {
+		hasRequired = hasRequired || hook.opts.Required
+	}
+
+	if !hasRequired {
+		ready()
+		return abortErr
+	}
+
+	go func() {
+		required.Wait()
+		if len(failed) > 0 {
+			finishStage()
+			log.Errorf("[glacier] application is not ready because required onServerReady hooks %v failed", failed)
+			return
+		}
+
+		// 等待期间应用已经开始停机时，不再标记为就绪
+		if impl.currentStatus() == Started {
+			ready()
+		}
+	}()
+
+	return abortErr
+}
@@ -0,0 +1,102 @@
+package glacier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/go-ioc"
+)
+
+type readyTestGraceful struct{ shutdown chan struct{} }
+
+func (gf *readyTestGraceful) AddReloadHandler(h func())      {}
+func (gf *readyTestGraceful) AddShutdownHandler(h func())    {}
+func (gf *readyTestGraceful) AddPreShutdownHandler(h func()) {}
+func (gf *readyTestGraceful) Reload()                        {}
+func (gf *readyTestGraceful) Shutdown()                      { close(gf.shutdown) }
+func (gf *readyTestGraceful) Start() error                   { return nil }
+
+func TestReadyHookGroups(t *testing.T) {
+	var lock sync.Mutex
+	calls := make([]string, 0)
+	hook := func(name string, err error) func() error {
+		return func() error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	attempts := 0
+	impl := New("1.0", 1).(*framework)
+	impl.OnServerReadyHook(hook("migrate", nil), SetReadyHookGroupOption("bootstrap"), SetReadyHookRequiredOption())
+	impl.OnServerReadyHook(func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("registry unavailable")
+		}
+		return nil
+	}, SetReadyHookGroupOption("bootstrap"), SetReadyHookRetryOption(3, time.Millisecond), SetReadyHookRequiredOption())
+	impl.OnServerReadyHook(hook("warm", nil), SetReadyHookGroupOption("bootstrap"))
+	impl.OnServerReadyHook(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, SetReadyHookTimeoutOption(10*time.Millisecond))
+
+	impl.cc = ioc.New()
+	impl.updateGlacierStatus(Started)
+
+	ready := make(chan struct{})
+	impl.readyStage(context.Background(), impl.cc, &readyTestGraceful{}, func() { close(ready) })
+
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("application should be ready after required hooks succeed")
+	}
+
+	if attempts != 3 {
+		t.Errorf("expect 3 attempts, got %d", attempts)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	if len(calls) != 2 || calls[0] != "migrate" || calls[1] != "warm" {
+		t.Errorf("hooks in the same group should run in order: %v", calls)
+	}
+}
+
+func TestReadyHookAbort(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.OnServerReadyHook(func() error { return errors.New("migration failed") }, SetReadyHookAbortOption())
+
+	impl.cc = ioc.New()
+	impl.updateGlacierStatus(Started)
+
+	gf := &readyTestGraceful{shutdown: make(chan struct{})}
+	ready := make(chan struct{})
+	abortErr := impl.readyStage(context.Background(), impl.cc, gf, func() { close(ready) })
+
+	select {
+	case <-gf.shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("application should shutdown when an abort hook fails")
+	}
+
+	if err := abortErr(); err == nil || !strings.Contains(err.Error(), "migration failed") {
+		t.Errorf("abort hook error should be reported, got %v", err)
+	}
+
+	select {
+	case <-ready:
+		t.Error("application should not be ready when a required hook fails")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
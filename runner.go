@@ -1,40 +1,283 @@
 package glacier
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime"
 	"sync"
+	"time"
 
 	"github.com/mylxsw/glacier/infra"
 	"github.com/mylxsw/glacier/log"
 )
 
+var (
+	// ErrAsyncJobRejected 应用停机后提交的异步任务会被拒绝
+	ErrAsyncJobRejected = errors.New("[glacier] async job rejected because application is shutting down")
+	// ErrAsyncQueueFull 异步任务队列已满，任务被拒绝
+	ErrAsyncQueueFull = errors.New("[glacier] async job rejected because the queue is full")
+	// ErrAsyncJobDropped 异步任务队列已满，任务被新提交的任务挤出队列
+	ErrAsyncJobDropped = errors.New("[glacier] async job dropped because the queue is full")
+)
+
+const defaultAsyncRetryBackoff = time.Second
+
+// SetAsyncNameOption 设置异步任务名称
+func SetAsyncNameOption(name string) infra.AsyncOption {
+	return func(opts *infra.AsyncJobOptions) {
+		opts.Name = name
+	}
+}
+
+// SetAsyncTimeoutOption 设置异步任务单次执行的超时时间，超时后取消任务的 context
+// 任务的执行结果以任务函数的返回值为准，忽略 context 并在超时后成功返回的任务视为执行成功
+func SetAsyncTimeoutOption(timeout time.Duration) infra.AsyncOption {
+	return func(opts *infra.AsyncJobOptions) {
+		opts.Timeout = timeout
+	}
+}
+
+// SetAsyncRetryOption 设置异步任务失败后的重试次数，以及第一次重试前的等待时间
+func SetAsyncRetryOption(maxRetries int, backoff time.Duration) infra.AsyncOption {
+	return func(opts *infra.AsyncJobOptions) {
+		opts.MaxRetries = maxRetries
+		opts.RetryBackoff = backoff
+	}
+}
+
 type asyncJob struct {
-	fn interface{}
+	fn   interface{}
+	opts infra.AsyncJobOptions
+
+	lock   sync.RWMutex
+	status infra.AsyncJobStatus
+	err    error
+	done   chan struct{}
+}
+
+func newAsyncJob(fn interface{}, options ...infra.AsyncOption) *asyncJob {
+	job := &asyncJob{fn: fn, status: infra.AsyncJobPending, done: make(chan struct{})}
+	for _, opt := range options {
+		opt(&job.opts)
+	}
+
+	if job.opts.Name == "" {
+		job.opts.Name = runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	}
+
+	if job.opts.RetryBackoff <= 0 {
+		job.opts.RetryBackoff = defaultAsyncRetryBackoff
+	}
+
+	return job
+}
+
+func (job *asyncJob) Name() string {
+	return job.opts.Name
+}
+
+func (job *asyncJob) Status() infra.AsyncJobStatus {
+	job.lock.RLock()
+	defer job.lock.RUnlock()
+
+	return job.status
+}
+
+func (job *asyncJob) Done() <-chan struct{} {
+	return job.done
+}
+
+func (job *asyncJob) Err() error {
+	job.lock.RLock()
+	defer job.lock.RUnlock()
+
+	return job.err
+}
+
+func (job *asyncJob) Wait(ctx context.Context) error {
+	select {
+	case <-job.done:
+		return job.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (job *asyncJob) setStatus(status infra.AsyncJobStatus) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	job.status = status
+}
+
+// finish 设置任务的最终状态，status 为 AsyncJobRejected 时表示任务没有被执行
+func (job *asyncJob) finish(status infra.AsyncJobStatus, err error) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	job.status = status
+	job.err = err
+	close(job.done)
+}
+
+// call 执行一次任务，任务函数可以注入 context.Context，它会在超时或者应用停机时被取消
+// 任务函数的最后一个返回值如果是非空的 error，则认为任务执行失败，每次执行（包括重试）都在独立的作用域中进行
+func (job *asyncJob) call(ctx context.Context, resolver infra.Resolver) (err error) {
+	if job.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.opts.Timeout)
+		defer cancel()
+	}
+
+	if scope := infra.OpenScope(ctx, resolver, infra.ScopeAsync); scope != nil {
+		defer scope.Close()
+		resolver = scope
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("async job %s panic: %v", job.Name(), rec)
+		}
+	}()
+
+	results, err := resolver.CallWithProvider(job.fn, resolver.Provider(func() context.Context { return ctx }))
+	if err != nil {
+		return err
+	}
+
+	if len(results) > 0 {
+		if e, ok := results[len(results)-1].(error); ok && e != nil {
+			if job.opts.Timeout > 0 && errors.Is(e, context.DeadlineExceeded) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("async job %s timed out after %s: %w", job.Name(), job.opts.Timeout, e)
+			}
+
+			return e
+		}
+	}
+
+	return nil
 }
 
-func (aj asyncJob) Call(resolver infra.Resolver) error {
-	return resolver.Resolve(aj.fn)
+// run 执行任务，失败后按照配置进行重试，应用停机后不再重试
+func (job *asyncJob) run(ctx context.Context, resolver infra.Resolver, clock infra.Clock) error {
+	backoff := job.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		job.setStatus(infra.AsyncJobRunning)
+
+		err := job.call(ctx, resolver)
+		if err == nil || attempt >= job.opts.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		if infra.WARN {
+			log.Warningf("[glacier] async job %s failed: %v, retry in %s (%d/%d)", job.Name(), err, backoff, attempt+1, job.opts.MaxRetries)
+		}
+
+		timer := clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C():
+		}
+
+		backoff *= 2
+	}
 }
 
-// Async 添加一个异步执行函数
+// Async 添加异步执行函数
 func (impl *framework) Async(fns ...interface{}) {
 	for i, fn := range fns {
-		if reflect.TypeOf(fn).Kind() != reflect.Func {
+		if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
 			panic(fmt.Errorf("invalid argument: fn at %d must be a func", i))
 		}
 
-		impl.lock.Lock()
-		if impl.status == Started {
-			impl.asyncJobChannel <- asyncJob{fn: fn}
-		} else {
-			impl.asyncJobs = append(impl.asyncJobs, asyncJob{fn: fn})
+		impl.AsyncJob(fn)
+	}
+}
+
+// AsyncJob 添加一个异步执行函数，返回任务句柄
+func (impl *framework) AsyncJob(fn interface{}, options ...infra.AsyncOption) infra.AsyncJob {
+	if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		panic(fmt.Errorf("invalid argument: async job must be a func"))
+	}
+
+	job := newAsyncJob(fn, options...)
+
+	impl.asyncLock.Lock()
+	if impl.asyncJobChannel == nil {
+		impl.asyncJobs = append(impl.asyncJobs, job)
+		impl.asyncLock.Unlock()
+		return job
+	}
+	impl.asyncLock.Unlock()
+
+	impl.dispatchAsyncJob(job)
+	return job
+}
+
+// WithAsyncQueue 设置异步任务队列容量以及队列已满时的处理策略
+func (impl *framework) WithAsyncQueue(size int, policy infra.AsyncOverflowPolicy) infra.Glacier {
+	if impl.status >= Initialized {
+		panic("[glacier] can not invoke this method after Glacier has been initialize")
+	}
+
+	// 容量为 0 的队列没有可以丢弃的任务，投递时只能等待空闲的执行器
+	if policy == infra.AsyncOverflowDropOldest && size <= 0 {
+		panic("[glacier] AsyncOverflowDropOldest requires an async queue with size > 0")
+	}
+
+	impl.asyncQueueSize = size
+	impl.asyncOverflowPolicy = policy
+	return impl
+}
+
+// dispatchAsyncJob 将任务投递到任务队列
+func (impl *framework) dispatchAsyncJob(job *asyncJob) {
+	impl.asyncLock.RLock()
+	defer impl.asyncLock.RUnlock()
+
+	if impl.asyncClosed {
+		job.finish(infra.AsyncJobRejected, ErrAsyncJobRejected)
+		return
+	}
+
+	switch impl.asyncOverflowPolicy {
+	case infra.AsyncOverflowReject:
+		select {
+		case impl.asyncJobChannel <- job:
+		default:
+			job.finish(infra.AsyncJobRejected, ErrAsyncQueueFull)
+		}
+	case infra.AsyncOverflowDropOldest:
+		for {
+			select {
+			case impl.asyncJobChannel <- job:
+				return
+			default:
+			}
+
+			select {
+			case dropped := <-impl.asyncJobChannel:
+				if infra.WARN {
+					log.Warningf("[glacier] async job %s dropped because the queue is full", dropped.Name())
+				}
+				dropped.finish(infra.AsyncJobRejected, ErrAsyncJobDropped)
+			default:
+			}
+		}
+	default:
+		select {
+		case impl.asyncJobChannel <- job:
+		case <-impl.asyncStopping:
+			job.finish(infra.AsyncJobRejected, ErrAsyncJobRejected)
 		}
-		impl.lock.Unlock()
 	}
 }
 
-func (impl *framework) startAsyncRunners() <-chan interface{} {
+func (impl *framework) startAsyncRunners(ctx context.Context) <-chan interface{} {
 	stop := make(chan interface{})
 
 	var parentGraphNode *infra.GraphvizNode
@@ -45,10 +288,25 @@ func (impl *framework) startAsyncRunners() <-chan interface{} {
 		parentGraphNode.Style = infra.GraphvizNodeStyleImportant
 	}
 
-	impl.asyncJobChannel = make(chan asyncJob)
+	impl.asyncLock.Lock()
+	impl.asyncJobChannel = make(chan *asyncJob, impl.asyncQueueSize)
+	impl.asyncLock.Unlock()
+
 	impl.cc.MustResolve(func(gf infra.Graceful) {
-		gf.AddShutdownHandler(func() {
+		// 停机开始后，阻塞等待投递的任务立即被拒绝，避免停机过程被阻塞
+		gf.AddPreShutdownHandler(func() {
+			close(impl.asyncStopping)
+		})
+
+		// 关闭任务队列并等待队列中的任务执行完毕，该阶段早于取消 context 的 ShutdownPhaseDrainWorkers 阶段，
+		// 因此队列中的任务执行时 context 依然有效
+		infra.AddShutdownHandlerInPhase(gf, infra.ShutdownPhaseDrainAsyncJobs, func() {
+			impl.asyncLock.Lock()
+			impl.asyncClosed = true
 			close(impl.asyncJobChannel)
+			impl.asyncLock.Unlock()
+
+			<-stop
 		})
 	})
 
@@ -65,9 +323,13 @@ func (impl *framework) startAsyncRunners() <-chan interface{} {
 			defer wg.Done()
 
 			for job := range impl.asyncJobChannel {
-				if err := job.Call(impl.cc); err != nil {
-					log.Errorf("[glacier] async runner [async-runner-%d] failed: %v", i, err)
+				if err := job.run(ctx, impl.cc, impl.clock); err != nil {
+					log.Errorf("[glacier] async runner [async-runner-%d] job %s failed: %v", i, job.Name(), err)
+					job.finish(infra.AsyncJobFailed, err)
+					continue
 				}
+
+				job.finish(infra.AsyncJobSucceeded, nil)
 			}
 
 			if infra.DEBUG {
@@ -95,11 +357,12 @@ func (impl *framework) startAsyncRunners() <-chan interface{} {
 }
 
 func (impl *framework) consumeAsyncJobs() {
-	impl.lock.Lock()
-	defer impl.lock.Unlock()
+	impl.asyncLock.Lock()
+	jobs := impl.asyncJobs
+	impl.asyncJobs = nil
+	impl.asyncLock.Unlock()
 
-	for _, job := range impl.asyncJobs {
-		impl.asyncJobChannel <- job
+	for _, job := range jobs {
+		impl.dispatchAsyncJob(job)
 	}
-	impl.asyncJobs = nil
 }
@@ -0,0 +1,138 @@
+package glacier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/clock"
+	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+func TestAsyncJobRetry(t *testing.T) {
+	var attempts int
+	job := newAsyncJob(func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, SetAsyncRetryOption(3, time.Millisecond), SetAsyncNameOption("retry-job"))
+
+	if err := job.run(context.Background(), ioc.New(), clock.System()); err != nil {
+		t.Fatalf("expect job succeeded, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("expect 3 attempts, got %d", attempts)
+	}
+
+	if job.Name() != "retry-job" {
+		t.Errorf("unexpected job name: %s", job.Name())
+	}
+}
+
+func TestAsyncJobTimeout(t *testing.T) {
+	job := newAsyncJob(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, SetAsyncTimeoutOption(10*time.Millisecond))
+
+	if err := job.run(context.Background(), ioc.New(), clock.System()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect timeout error, got %v", err)
+	}
+
+	// 忽略 context 并在超时后成功返回的任务视为执行成功
+	job = newAsyncJob(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, SetAsyncTimeoutOption(10*time.Millisecond))
+
+	if err := job.run(context.Background(), ioc.New(), clock.System()); err != nil {
+		t.Fatalf("expect job succeeded, got %v", err)
+	}
+}
+
+func startAsyncTestApp(t *testing.T, impl *framework) infra.Application {
+	impl.Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+
+	app := impl.StartAsync(NewFlagContext())
+	select {
+	case <-app.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("application is not ready")
+	}
+
+	return app
+}
+
+func TestAsyncQueueOverflow(t *testing.T) {
+	impl := New("1.0", 0).(*framework)
+	impl.WithAsyncQueue(1, infra.AsyncOverflowReject)
+	app := startAsyncTestApp(t, impl)
+
+	first := impl.AsyncJob(func() {})
+	second := impl.AsyncJob(func() {})
+
+	if first.Status() != infra.AsyncJobPending {
+		t.Errorf("expect first job pending, got %s", first.Status())
+	}
+
+	if err := second.Wait(context.Background()); !errors.Is(err, ErrAsyncQueueFull) {
+		t.Errorf("expect queue full error, got %v", err)
+	}
+
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := impl.AsyncJob(func() {}).Wait(context.Background()); !errors.Is(err, ErrAsyncJobRejected) {
+		t.Errorf("expect rejected error, got %v", err)
+	}
+}
+
+func TestAsyncJobsDrainBeforeCancel(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.WithAsyncQueue(10, infra.AsyncOverflowBlock)
+	app := startAsyncTestApp(t, impl)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	first := impl.AsyncJob(func() {
+		close(started)
+		<-release
+	})
+	queued := impl.AsyncJob(func(ctx context.Context) error { return ctx.Err() })
+
+	<-started
+	stopped := make(chan error)
+	go func() { stopped <- app.Stop(context.Background()) }()
+
+	// 停机开始后，队列中的任务依然会在 context 取消之前执行
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Status() != infra.AsyncJobSucceeded {
+		t.Errorf("expect first job succeeded, got %s", first.Status())
+	}
+
+	if err := queued.Wait(context.Background()); err != nil || queued.Status() != infra.AsyncJobSucceeded {
+		t.Errorf("queued job should run with a live context, got %s, %v", queued.Status(), err)
+	}
+}
+
+func TestAsyncInvalidJob(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expect panic for nil async job")
+		}
+	}()
+
+	New("1.0", 1).Async(nil)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"runtime/debug"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/mylxsw/glacier/log"
 
+	"github.com/mylxsw/glacier/clock"
 	"github.com/mylxsw/glacier/infra"
 	"github.com/pkg/errors"
 	"github.com/robfig/cron/v3"
@@ -38,6 +40,8 @@ type Scheduler interface {
 	Continue(name string) error
 	// Info get job info
 	Info(name string) (Job, error)
+	// Jobs 返回所有的定时任务，按照名称排序
+	Jobs() []Job
 
 	// Start cron manager
 	Start()
@@ -60,10 +64,18 @@ type schedulerImpl struct {
 	lock     sync.RWMutex
 	resolver infra.Resolver
 	cr       *cron.Cron
+	clock    infra.Clock
+	// ctx 应用的 context，任务执行时的作用域基于它创建，应用停机时会被取消
+	ctx context.Context
 
 	lockManagerBuilder LockManagerBuilder
 
 	jobs map[string]*Job
+
+	// changed 任务列表发生变化时通知调度循环重新计算下次触发时间
+	changed chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
 }
 
 // Job is a job object
@@ -74,6 +86,8 @@ type Job struct {
 	handler     func()
 	Paused      bool
 	lockManager LockManager
+	clock       infra.Clock
+	location    *time.Location
 }
 
 // Next get execute plan for job
@@ -86,6 +100,14 @@ func (job Job) Next(nextNum int) ([]time.Time, error) {
 
 	results := make([]time.Time, nextNum)
 	lastTs := time.Now()
+	if job.clock != nil {
+		lastTs = job.clock.Now()
+	}
+
+	if job.location != nil {
+		lastTs = lastTs.In(job.location)
+	}
+
 	for i := 0; i < nextNum; i++ {
 		lastTs = sc.Next(lastTs)
 		results[i] = lastTs
@@ -96,8 +118,12 @@ func (job Job) Next(nextNum int) ([]time.Time, error) {
 
 // NewManager create a new Scheduler
 func NewManager(resolver infra.Resolver) Scheduler {
-	m := schedulerImpl{resolver: resolver, jobs: make(map[string]*Job)}
+	m := schedulerImpl{resolver: resolver, jobs: make(map[string]*Job), clock: clock.System(), ctx: context.Background(), changed: make(chan struct{}, 1)}
 	resolver.MustResolve(func(cr *cron.Cron) { m.cr = cr })
+	// 容器中绑定了 Clock 时（框架默认绑定），使用它计算任务耗时，非系统时间的 Clock 还会用来触发定时任务
+	_ = resolver.Resolve(func(c infra.Clock) { m.clock = c })
+	// 容器中绑定了应用的 context 时（框架默认绑定），任务执行的作用域会在应用停机时被取消
+	_ = resolver.Resolve(func(ctx context.Context) { m.ctx = ctx })
 
 	return &m
 }
@@ -161,7 +187,10 @@ func (c *schedulerImpl) add(name string, plan string, handler interface{}) (func
 		handler:     jobHandler,
 		Paused:      false,
 		lockManager: lockManager,
+		clock:       c.clock,
+		location:    c.cr.Location(),
 	}
+	c.notifyChanged()
 
 	if infra.DEBUG {
 		log.Debugf("[glacier] add job [%s] to scheduler(%s)", name, plan)
@@ -196,17 +225,23 @@ func (c *schedulerImpl) wrapJobHandler(name string, handler interface{}, lockMan
 			log.Debugf("[glacier] cron job [%s] running", name)
 		}
 
-		startTs := time.Now()
+		startTs := c.clock.Now()
 		defer func() {
 			if err := recover(); err != nil {
-				log.Errorf("[glacier] cron job [%s] stopped with some errors: %v, took %s", name, err, time.Since(startTs))
+				log.Errorf("[glacier] cron job [%s] stopped with some errors: %v, took %s", name, err, c.clock.Since(startTs))
 			} else {
 				if infra.DEBUG {
-					log.Debugf("[glacier] cron job [%s] stopped, took %s", name, time.Since(startTs))
+					log.Debugf("[glacier] cron job [%s] stopped, took %s", name, c.clock.Since(startTs))
 				}
 			}
 		}()
-		if err := c.resolver.Resolve(hh.Handle); err != nil {
+		resolver := c.resolver
+		if scope := infra.OpenScope(c.ctx, c.resolver, infra.ScopeCron); scope != nil {
+			defer scope.Close()
+			resolver = scope
+		}
+
+		if err := resolver.Resolve(hh.Handle); err != nil {
 			log.Errorf("[glacier] cron job [%s] failed, Err: %v, Stack: \n%s", name, err, debug.Stack())
 		}
 	}
@@ -230,6 +265,7 @@ func (c *schedulerImpl) Remove(name string) error {
 	delete(c.jobs, name)
 	if !reg.Paused {
 		c.cr.Remove(reg.ID)
+		c.notifyChanged()
 	}
 
 	if infra.DEBUG {
@@ -253,6 +289,7 @@ func (c *schedulerImpl) Pause(name string) error {
 	}
 
 	c.cr.Remove(reg.ID)
+	c.notifyChanged()
 	reg.Paused = true
 
 	if infra.DEBUG {
@@ -282,6 +319,7 @@ func (c *schedulerImpl) Continue(name string) error {
 
 	reg.Paused = false
 	reg.ID = id
+	c.notifyChanged()
 
 	if infra.DEBUG {
 		log.Debugf("[glacier] change job [%s] to continue", name)
@@ -301,11 +339,42 @@ func (c *schedulerImpl) Info(name string) (Job, error) {
 	return Job{}, fmt.Errorf("[glacier] job with name [%s] not found", name)
 }
 
+// Jobs 返回所有的定时任务，按照名称排序
+func (c *schedulerImpl) Jobs() []Job {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	jobs := make([]Job, 0, len(c.jobs))
+	for _, job := range c.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// Start 启动定时任务调度
+// 使用系统时间时由 cron.Cron 自己调度，cron.Cron 的配置（比如 WithLocation）以及直接添加到 cron.Cron 中的任务都能正常生效；
+// 使用其它 Clock（比如测试中的 clock.Fake）时，由 Clock 驱动的调度循环触发任务
 func (c *schedulerImpl) Start() {
-	c.cr.Start()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if clock.IsSystem(c.clock) {
+		c.cr.Start()
+		return
+	}
+
+	if c.stop != nil {
+		return
+	}
+
+	c.stop, c.stopped = make(chan struct{}), make(chan struct{})
+	go c.run(c.stop, c.stopped)
 }
 
 func (c *schedulerImpl) Stop() {
+	c.lock.Lock()
 	if c.lockManagerBuilder != nil {
 		for _, job := range c.jobs {
 			if job.lockManager != nil {
@@ -316,5 +385,83 @@ func (c *schedulerImpl) Stop() {
 		}
 	}
 
+	stop, stopped := c.stop, c.stopped
+	c.stop, c.stopped = nil, nil
+	c.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-stopped
+		return
+	}
+
 	c.cr.Stop()
 }
+
+// notifyChanged 通知调度循环任务列表发生了变化
+func (c *schedulerImpl) notifyChanged() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run 使用非系统时间的 Clock 时的调度循环，cron.Cron 只用于保存任务及其执行计划，任务的触发时间通过 Clock 计算，
+// 这样在测试中可以使用 fake clock 控制任务的触发。执行计划按照 cron.Cron 的时区计算，
+// 但是 cron.Entry 的 Next/Prev 不会更新，直接添加到 cron.Cron 中的任务要等到下一次调度时才会被发现
+func (c *schedulerImpl) run(stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	next := make(map[cron.EntryID]time.Time)
+	for {
+		now := c.clock.Now().In(c.cr.Location())
+		entries := c.cr.Entries()
+
+		// 重新计算每个任务的下次触发时间，已经计算过的任务保持不变，已删除的任务被丢弃
+		current := make(map[cron.EntryID]time.Time, len(entries))
+		var earliest time.Time
+		for _, entry := range entries {
+			ts, ok := next[entry.ID]
+			if !ok {
+				ts = entry.Schedule.Next(now)
+			}
+
+			if ts.IsZero() {
+				continue
+			}
+
+			current[entry.ID] = ts
+			if earliest.IsZero() || ts.Before(earliest) {
+				earliest = ts
+			}
+		}
+		next = current
+
+		var timer infra.Timer
+		var fire <-chan time.Time
+		if !earliest.IsZero() {
+			timer = c.clock.NewTimer(earliest.Sub(now))
+			fire = timer.C()
+		}
+
+		select {
+		case now = <-fire:
+			now = now.In(c.cr.Location())
+			for _, entry := range entries {
+				if ts, ok := next[entry.ID]; ok && !ts.After(now) {
+					go entry.WrappedJob.Run()
+					next[entry.ID] = entry.Schedule.Next(now)
+				}
+			}
+		case <-c.changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
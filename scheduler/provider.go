@@ -44,7 +44,7 @@ func (p *provider) Boot(app infra.Resolver) {
 
 func (p *provider) Daemon(ctx context.Context, app infra.Resolver) {
 	app.MustResolve(func(gf infra.Graceful, cr Scheduler, logger infra.Logger) {
-		gf.AddShutdownHandler(cr.Stop)
+		infra.AddShutdownHandlerInPhase(gf, infra.ShutdownPhaseStopTraffic, cr.Stop)
 		cr.Start()
 		<-ctx.Done()
 	})
@@ -0,0 +1,174 @@
+package glacier
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
+	"github.com/mylxsw/go-ioc"
+)
+
+// Scoped 添加作用域绑定，每个 HTTP 请求、定时任务执行、事件分发、异步任务都会创建独立的作用域
+func (impl *framework) Scoped(ins ...interface{}) infra.Glacier {
+	if impl.status >= Initialized {
+		panic("[glacier] can not invoke this method after Glacier has been initialize")
+	}
+
+	for _, i := range ins {
+		validateScopedInitializer(i)
+	}
+
+	impl.scoped = append(impl.scoped, ins...)
+	return impl
+}
+
+func validateScopedInitializer(ins interface{}) {
+	typ := reflect.TypeOf(ins)
+	if typ == nil || typ.Kind() != reflect.Func || typ.NumOut() == 0 {
+		panic(fmt.Errorf("[glacier] invalid scoped initializer %T: it must be a func with at least one return value", ins))
+	}
+}
+
+// scopeFactory 作用域工厂，作用域是全局容器（或者指定父容器）的子容器，作用域绑定会注册到每个子容器中
+type scopeFactory struct {
+	cc ioc.Container
+
+	lock         sync.RWMutex
+	initializers []interface{}
+}
+
+func newScopeFactory(cc ioc.Container) *scopeFactory {
+	return &scopeFactory{cc: cc, initializers: make([]interface{}, 0)}
+}
+
+func (f *scopeFactory) Scoped(initializers ...interface{}) {
+	for _, i := range initializers {
+		validateScopedInitializer(i)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.initializers = append(f.initializers, initializers...)
+}
+
+func (f *scopeFactory) HasScoped() bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return len(f.initializers) > 0
+}
+
+func (f *scopeFactory) NewScope(ctx context.Context, kind infra.ScopeKind, parent infra.Container) infra.Scope {
+	if parent == nil {
+		parent = f.cc
+	}
+
+	scope := &operationScope{Container: ioc.Extend(parent), kind: kind, ctx: ctx}
+	scope.MustSingletonOverride(func() infra.Scope { return scope })
+	scope.MustSingletonOverride(func() infra.Resolver { return scope })
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	for _, i := range f.initializers {
+		scope.MustSingletonOverride(scope.track(i))
+	}
+
+	return scope
+}
+
+// operationScope 一次操作对应的作用域
+type operationScope struct {
+	ioc.Container
+
+	kind infra.ScopeKind
+	ctx  context.Context
+
+	lock      sync.Mutex
+	instances []interface{}
+	closed    bool
+}
+
+func (s *operationScope) Kind() infra.ScopeKind {
+	return s.kind
+}
+
+func (s *operationScope) Context() context.Context {
+	return s.ctx
+}
+
+// track 包装作用域绑定的初始化函数，记录创建的对象，用于作用域结束时释放
+func (s *operationScope) track(initialize interface{}) interface{} {
+	fn := reflect.ValueOf(initialize)
+	return reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		if fn.Type().IsVariadic() {
+			results = fn.CallSlice(args)
+		} else {
+			results = fn.Call(args)
+		}
+
+		if last := results[len(results)-1]; len(results) > 1 && last.Type() == errorKind && !last.IsNil() {
+			return results
+		}
+
+		if ins := results[0]; (ins.Kind() == reflect.Ptr || ins.Kind() == reflect.Interface) && ins.IsNil() {
+			return results
+		}
+
+		switch results[0].Interface().(type) {
+		case interface{ Close() error }, interface{ Close() }:
+			s.lock.Lock()
+			s.instances = append(s.instances, results[0].Interface())
+			s.lock.Unlock()
+		}
+
+		return results
+	}).Interface()
+}
+
+// Close 按照创建顺序的逆序释放作用域中创建的对象，返回第一个释放失败的错误
+func (s *operationScope) Close() (err error) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+
+	s.closed = true
+	instances := s.instances
+	s.instances = nil
+	s.lock.Unlock()
+
+	for i := len(instances) - 1; i >= 0; i-- {
+		if e := closeScopedInstance(instances[i]); e != nil {
+			log.Errorf("[glacier] %s scope: close %T failed: %v", s.kind, instances[i], e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+
+	return err
+}
+
+func closeScopedInstance(ins interface{}) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+
+	switch c := ins.(type) {
+	case interface{ Close() error }:
+		return c.Close()
+	case interface{ Close() }:
+		c.Close()
+	}
+
+	return nil
+}
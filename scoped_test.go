@@ -0,0 +1,88 @@
+package glacier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+type scopedTx struct {
+	closed *[]string
+	name   string
+}
+
+func (tx *scopedTx) Close() error {
+	*tx.closed = append(*tx.closed, tx.name)
+	return nil
+}
+
+type scopedLogger struct{ tx *scopedTx }
+
+func (l *scopedLogger) Close() {
+	*l.tx.closed = append(*l.tx.closed, "logger")
+}
+
+func TestScopedLifetime(t *testing.T) {
+	closed := make([]string, 0)
+	created := 0
+
+	factory := newScopeFactory(ioc.New())
+	if factory.HasScoped() {
+		t.Error("expect no scoped bindings")
+	}
+
+	factory.Scoped(
+		func(scope infra.Scope) *scopedTx {
+			created++
+			return &scopedTx{closed: &closed, name: string(scope.Kind())}
+		},
+		func(tx *scopedTx) *scopedLogger { return &scopedLogger{tx: tx} },
+	)
+
+	if !factory.HasScoped() {
+		t.Error("expect scoped bindings")
+	}
+
+	scope := factory.NewScope(context.Background(), infra.ScopeHTTP, nil)
+	scope.MustResolve(func(tx1 *scopedTx, logger *scopedLogger, tx2 *scopedTx) {
+		if tx1 != tx2 || logger.tx != tx1 {
+			t.Error("scoped binding should be created once per scope")
+		}
+	})
+
+	other := factory.NewScope(context.Background(), infra.ScopeCron, nil)
+	other.MustResolve(func(*scopedTx) {})
+	if created != 2 {
+		t.Errorf("expect each scope has its own instance, created %d", created)
+	}
+
+	if err := scope.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = scope.Close()
+
+	if len(closed) != 2 || closed[0] != "logger" || closed[1] != "http" {
+		t.Errorf("expect scoped instances closed once in reverse order, got %v", closed)
+	}
+}
+
+func TestOpenScope(t *testing.T) {
+	cc := ioc.New()
+	if infra.OpenScope(context.Background(), cc, infra.ScopeAsync) != nil {
+		t.Error("expect no scope when ScopeFactory is not bound")
+	}
+
+	cc.MustSingleton(func() infra.ScopeFactory { return newScopeFactory(cc) })
+	scope := infra.OpenScope(context.Background(), cc, infra.ScopeAsync)
+	if scope == nil || scope.Kind() != infra.ScopeAsync {
+		t.Fatalf("expect an async scope, got %v", scope)
+	}
+
+	scope.MustResolve(func(resolver infra.Resolver) {
+		if resolver != infra.Resolver(scope) {
+			t.Error("resolver in scope should be the scope itself")
+		}
+	})
+}
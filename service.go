@@ -8,13 +8,21 @@ import (
 	"sync"
 
 	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
 	"github.com/mylxsw/glacier/log"
+	"github.com/mylxsw/go-ioc"
 	"github.com/mylxsw/go-utils/array"
 )
 
 type serviceEntry struct {
 	service infra.Service
 	name    string
+	// level 服务在依赖关系中所处的层级，层级越高的服务越晚启动，越早停止
+	level int
+	// skipReason 服务不会被加载的原因
+	skipReason string
+	// profiles 通过 ForProfiles 注册时指定的运行环境
+	profiles []string
 }
 
 func newServiceEntry(srv infra.Service) *serviceEntry {
@@ -25,6 +33,18 @@ func (s serviceEntry) Name() string {
 	return s.name
 }
 
+func (s serviceEntry) module() interface{} {
+	return s.service
+}
+
+func (s serviceEntry) dependsOn() []interface{} {
+	if dep, ok := s.service.(infra.ServiceDependency); ok {
+		return array.Map(dep.DependsOn(), func(item infra.Service, _ int) interface{} { return item })
+	}
+
+	return nil
+}
+
 // Service add a service
 func (impl *framework) Service(services ...infra.Service) {
 	for _, p := range services {
@@ -38,26 +58,36 @@ func (impl *framework) Service(services ...infra.Service) {
 
 // registerServices 注册所有的 Services
 func (impl *framework) registerServices() error {
+	services, _, err := impl.filterServiceEntries(impl.cc, impl.services, nil, true)
+	if err != nil {
+		return err
+	}
+
+	impl.services = services
+	return impl.registerServiceEntries(impl.cc, services)
+}
+
+// registerServiceEntries 使用 cc 为 services 注入依赖，services 应该已经过滤并排好序
+func (impl *framework) registerServiceEntries(cc ioc.Container, services []*serviceEntry) error {
 	var parentGraphNode *infra.GraphvizNode
 	var childGraphNodes []*infra.GraphvizNode
-	if infra.DEBUG && len(impl.services) > 0 {
+	if infra.DEBUG && len(services) > 0 {
 		parentGraphNode = impl.pushGraphvizNode("register services", false)
 		parentGraphNode.Style = infra.GraphvizNodeStyleImportant
 	}
 
-	impl.services = impl.servicesFilter()
-	for _, s := range impl.services {
+	for _, s := range services {
 		if infra.DEBUG {
 			childGraphNodes = append(childGraphNodes, impl.pushGraphvizNode(fmt.Sprintf("register service %s", s.Name()), false, parentGraphNode))
 		}
-		if reflect.ValueOf(s).Kind() == reflect.Ptr {
-			if err := impl.cc.AutoWire(s); err != nil {
-				return fmt.Errorf("[glacier] service %s autowired failed: %v", reflect.TypeOf(s).String(), err)
+		if reflect.ValueOf(s.service).Kind() == reflect.Ptr {
+			if err := cc.AutoWire(s.service); err != nil {
+				return fmt.Errorf("[glacier] service %s autowired failed: %v", s.Name(), err)
 			}
 		}
 	}
 
-	if infra.DEBUG && len(impl.services) > 0 {
+	if infra.DEBUG && len(services) > 0 {
 		impl.pushGraphvizNode("register services done", false, childGraphNodes...)
 	}
 
@@ -65,15 +95,20 @@ func (impl *framework) registerServices() error {
 }
 
 func (impl *framework) initServices() error {
+	return impl.initServiceEntries(impl.cc, impl.services)
+}
+
+// initServiceEntries 依次执行 services 的 Init 方法，cc 为 Init 方法接收的容器
+func (impl *framework) initServiceEntries(cc ioc.Container, services []*serviceEntry) error {
 	var parentGraphNode *infra.GraphvizNode
 	var childGraphNodes []*infra.GraphvizNode
-	if infra.DEBUG && len(impl.services) > 0 {
+	if infra.DEBUG && len(services) > 0 {
 		parentGraphNode = impl.pushGraphvizNode("init services", false)
 		parentGraphNode.Style = infra.GraphvizNodeStyleImportant
 	}
 	// initialize all services
 	var initializedServicesCount int
-	for _, s := range impl.services {
+	for _, s := range services {
 		if srv, ok := s.service.(infra.Initializer); ok {
 			if infra.DEBUG {
 				childGraphNodes = append(childGraphNodes, impl.pushGraphvizNode(fmt.Sprintf("init service %s", s.Name()), false, parentGraphNode))
@@ -81,9 +116,13 @@ func (impl *framework) initServices() error {
 			}
 
 			initializedServicesCount++
-			if err := srv.Init(impl.cc); err != nil {
+			startTs := impl.clock.Now()
+			err := srv.Init(cc)
+			took := impl.recordStartupStep(s.Name(), infra.StartupStepInit, startTs)
+			if err != nil {
 				return fmt.Errorf("[glacier] service %s initialize failed: %v", s.Name(), err)
 			}
+			impl.publishLifecycleEvent(lifecycle.ServiceInitialized{Name: s.Name(), Time: impl.clock.Now(), Duration: took})
 		}
 	}
 
@@ -95,45 +134,43 @@ func (impl *framework) initServices() error {
 	return nil
 }
 
+// startServices 按照依赖顺序在独立的 goroutine 中启动所有服务，依赖关系只决定 Start 的调用顺序，不会等待被依赖的服务就绪
 func (impl *framework) startServices(ctx context.Context, wg *sync.WaitGroup) error {
-	wg.Add(len(impl.services))
+	var gf infra.Graceful
+	impl.cc.MustResolve(func(g infra.Graceful) { gf = g })
+
+	return impl.startServiceEntries(ctx, gf, impl.services, wg)
+}
+
+// startServiceEntries 启动 services，服务的 reload、停止以及异常退出时的停机都作用于 gf
+func (impl *framework) startServiceEntries(ctx context.Context, gf infra.Graceful, services []*serviceEntry, wg *sync.WaitGroup) error {
+	wg.Add(len(services))
 
 	var parentGraphNode *infra.GraphvizNode
 	var childGraphNodes []*infra.GraphvizNode
-	if infra.DEBUG && len(impl.services) > 0 {
+	if infra.DEBUG && len(services) > 0 {
 		parentGraphNode = impl.pushGraphvizNode("start services", false)
 		parentGraphNode.Style = infra.GraphvizNodeStyleImportant
 	}
 
+	// 服务按照依赖关系逆序停止，被依赖的服务总是在依赖它的服务停止之后才停止
+	gf.AddShutdownHandler(func() { stopServices(services) })
+
 	var startedServicesCount int
-	for _, s := range impl.services {
+	for _, s := range services {
 		if infra.DEBUG {
 			childGraphNodes = append(childGraphNodes, impl.pushGraphvizNode(fmt.Sprintf("start service %s", s.Name()), true, parentGraphNode))
 			log.Debugf("[glacier] service %s starting ...", s.Name())
 		}
 
+		if srv, ok := s.service.(infra.Reloadable); ok {
+			gf.AddReloadHandler(srv.Reload)
+		}
+
+		startedServicesCount++
 		go func(s *serviceEntry) {
 			defer wg.Done()
-
-			impl.cc.MustResolve(func(gf infra.Graceful) {
-				if srv, ok := s.service.(infra.Stoppable); ok {
-					gf.AddShutdownHandler(srv.Stop)
-				}
-
-				if srv, ok := s.service.(infra.Reloadable); ok {
-					gf.AddReloadHandler(srv.Reload)
-				}
-
-				startedServicesCount++
-				if err := s.service.Start(); err != nil {
-					log.Errorf("[glacier] service %s stopped with error: %v", s.Name(), err)
-					return
-				}
-
-				if infra.DEBUG {
-					log.Debugf("[glacier] service %s stopped", s.Name())
-				}
-			})
+			impl.superviseService(ctx, gf, s)
 		}(s)
 	}
 
@@ -145,11 +182,73 @@ func (impl *framework) startServices(ctx context.Context, wg *sync.WaitGroup) er
 	return nil
 }
 
+// stopServices 按照服务所在层级从高到低依次停止所有 Stoppable 服务，同一层级的服务并发停止
+func stopServices(services []*serviceEntry) {
+	levels := array.GroupBy(
+		array.Filter(services, func(s *serviceEntry, _ int) bool {
+			_, ok := s.service.(infra.Stoppable)
+			return ok
+		}),
+		func(s *serviceEntry) int { return s.level },
+	)
+
+	maxLevel := -1
+	for level := range levels {
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	for level := maxLevel; level >= 0; level-- {
+		var wg sync.WaitGroup
+		for _, s := range levels[level] {
+			wg.Add(1)
+			go func(s *serviceEntry) {
+				defer func() {
+					if err := recover(); err != nil {
+						log.Errorf("[glacier] stop service %s failed: %v", s.Name(), err)
+					}
+					wg.Done()
+				}()
+
+				if infra.DEBUG {
+					log.Debugf("[glacier] stopping service %s", s.Name())
+				}
+				s.service.(infra.Stoppable).Stop()
+			}(s)
+		}
+		wg.Wait()
+	}
+}
+
 // servicesFilter 预处理 services，排除不需要加载的 services
-func (impl *framework) servicesFilter() []*serviceEntry {
+func (impl *framework) servicesFilter() ([]*serviceEntry, error) {
+	services, _, err := impl.filterServices()
+	return services, err
+}
+
+// filterServices 返回排好序的需要加载的 services，以及不需要加载的 services
+func (impl *framework) filterServices() ([]*serviceEntry, []*serviceEntry, error) {
+	return impl.filterServiceEntries(impl.cc, impl.services, nil, false)
+}
+
+// filterServiceEntries 过滤并排序 entries，cc 为调用 ShouldLoad 方法使用的容器
+// loaded 为已经加载的 services，依赖这些 service 时视为依赖已经满足，record 为 true 时记录 ShouldLoad 的启动耗时
+func (impl *framework) filterServiceEntries(cc ioc.Container, entries []*serviceEntry, loaded []*serviceEntry, record bool) ([]*serviceEntry, []*serviceEntry, error) {
 	services := make([]*serviceEntry, 0)
-	for _, s := range impl.services {
-		if !impl.shouldLoadModule(reflect.ValueOf(s.service)) {
+	skipped := make([]*serviceEntry, 0)
+	for _, s := range entries {
+		if reason := impl.profileSkipReason(s.profiles, s.service); reason != "" {
+			s.skipReason = reason
+		} else if !impl.shouldLoadModule(cc, s.Name(), reflect.ValueOf(s.service), record) {
+			s.skipReason = "ShouldLoad()=false"
+		} else {
+			s.skipReason = ""
+		}
+
+		if s.skipReason != "" {
+			log.Infof("[glacier] service %s is skipped because %s", s.Name(), s.skipReason)
+			skipped = append(skipped, s)
 			continue
 		}
 
@@ -168,7 +267,17 @@ func (impl *framework) servicesFilter() []*serviceEntry {
 	}
 
 	sort.Sort(Services(services))
-	return services
+
+	sorted, levels, err := sortByDependency("service", services, skipped, loaded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, s := range sorted {
+		s.level = levels[i]
+	}
+
+	return sorted, skipped, nil
 }
 
 type Services []*serviceEntry
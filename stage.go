@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/health"
+	"github.com/mylxsw/glacier/lifecycle"
 	"github.com/mylxsw/glacier/log"
 	"github.com/mylxsw/go-ioc"
 
@@ -16,6 +18,8 @@ import (
 
 // initStage 框架初始化阶段
 func (impl *framework) initStage(flagCtx infra.FlagContext) error {
+	defer impl.lifecycleStage(lifecycle.StageInit)()
+
 	if infra.DEBUG {
 		impl.pushGraphvizNode("initStage", false).Type = infra.GraphvizNodeTypeClusterStart
 		defer func() {
@@ -24,15 +28,10 @@ func (impl *framework) initStage(flagCtx infra.FlagContext) error {
 	}
 
 	// 执行初始化钩子，用于在框架运行前执行一系列的前置操作
-	if impl.init != nil {
-		if infra.DEBUG {
-			impl.pushGraphvizNode("invoke init hook", false).Style = infra.GraphvizNodeStyleHook
-		}
-
-		if err := impl.init(flagCtx); err != nil {
-			return err
-		}
-
+	if err := impl.initHooks.run(impl, "init", func(fn interface{}) error {
+		return fn.(func(fc infra.FlagContext) error)(flagCtx)
+	}); err != nil {
+		return err
 	}
 
 	// 初始化日志实现
@@ -48,6 +47,8 @@ func (impl *framework) initStage(flagCtx infra.FlagContext) error {
 
 // diBindStage 初始化依赖注入容器阶段
 func (impl *framework) diBindStage(ctx context.Context, flagCtx infra.FlagContext) error {
+	defer impl.lifecycleStage(lifecycle.StageDIBind)()
+
 	if infra.DEBUG {
 		impl.pushGraphvizNode("diBindStage", false).Type = infra.GraphvizNodeTypeClusterStart
 		defer func() {
@@ -58,61 +59,106 @@ func (impl *framework) diBindStage(ctx context.Context, flagCtx infra.FlagContex
 	}
 
 	impl.cc = ioc.NewWithContext(ctx)
-
-	impl.cc.MustBindValue(infra.VersionKey, impl.version)
-	impl.cc.MustBindValue(infra.StartupTimeKey, impl.startTime)
-	impl.cc.MustSingleton(impl.buildFlagContext(flagCtx))
-	impl.cc.MustSingletonOverride(func() infra.Resolver { return impl.cc })
-	impl.cc.MustSingletonOverride(func() infra.Binder { return impl.cc })
-	impl.cc.MustSingletonOverride(func() infra.Hook { return impl })
+	impl.bindings.reset()
+	impl.scopes = newScopeFactory(impl.cc)
+
+	// 框架内置的绑定，允许被其它模块覆盖
+	binder := impl.binder(impl.cc, bindingModuleGlacier, "")
+	binder.MustBindValue(infra.VersionKey, impl.version)
+	binder.MustBindValue(infra.StartupTimeKey, impl.startTime)
+	binder.MustBindValue(infra.ProfileKey, impl.profile)
+	binder.MustSingleton(impl.buildFlagContext(flagCtx))
+	binder.MustSingletonOverride(func() infra.Resolver { return impl.cc })
+	binder.MustSingletonOverride(func() infra.Binder { return impl.cc })
+	binder.MustSingletonOverride(func() infra.Hook { return impl })
+	binder.MustSingletonOverride(func() lifecycle.Listener { return impl.lifecycle })
+	binder.MustSingletonOverride(func() infra.ModuleManager { return impl.modules })
+	binder.MustSingletonOverride(func() infra.ScopeFactory { return impl.scopes })
+	binder.MustSingletonOverride(func() infra.Clock { return impl.clock })
 
 	// 基本配置加载
-	impl.cc.MustSingletonOverride(ConfigLoader)
-	impl.cc.MustSingletonOverride(log.Default)
+	binder.MustSingletonOverride(ConfigLoader)
+	binder.MustSingletonOverride(log.Default)
+
+	// 健康检查
+	binder.MustSingletonOverride(func() health.Registry {
+		registry := health.NewRegistry(health.DefaultTimeout, health.DefaultCacheTTL)
+		if c, ok := registry.(infra.ClockAware); ok {
+			c.SetClock(impl.clock)
+		}
+
+		return registry
+	})
 
 	// 优雅停机
-	impl.cc.MustSingletonOverride(func(conf *Config) infra.Graceful {
+	binder.MustSingletonOverride(func(conf *Config) infra.Graceful {
+		var gf infra.Graceful
 		if impl.gracefulBuilder != nil {
-			return impl.gracefulBuilder()
+			gf = impl.gracefulBuilder()
+		} else {
+			gf = graceful.NewWithDefault(conf.ShutdownTimeout)
+		}
+
+		if c, ok := gf.(infra.ClockAware); ok {
+			c.SetClock(impl.clock)
+		}
+
+		if pt, ok := gf.(infra.ShutdownPhaseTimeoutAware); ok {
+			for _, phase := range impl.shutdownPhaseTimeouts {
+				pt.SetShutdownPhaseTimeout(phase, phase.Timeout)
+			}
+		} else if len(impl.shutdownPhaseTimeouts) > 0 && infra.WARN {
+			log.Warningf("[glacier] graceful %T does not support shutdown phase timeout, ignored", gf)
 		}
-		return graceful.NewWithDefault(conf.ShutdownTimeout)
+
+		return gf
 	})
 
 	// 注册全局对象
 	if infra.DEBUG {
 		impl.pushGraphvizNode("add singletons to container", false)
 	}
+	appBinder := impl.binder(impl.cc, bindingModuleApp, "")
 	for _, i := range impl.singletons {
-		impl.cc.MustSingletonOverride(i)
+		appBinder.MustSingletonOverride(i)
 	}
 
 	if infra.DEBUG {
 		impl.pushGraphvizNode("add prototypes to container", false)
 	}
 	for _, i := range impl.prototypes {
-		impl.cc.MustPrototypeOverride(i)
+		appBinder.MustPrototypeOverride(i)
 	}
 
-	// 完成预绑定对象的绑定
-	if impl.preBinder != nil {
-		if infra.DEBUG {
-			impl.pushGraphvizNode("invoke preBind hook", false).Style = infra.GraphvizNodeStyleHook
-			log.Debugf("[glacier] invoke pre-bind hook")
-		}
-		impl.preBinder(impl.cc)
+	if infra.DEBUG && len(impl.scoped) > 0 {
+		impl.pushGraphvizNode("add scoped bindings", false)
+	}
+	for _, i := range impl.scoped {
+		impl.bindings.mustBindScoped(impl.scopes, bindingModuleApp, i)
 	}
 
-	return nil
+	// 完成预绑定对象的绑定
+	return impl.preBindHooks.run(impl, "preBind", func(fn interface{}) error {
+		fn.(func(binder infra.Binder))(appBinder)
+		return nil
+	})
 }
 
+// Start 启动应用，阻塞直到应用停机
 func (impl *framework) Start(flagCtx infra.FlagContext) error {
+	return impl.start(flagCtx, nil)
+}
+
+// start 启动应用，app 不为空时，会在容器创建完成以及应用就绪时通知 app
+func (impl *framework) start(flagCtx infra.FlagContext, app *application) (err error) {
 	// 全局异常处理
 	defer func() {
-		if err := recover(); err != nil {
+		if rec := recover(); rec != nil {
 			if infra.DEBUG {
 				impl.pushGraphvizNode("global panic recover", false).Style = infra.GraphvizNodeStyleError
 			}
-			log.Criticalf("[glacier] application initialize failed with a panic, Err: %s, Stack: \n%s", err, debug.Stack())
+			log.Criticalf("[glacier] application initialize failed with a panic, Err: %s, Stack: \n%s", rec, debug.Stack())
+			err = fmt.Errorf("[glacier] application initialize failed with a panic: %v", rec)
 		}
 
 		if infra.DEBUG && infra.PrintGraph {
@@ -125,20 +171,31 @@ func (impl *framework) Start(flagCtx infra.FlagContext) error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	impl.initStage(flagCtx)
-	impl.diBindStage(ctx, flagCtx)
+	flagCtx = impl.activateProfile(flagCtx)
+	if err := impl.initStage(flagCtx); err != nil {
+		cancel()
+		return err
+	}
+
+	if err := impl.diBindStage(ctx, flagCtx); err != nil {
+		cancel()
+		return err
+	}
 
-	return impl.cc.Resolve(func(resolver infra.Resolver, gf infra.Graceful, conf *Config) error {
+	return impl.cc.Resolve(func(resolver infra.Resolver, gf infra.Graceful, conf *Config, healthRegistry health.Registry) error {
 		gf.AddShutdownHandler(cancel)
+		if app != nil {
+			app.bound(resolver, gf)
+		}
 
 		// 设置服务关闭钩子
-		if impl.beforeServerStop != nil {
-			gf.AddShutdownHandler(func() {
-				if infra.DEBUG {
-					impl.pushGraphvizNode("invoke beforeServerStop hook", false).Style = infra.GraphvizNodeStyleHook
-					log.Debugf("[glacier] invoke beforeServerStop hook")
+		if len(impl.beforeServerStopHooks) > 0 {
+			infra.AddShutdownHandlerInPhase(gf, infra.ShutdownPhaseStopTraffic, func() {
+				if err := impl.beforeServerStopHooks.run(impl, "beforeServerStop", func(fn interface{}) error {
+					return fn.(func(resolver infra.Resolver) error)(resolver)
+				}); err != nil {
+					log.Errorf("%v", err)
 				}
-				_ = impl.beforeServerStop(resolver)
 			})
 		}
 
@@ -152,7 +209,11 @@ func (impl *framework) Start(flagCtx infra.FlagContext) error {
 		}
 
 		var wg sync.WaitGroup
+		// launched 异步任务、Daemon、Service 是否已经开始启动，启动之后失败时需要执行停机阶段
+		var launched bool
 		var bootStage = func() error {
+			defer impl.lifecycleStage(lifecycle.StageBoot)()
+
 			if infra.DEBUG {
 				impl.pushGraphvizNode("bootStage", false).Type = infra.GraphvizNodeTypeClusterStart
 				defer func() {
@@ -169,8 +230,11 @@ func (impl *framework) Start(flagCtx infra.FlagContext) error {
 				return err
 			}
 
+			impl.registerHealthCheckers(healthRegistry)
+
 			// 启动 asyncRunners
-			stop := impl.startAsyncRunners()
+			launched = true
+			stop := impl.startAsyncRunners(ctx)
 			impl.consumeAsyncJobs()
 
 			wg.Add(1)
@@ -202,61 +266,98 @@ func (impl *framework) Start(flagCtx infra.FlagContext) error {
 			return nil
 		}
 		if err := bootStage(); err != nil {
+			if launched {
+				impl.abortBoot(gf, conf, &wg)
+			}
+
+			cancel()
 			return err
 		}
 
+		impl.modules.setup(gf, conf.ShutdownTimeout)
 		impl.updateGlacierStatus(Started)
-		impl.readyStage(resolver, gf)
+		healthRegistry.SetLive(true)
+
+		readyErr := impl.readyStage(ctx, resolver, gf, func() {
+			healthRegistry.SetReady(true)
+			impl.finishStartupReport()
+			if app != nil {
+				app.markReady()
+			}
+		})
+
+		var shutdownStartTs time.Time
+		finishShutdownStage := func() {}
+		gf.AddPreShutdownHandler(func() {
+			shutdownStartTs = impl.clock.Now()
+			impl.publishLifecycleEvent(lifecycle.ShutdownStarted{Time: shutdownStartTs})
+			finishShutdownStage = impl.lifecycleStage(lifecycle.StageShutdown)
+			healthRegistry.SetReady(false)
+			impl.updateGlacierStatus(Stopping)
+		})
 
-		defer impl.shutdownHandler(conf, &wg)
+		defer func() {
+			impl.shutdownHandler(conf, &wg)
+			finishShutdownStage()
+			impl.publishLifecycleEvent(lifecycle.ShutdownFinished{Time: impl.clock.Now(), Duration: impl.clock.Since(shutdownStartTs)})
+		}()
 		if infra.DEBUG {
 			gf.AddPreShutdownHandler(func() {
 				impl.pushGraphvizNode("shutdownStage", false).Type = infra.GraphvizNodeTypeClusterStart
 			})
 		}
-		return gf.Start()
+
+		err := gf.Start()
+		healthRegistry.SetLive(false)
+		impl.reportShutdownPhases(gf)
+
+		if err == nil {
+			err = readyErr()
+		}
+
+		return err
 	})
 }
 
-func (impl *framework) readyStage(resolver infra.Resolver, gf infra.Graceful) {
-	if infra.DEBUG {
-		impl.pushGraphvizNode("readyStage", false).Type = infra.GraphvizNodeTypeClusterStart
-		defer func() {
-			impl.pushGraphvizNode("readyStage", false).Type = infra.GraphvizNodeTypeClusterEnd
-		}()
+// abortBoot 异步任务、Daemon 或者 Service 已经启动之后启动失败时，执行所有停机阶段（包括取消 ctx），并等待已经启动的模块退出
+func (impl *framework) abortBoot(gf infra.Graceful, conf *Config, wg *sync.WaitGroup) {
+	log.Errorf("[glacier] application boot failed, stopping the started modules")
+
+	impl.runShutdownPhases(gf)
+	impl.shutdownHandler(conf, wg)
+}
+
+// runShutdownPhases 立即执行 gf 的所有停机阶段，用于启动失败或者命令模式等不需要等待停机信号的场景
+func (impl *framework) runShutdownPhases(gf infra.Graceful) {
+	// 内置的 Graceful 在 Start 执行之前会缓存停机信号，这里异步发送，避免信号缓冲区已满时阻塞
+	go gf.Shutdown()
+	if err := gf.Start(); err != nil {
+		log.Errorf("[glacier] graceful shutdown failed: %v", err)
 	}
 
-	var childGraphNodes []*infra.GraphvizNode
-	if len(impl.onServerReadyHooks) > 0 {
-		var wg sync.WaitGroup
-		wg.Add(len(impl.onServerReadyHooks))
+	impl.reportShutdownPhases(gf)
+}
 
-		var parentGraphNode *infra.GraphvizNode
-		if infra.DEBUG {
-			parentGraphNode = impl.pushGraphvizNode("invoke onServerReady hooks", true)
-			parentGraphNode.Style = infra.GraphvizNodeStyleHook
-		}
+// reportShutdownPhases 输出各停机阶段的执行耗时
+func (impl *framework) reportShutdownPhases(gf infra.Graceful) {
+	reporter, ok := gf.(infra.ShutdownReporter)
+	if !ok {
+		return
+	}
 
-		for _, hook := range impl.onServerReadyHooks {
-			if infra.DEBUG {
-				childGraphNodes = append(childGraphNodes, impl.pushGraphvizNode("invoke onServerReady hook: "+hook.name, true, parentGraphNode))
-				log.Debugf("[glacier] invoke onServerReady hook [%s]", hook.name)
+	for _, stat := range reporter.ShutdownStats() {
+		if infra.DEBUG {
+			node := impl.pushGraphvizNode(fmt.Sprintf("shutdown phase %s: %d handlers, took %s", stat.Phase.Name, stat.Handlers, stat.Took), false)
+			if stat.TimedOut {
+				node.Style = infra.GraphvizNodeStyleError
 			}
 
-			go func(hook namedFunc) {
-				defer wg.Done()
-				if err := resolver.Resolve(hook.fn); err != nil {
-					log.Errorf("[glacier] onServerReady hook [%s] failed: %v", hook.name, err)
-				}
-			}(hook)
+			log.Debugf("[glacier] shutdown phase [%s] finished, %d handlers, took %s", stat.Phase.Name, stat.Handlers, stat.Took)
 		}
 
-		gf.AddShutdownHandler(wg.Wait)
-	}
-
-	if infra.DEBUG {
-		impl.pushGraphvizNode("launched", false, childGraphNodes...)
-		log.Debugf("[glacier] application launched successfully, took %s", time.Since(impl.startTime))
+		if stat.TimedOut && infra.WARN {
+			log.Warningf("[glacier] shutdown phase [%s] timed out after %s", stat.Phase.Name, stat.Took)
+		}
 	}
 }
 
@@ -271,12 +372,15 @@ func (impl *framework) shutdownHandler(conf *Config, wg *sync.WaitGroup) {
 			wg.Wait()
 			ok <- struct{}{}
 		}()
+		timer := impl.clock.NewTimer(conf.ShutdownTimeout)
+		defer timer.Stop()
+
 		select {
 		case <-ok:
 			if infra.DEBUG {
 				log.Debugf("[glacier] all modules has been stopped, application will exit safely")
 			}
-		case <-time.After(conf.ShutdownTimeout):
+		case <-timer.C():
 			log.Errorf("[glacier] shutdown timeout, exit directly")
 		}
 	} else {
@@ -14,6 +14,15 @@ import (
 type App struct {
 	gcr infra.Glacier
 	cli *cli.App
+
+	// yamlFlag WithYAMLFlag 添加的选项名称，configFilesFlag WithConfigFiles 添加的选项名称
+	yamlFlag        string
+	configFilesFlag string
+	reloader        *configReloader
+
+	// args 启动应用时的命令行参数，configOrigins 记录每个选项的值来源
+	args          []string
+	configOrigins map[string]string
 }
 
 func (app *App) Cli() *cli.App {
@@ -63,14 +72,103 @@ func (app *App) WithShutdownTimeoutFlag(timeout time.Duration) *App {
 	}))
 }
 
+// WithProfileFlag 添加指定运行环境的命令行选项，也可以通过环境变量 envName 指定，都没有指定时使用 defaultProfile
+func (app *App) WithProfileFlag(flagName string, envName string, defaultProfile string) *App {
+	flag := &cli.StringFlag{
+		Name:  flagName,
+		Value: defaultProfile,
+		Usage: "set the active profile, such as dev, test or prod",
+	}
+	if envName != "" {
+		flag.EnvVars = []string{envName}
+	}
+
+	app.AddFlags(flag)
+
+	app.gcr.WithProfile(flagName, envName, defaultProfile)
+	return app
+}
+
+// WithBootPlanFlag 添加输出启动计划的命令行选项，指定该选项时（dot/mermaid/json）只输出启动计划，不启动应用
+func (app *App) WithBootPlanFlag(flagName string) *App {
+	app.AddFlags(&cli.StringFlag{
+		Name:  flagName,
+		Value: "",
+		Usage: "print the boot plan in the given format (dot, mermaid, json) and exit",
+	})
+
+	action := app.cli.Action
+	app.cli.Action = func(c *cli.Context) error {
+		format := c.String(flagName)
+		if format == "" {
+			return action(c)
+		}
+
+		plan, err := app.gcr.BootPlan(c)
+		if err != nil {
+			return err
+		}
+
+		output, err := plan.Export(format)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(c.App.Writer, output)
+		return err
+	}
+
+	return app
+}
+
+// WithDryRunFlag 添加校验容器绑定关系的命令行选项，指定该选项时只校验依赖注入配置是否完整，不启动应用
+func (app *App) WithDryRunFlag(flagName string) *App {
+	app.AddFlags(&cli.BoolFlag{
+		Name:  flagName,
+		Usage: "validate the container wiring and exit without starting the application",
+	})
+
+	action := app.cli.Action
+	app.cli.Action = func(c *cli.Context) error {
+		if !c.Bool(flagName) {
+			return action(c)
+		}
+
+		if err := app.gcr.Validate(c); err != nil {
+			return err
+		}
+
+		_, err := fmt.Fprintln(c.App.Writer, "validation passed")
+		return err
+	}
+
+	return app
+}
+
+// WithBindingsCommand 添加列出容器中所有绑定的子命令，输出每个绑定的生命周期、来源模块以及是否已经被解析，
+// 与 WithInspectCommands 中的 container 命令相同，以命令模式运行（不启动 Daemon、Service），支持 --format 选项
+func (app *App) WithBindingsCommand(name string) *App {
+	app.inspectCommand(name, "list all bindings in the container with their lifetime and source module", nil, app.inspectContainer)
+	return app
+}
+
 func (app *App) WithYAMLFlag(flagName string) *App {
 	app.cli.Flags = append(app.cli.Flags, &cli.StringFlag{
 		Name:  flagName,
 		Value: "",
 		Usage: "configuration file path",
 	})
+	app.yamlFlag = flagName
 
+	// 配置文件的优先级最低，只处理其它来源（比如 WithConfigFiles）没有设置的选项
+	before := app.cli.Before
 	app.cli.Before = func(c *cli.Context) error {
+		if before != nil {
+			if err := before(c); err != nil {
+				return err
+			}
+		}
+
 		conf := c.String(flagName)
 		if conf == "" {
 			return nil
@@ -81,7 +179,18 @@ func (app *App) WithYAMLFlag(flagName string) *App {
 			return err
 		}
 
-		return altsrc.ApplyInputSourceValues(c, inputSource, c.App.Flags)
+		set := setFlagNames(c)
+		if err := altsrc.ApplyInputSourceValues(c, inputSource, c.App.Flags); err != nil {
+			return err
+		}
+
+		for _, name := range c.FlagNames() {
+			if _, ok := app.configOrigins[name]; !ok && !set[name] {
+				app.configOrigins[name] = conf
+			}
+		}
+
+		return nil
 	}
 
 	return app
@@ -126,15 +235,19 @@ func Create(version string, asyncRunnerCount int) *App {
 	app.Version = version
 	app.Flags = make([]cli.Flag, 0)
 
-	glacierIns := glacier.New(version, asyncRunnerCount)
-	app.Action = func(c *cli.Context) error {
-		return glacierIns.Start(c)
+	ins := &App{
+		gcr: glacier.New(version, asyncRunnerCount),
+		cli: app,
+
+		configOrigins: make(map[string]string),
 	}
+	ins.reloader = newConfigReloader(ins)
 
-	return &App{
-		gcr: glacierIns,
-		cli: app,
+	app.Action = func(c *cli.Context) error {
+		return ins.gcr.Start(ins.reloader.flagContext(c))
 	}
+
+	return ins
 }
 
 // Glacier glacierImpl return glacierImpl instance
@@ -172,5 +285,6 @@ func (app *App) AddDurationFlag(name string, defaultVal time.Duration, usage str
 
 // Run start glacierImpl server
 func (app *App) Run(args []string) error {
+	app.args = args
 	return app.cli.Run(args)
 }
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"reflect"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Command 添加子命令，子命令以命令模式运行：注册并启动所有的 Provider 之后调用 handler，不会启动 Daemon、Service 以及 Graceful
+//
+// handler 的参数从容器中解析（包括 infra.FlagContext，可以读取 flags 中的选项），返回值支持：无返回值、error、int、(int, error)，
+// 进程以 handler 返回的退出码退出，返回 error 且退出码为 0 时，退出码为 1
+func (app *App) Command(name string, usage string, flags []cli.Flag, handler interface{}) *App {
+	if handler == nil || reflect.TypeOf(handler).Kind() != reflect.Func {
+		panic("[glacier] command handler must be a function")
+	}
+
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:  name,
+		Usage: usage,
+		Flags: flags,
+		Action: func(c *cli.Context) error {
+			code, err := app.gcr.Exec(c, handler)
+			if err != nil {
+				return cli.Exit(err.Error(), code)
+			}
+
+			if code != 0 {
+				return cli.Exit("", code)
+			}
+
+			return nil
+		},
+	})
+
+	return app
+}
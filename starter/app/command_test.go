@@ -0,0 +1,62 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/urfave/cli/v2"
+)
+
+func TestCommand(t *testing.T) {
+	ins := Create("1.0", 1)
+	ins.AddStringFlag("env", "dev", "")
+
+	var steps int
+	var env string
+	ins.Command("migrate", "run migrations", []cli.Flag{&cli.IntFlag{Name: "steps"}}, func(fc infra.FlagContext) int {
+		steps, env = fc.Int("steps"), fc.String("env")
+		return 2
+	})
+
+	exitCode := -1
+	ins.cli.ExitErrHandler = func(c *cli.Context, err error) {
+		if coder, ok := err.(cli.ExitCoder); ok {
+			exitCode = coder.ExitCode()
+		}
+	}
+
+	_ = ins.Run([]string{"app", "--env", "prod", "migrate", "--steps", "3"})
+	if steps != 3 || env != "prod" || exitCode != 2 {
+		t.Errorf("unexpected command result: steps=%d, env=%s, code=%d", steps, env, exitCode)
+	}
+}
+
+func TestBootPlanFlag(t *testing.T) {
+	ins := Create("1.0", 1).WithBootPlanFlag("boot-plan")
+
+	var buf bytes.Buffer
+	ins.cli.Writer = &buf
+	if err := ins.Run([]string{"app", "--boot-plan", "mermaid"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "flowchart TD") {
+		t.Errorf("unexpected boot plan output: %s", buf.String())
+	}
+}
+
+func TestDryRunFlag(t *testing.T) {
+	ins := Create("1.0", 1).WithDryRunFlag("dry-run")
+
+	var buf bytes.Buffer
+	ins.cli.Writer = &buf
+	if err := ins.Run([]string{"app", "--dry-run"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.TrimSpace(buf.String()) != "validation passed" {
+		t.Errorf("unexpected dry run output: %s", buf.String())
+	}
+}
@@ -0,0 +1,416 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/glacier"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+// ConfigValidator 配置结构体（包括嵌套的结构体）实现该接口时，加载完成后会调用 Validate 校验配置
+type ConfigValidator interface {
+	Validate() error
+}
+
+// WithConfig 注册基于结构体标签的配置，cfg 为结构体指针，支持以下标签
+//
+//   - flag: 命令行选项名称，嵌套结构体的 flag 标签作为其字段选项名称的前缀，以 . 分隔（为空时不添加前缀），没有 flag 标签的字段会被忽略
+//   - env: 环境变量名称
+//   - default: 默认值，切片使用 , 分隔
+//   - usage: 命令行选项说明
+//   - required: 为 true 时，配置值不能为零值
+//
+// 字段类型支持 string、bool、整数、浮点数、time.Duration、[]string、[]int 以及嵌套的结构体（或结构体指针）
+// 框架会自动添加对应的命令行选项，在 Init 阶段从 FlagContext 加载配置并校验，之后将 cfg 绑定为单例
+func (app *App) WithConfig(configs ...interface{}) *App {
+	for _, cfg := range configs {
+		fields := mustParseConfig(cfg)
+		app.AddFlags(configFlags(fields)...)
+
+		val := reflect.ValueOf(cfg)
+		name := "config " + val.Type().String()
+		app.gcr.Init(func(fc infra.FlagContext) error {
+			return loadConfig(fc, val, fields)
+		}, glacier.SetHookNameOption(name))
+
+		app.gcr.PreBind(func(binder infra.Binder) {
+			binder.MustSingletonOverride(configInitializer(val))
+		}, glacier.SetHookNameOption(name))
+
+		app.reloader.configs = append(app.reloader.configs, reloadableConfig{typ: val.Type(), fields: fields})
+	}
+
+	return app
+}
+
+// configInitializer 返回用于将配置结构体指针 val 绑定为单例的初始化函数
+func configInitializer(val reflect.Value) interface{} {
+	return reflect.MakeFunc(
+		reflect.FuncOf(nil, []reflect.Type{val.Type()}, false),
+		func([]reflect.Value) []reflect.Value { return []reflect.Value{val} },
+	).Interface()
+}
+
+// ConfigFlags 返回配置结构体对应的命令行选项，cfg 为结构体指针
+func ConfigFlags(cfg interface{}) []cli.Flag {
+	return configFlags(mustParseConfig(cfg))
+}
+
+// LoadConfig 从 FlagContext 加载配置到 cfg 中并校验，cfg 为结构体指针
+// FlagContext 中没有设置的选项依次使用环境变量、默认值
+func LoadConfig(flagCtx infra.FlagContext, cfg interface{}) error {
+	fields, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	return loadConfig(flagCtx, reflect.ValueOf(cfg), fields)
+}
+
+// configField 配置结构体中的一个配置项
+type configField struct {
+	name     string
+	env      string
+	def      string
+	usage    string
+	required bool
+	// index 字段在配置结构体中的路径，用于 reflect.Value.FieldByIndex
+	index []int
+	typ   reflect.Type
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	stringSliceType = reflect.TypeOf([]string{})
+	intSliceType    = reflect.TypeOf([]int{})
+)
+
+func mustParseConfig(cfg interface{}) []configField {
+	fields, err := parseConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	return fields
+}
+
+func parseConfig(cfg interface{}) ([]configField, error) {
+	typ := reflect.TypeOf(cfg)
+	if typ == nil || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("[glacier] config must be a pointer to struct, got %T", cfg)
+	}
+
+	return parseConfigStruct(typ.Elem(), "", nil)
+}
+
+// parseConfigStruct 解析结构体中所有带有 flag 标签的字段，嵌套结构体的字段名称会加上 prefix 前缀
+func parseConfigStruct(typ reflect.Type, prefix string, index []int) ([]configField, error) {
+	fields := make([]configField, 0)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, ok := field.Tag.Lookup("flag")
+		if !ok || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		if prefix != "" && name != "" {
+			name = prefix + "." + name
+		} else if name == "" {
+			name = prefix
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+
+		nested := field.Type
+		if nested.Kind() == reflect.Ptr {
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct && nested != durationType {
+			children, err := parseConfigStruct(nested, name, fieldIndex)
+			if err != nil {
+				return nil, err
+			}
+
+			fields = append(fields, children...)
+			continue
+		}
+
+		if !supportedConfigType(field.Type) {
+			return nil, fmt.Errorf("[glacier] config field %s.%s: unsupported type %s", typ.String(), field.Name, field.Type)
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("[glacier] config field %s.%s: flag name is required", typ.String(), field.Name)
+		}
+
+		cf := configField{
+			name:     name,
+			env:      field.Tag.Get("env"),
+			def:      field.Tag.Get("default"),
+			usage:    field.Tag.Get("usage"),
+			required: field.Tag.Get("required") == "true",
+			index:    fieldIndex,
+			typ:      field.Type,
+		}
+
+		if cf.def != "" {
+			if _, err := parseConfigValue(cf.typ, cf.def); err != nil {
+				return nil, fmt.Errorf("[glacier] config field %s.%s: invalid default value: %v", typ.String(), field.Name, err)
+			}
+		}
+
+		fields = append(fields, cf)
+	}
+
+	return fields, nil
+}
+
+func supportedConfigType(typ reflect.Type) bool {
+	if typ == durationType {
+		return true
+	}
+
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return typ == stringSliceType || typ == intSliceType
+	}
+
+	return false
+}
+
+// parseConfigValue 将字符串形式的值（默认值、环境变量）转换为字段类型的值
+func parseConfigValue(typ reflect.Type, raw string) (reflect.Value, error) {
+	val := reflect.New(typ).Elem()
+	if typ == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return val, err
+		}
+
+		val.SetInt(int64(d))
+		return val, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		val.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return val, err
+		}
+		val.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, typ.Bits())
+		if err != nil {
+			return val, err
+		}
+		val.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, typ.Bits())
+		if err != nil {
+			return val, err
+		}
+		val.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, typ.Bits())
+		if err != nil {
+			return val, err
+		}
+		val.SetFloat(f)
+	case reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+
+		val = reflect.MakeSlice(typ, len(items), len(items))
+		for i, item := range items {
+			elem, err := parseConfigValue(typ.Elem(), item)
+			if err != nil {
+				return val, err
+			}
+			val.Index(i).Set(elem)
+		}
+	}
+
+	return val, nil
+}
+
+// configFlags 创建配置项对应的命令行选项，使用 altsrc 包装以支持从配置文件中读取
+func configFlags(fields []configField) []cli.Flag {
+	flags := make([]cli.Flag, 0, len(fields))
+	for _, f := range fields {
+		var envVars []string
+		if f.env != "" {
+			envVars = []string{f.env}
+		}
+
+		def, _ := parseConfigValue(f.typ, f.def)
+		switch {
+		case f.typ == durationType:
+			flags = append(flags, altsrc.NewDurationFlag(&cli.DurationFlag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: time.Duration(def.Int())}))
+		case f.typ.Kind() == reflect.String:
+			flags = append(flags, altsrc.NewStringFlag(&cli.StringFlag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: def.String()}))
+		case f.typ.Kind() == reflect.Bool:
+			flags = append(flags, altsrc.NewBoolFlag(&cli.BoolFlag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: def.Bool()}))
+		case f.typ.Kind() == reflect.Float32 || f.typ.Kind() == reflect.Float64:
+			flags = append(flags, altsrc.NewFloat64Flag(&cli.Float64Flag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: def.Float()}))
+		case f.typ == stringSliceType:
+			flags = append(flags, altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: cli.NewStringSlice(def.Interface().([]string)...)}))
+		case f.typ == intSliceType:
+			flags = append(flags, altsrc.NewIntSliceFlag(&cli.IntSliceFlag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: cli.NewIntSlice(def.Interface().([]int)...)}))
+		case def.CanUint():
+			flags = append(flags, altsrc.NewIntFlag(&cli.IntFlag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: int(def.Uint())}))
+		default:
+			flags = append(flags, altsrc.NewIntFlag(&cli.IntFlag{Name: f.name, Usage: f.usage, EnvVars: envVars, Value: int(def.Int())}))
+		}
+	}
+
+	return flags
+}
+
+// flagValue 从 FlagContext 中读取配置项的值，整数类型的选项使用 IntFlag，值超出字段类型的范围时返回错误
+func flagValue(flagCtx infra.FlagContext, f configField) (reflect.Value, error) {
+	val := reflect.New(f.typ).Elem()
+	switch {
+	case f.typ == durationType:
+		val.SetInt(int64(flagCtx.Duration(f.name)))
+	case f.typ.Kind() == reflect.String:
+		val.SetString(flagCtx.String(f.name))
+	case f.typ.Kind() == reflect.Bool:
+		val.SetBool(flagCtx.Bool(f.name))
+	case f.typ.Kind() == reflect.Float32 || f.typ.Kind() == reflect.Float64:
+		val.SetFloat(flagCtx.Float64(f.name))
+	case f.typ == stringSliceType:
+		val.Set(reflect.ValueOf(flagCtx.StringSlice(f.name)))
+	case f.typ == intSliceType:
+		val.Set(reflect.ValueOf(flagCtx.IntSlice(f.name)))
+	case val.CanUint():
+		i := flagCtx.Int(f.name)
+		if i < 0 || val.OverflowUint(uint64(i)) {
+			return val, fmt.Errorf("value %d out of range for %s", i, f.typ)
+		}
+		val.SetUint(uint64(i))
+	default:
+		i := flagCtx.Int(f.name)
+		if val.OverflowInt(int64(i)) {
+			return val, fmt.Errorf("value %d out of range for %s", i, f.typ)
+		}
+		val.SetInt(int64(i))
+	}
+
+	return val, nil
+}
+
+// loadConfig 加载配置并校验，优先级依次为：显式设置的选项、环境变量、FlagContext 中的非零值（比如命令行选项的默认值）、default 标签
+func loadConfig(flagCtx infra.FlagContext, cfg reflect.Value, fields []configField) error {
+	root := cfg.Elem()
+	root.Set(reflect.Zero(root.Type()))
+
+	explicit := make(map[string]bool)
+	for _, name := range flagCtx.FlagNames() {
+		explicit[name] = true
+	}
+
+	for _, f := range fields {
+		val, err := flagValue(flagCtx, f)
+		if err != nil {
+			return fmt.Errorf("[glacier] config %s: invalid value of flag: %v", f.name, err)
+		}
+
+		if !explicit[f.name] {
+			if env, ok := os.LookupEnv(f.env); f.env != "" && ok {
+				parsed, err := parseConfigValue(f.typ, env)
+				if err != nil {
+					return fmt.Errorf("[glacier] config %s: invalid value of env %s: %v", f.name, f.env, err)
+				}
+				val = parsed
+			} else if isZeroConfigValue(val) && f.def != "" {
+				val, _ = parseConfigValue(f.typ, f.def)
+			}
+		}
+
+		if f.required && isZeroConfigValue(val) {
+			return fmt.Errorf("[glacier] config %s is required", f.name)
+		}
+
+		configField := root
+		for _, i := range f.index {
+			if configField.Kind() == reflect.Ptr {
+				if configField.IsNil() {
+					configField.Set(reflect.New(configField.Type().Elem()))
+				}
+				configField = configField.Elem()
+			}
+			configField = configField.Field(i)
+		}
+
+		configField.Set(val.Convert(f.typ))
+	}
+
+	return validateConfig(cfg)
+}
+
+// isZeroConfigValue 判断配置值是否为零值，空切片也视为零值
+func isZeroConfigValue(val reflect.Value) bool {
+	if val.Kind() == reflect.Slice {
+		return val.Len() == 0
+	}
+
+	return val.IsZero()
+}
+
+// validateConfig 先校验嵌套的结构体，再校验外层的结构体
+func validateConfig(val reflect.Value) error {
+	elem := val
+	if elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return nil
+		}
+		elem = elem.Elem()
+	}
+
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		if tag, ok := elem.Type().Field(i).Tag.Lookup("flag"); !ok || tag == "-" || !elem.Type().Field(i).IsExported() {
+			continue
+		}
+
+		if field.Kind() == reflect.Struct {
+			field = field.Addr()
+		}
+
+		if err := validateConfig(field); err != nil {
+			return err
+		}
+	}
+
+	if val.Kind() == reflect.Ptr {
+		if v, ok := val.Interface().(ConfigValidator); ok {
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("[glacier] config %s is invalid: %v", val.Type(), err)
+			}
+		}
+	}
+
+	return nil
+}
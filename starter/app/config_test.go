@@ -0,0 +1,93 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier"
+)
+
+type dbConfig struct {
+	DSN     string `flag:"dsn" env:"TEST_DB_DSN" required:"true"`
+	MaxConn int    `flag:"max-conn" default:"10"`
+}
+
+func (c *dbConfig) Validate() error {
+	if c.MaxConn <= 0 {
+		return errors.New("max-conn must be positive")
+	}
+	return nil
+}
+
+type serverConfig struct {
+	Listen  string        `flag:"listen" default:"127.0.0.1:8080" usage:"http listen address"`
+	Timeout time.Duration `flag:"timeout" default:"3s"`
+	Debug   bool          `flag:"debug"`
+	Tags    []string      `flag:"tags" default:"a,b"`
+	DB      *dbConfig     `flag:"db"`
+	Ignored string
+}
+
+func TestLoadConfig(t *testing.T) {
+	names := make([]string, 0)
+	for _, f := range ConfigFlags(&serverConfig{}) {
+		names = append(names, f.Names()[0])
+	}
+	if strings.Join(names, ",") != "listen,timeout,debug,tags,db.dsn,db.max-conn" {
+		t.Errorf("unexpected flags: %v", names)
+	}
+
+	var cfg serverConfig
+	if err := LoadConfig(glacier.NewFlagContext(), &cfg); err == nil || !strings.Contains(err.Error(), "db.dsn is required") {
+		t.Errorf("expected required error, got %v", err)
+	}
+
+	t.Setenv("TEST_DB_DSN", "mysql://localhost")
+
+	flagCtx := glacier.NewFlagContext()
+	flagCtx.SetString("listen", ":9090")
+	if err := LoadConfig(flagCtx, &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Listen != ":9090" || cfg.Timeout != 3*time.Second || cfg.Debug || strings.Join(cfg.Tags, ",") != "a,b" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.DB == nil || cfg.DB.DSN != "mysql://localhost" || cfg.DB.MaxConn != 10 {
+		t.Errorf("unexpected db config: %+v", cfg.DB)
+	}
+
+	flagCtx.SetInt("db.max-conn", -1)
+	if err := LoadConfig(flagCtx, &cfg); err == nil || !strings.Contains(err.Error(), "max-conn must be positive") {
+		t.Errorf("expected validate error, got %v", err)
+	}
+}
+
+type limitConfig struct {
+	Workers uint   `flag:"workers"`
+	Retries int8   `flag:"retries"`
+	Port    uint16 `flag:"port"`
+}
+
+func TestLoadConfigOutOfRange(t *testing.T) {
+	cases := map[string]int{"workers": -1, "retries": 128, "port": 70000}
+	for name, value := range cases {
+		flagCtx := glacier.NewFlagContext()
+		flagCtx.SetInt(name, value)
+
+		var cfg limitConfig
+		if err := LoadConfig(flagCtx, &cfg); err == nil || !strings.Contains(err.Error(), "config "+name) {
+			t.Errorf("expected out of range error for %s, got %v", name, err)
+		}
+	}
+
+	flagCtx := glacier.NewFlagContext()
+	flagCtx.SetInt("port", 8080)
+
+	var cfg limitConfig
+	if err := LoadConfig(flagCtx, &cfg); err != nil || cfg.Port != 8080 {
+		t.Errorf("unexpected result: %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/scheduler"
+	"github.com/mylxsw/glacier/web"
+	"github.com/urfave/cli/v2"
+)
+
+// 内置的查看应用信息的子命令名称
+const (
+	InspectRoutes    = "routes"
+	InspectCronJobs  = "cron:list"
+	InspectModules   = "modules"
+	InspectContainer = "container"
+)
+
+// WithInspectCommands 添加用于查看应用信息的子命令，names 为空时添加全部子命令，支持以下命令
+//
+//   - routes: 列出 Web 服务注册的所有路由
+//   - cron:list: 列出所有的定时任务以及接下来的执行时间（--next 指定数量）
+//   - modules: 列出所有的 Provider/Service 以及其优先级、是否加载、聚合来源
+//   - container: 列出容器中所有的绑定
+//
+// 所有的命令都支持 --format 选项指定输出格式（table/json），除 modules 外，其它命令以命令模式运行（不启动 Daemon、Service）
+func (app *App) WithInspectCommands(names ...string) *App {
+	if len(names) == 0 {
+		names = []string{InspectRoutes, InspectCronJobs, InspectModules, InspectContainer}
+	}
+
+	for _, name := range names {
+		switch name {
+		case InspectRoutes:
+			app.inspectCommand(name, "list all http routes", nil, app.inspectRoutes)
+		case InspectCronJobs:
+			app.inspectCommand(name, "list all cron jobs with their next run times", []cli.Flag{
+				&cli.IntFlag{Name: "next", Value: 3, Usage: "number of next run times to show"},
+			}, app.inspectCronJobs)
+		case InspectModules:
+			app.inspectCommand(name, "list all providers and services with their load decision", nil, app.inspectModules)
+		case InspectContainer:
+			app.inspectCommand(name, "list all bindings in the container after providers booted", nil, app.inspectContainer)
+		default:
+			panic(fmt.Sprintf("[glacier] unknown inspect command: %s", name))
+		}
+	}
+
+	return app
+}
+
+// inspectTable 查看命令的输出，JSON 格式输出 data，表格格式输出 headers 和 rows
+type inspectTable struct {
+	headers []string
+	rows    [][]string
+	footer  string
+	data    interface{}
+}
+
+func (app *App) inspectCommand(name string, usage string, flags []cli.Flag, fn func(c *cli.Context) (inspectTable, error)) {
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:  name,
+		Usage: usage,
+		Flags: append(flags, &cli.StringFlag{Name: "format", Value: "table", Usage: "output format (table, json)"}),
+		Action: func(c *cli.Context) error {
+			format := c.String("format")
+			if format != "table" && format != "json" {
+				return fmt.Errorf("[glacier] unsupported format: %s", format)
+			}
+
+			table, err := fn(c)
+			if err != nil {
+				return err
+			}
+
+			return table.write(c.App.Writer, format)
+		},
+	})
+}
+
+func (t inspectTable) write(w io.Writer, format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(t.data, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+	for _, row := range t.rows {
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	if t.footer != "" {
+		_, _ = fmt.Fprintf(tw, "\n%s\n", t.footer)
+	}
+
+	return tw.Flush()
+}
+
+// execInspect 以命令模式启动应用后执行 handler
+func (app *App) execInspect(c *cli.Context, handler interface{}) error {
+	_, err := app.gcr.Exec(c, handler)
+	return err
+}
+
+func (app *App) inspectRoutes(c *cli.Context) (inspectTable, error) {
+	var routes []web.Route
+	if err := app.execInspect(c, func(resolver infra.Resolver) error {
+		var server web.Server
+		if err := resolver.Resolve(func(s web.Server) { server = s }); err != nil {
+			return fmt.Errorf("[glacier] web server is not available, is the web provider registered? %v", err)
+		}
+
+		lister, ok := server.(web.RouteLister)
+		if !ok {
+			return fmt.Errorf("[glacier] web server %T does not support listing routes", server)
+		}
+
+		routes = lister.Routes()
+		return nil
+	}); err != nil {
+		return inspectTable{}, err
+	}
+
+	table := inspectTable{headers: []string{"METHODS", "PATH", "NAME", "HOST"}, data: routes}
+	for _, route := range routes {
+		table.rows = append(table.rows, []string{inspectValue(strings.Join(route.Methods, ",")), route.PathTemplate, inspectValue(route.Name), inspectValue(route.HostTemplate)})
+	}
+
+	return table, nil
+}
+
+// cronJobInfo 定时任务信息
+type cronJobInfo struct {
+	Name   string      `json:"name"`
+	Plan   string      `json:"plan"`
+	Paused bool        `json:"paused"`
+	Next   []time.Time `json:"next"`
+}
+
+func (app *App) inspectCronJobs(c *cli.Context) (inspectTable, error) {
+	jobs := make([]cronJobInfo, 0)
+	if err := app.execInspect(c, func(resolver infra.Resolver) error {
+		var cr scheduler.Scheduler
+		if err := resolver.Resolve(func(s scheduler.Scheduler) { cr = s }); err != nil {
+			return fmt.Errorf("[glacier] scheduler is not available, is the scheduler provider registered? %v", err)
+		}
+
+		for _, job := range cr.Jobs() {
+			next, err := job.Next(c.Int("next"))
+			if err != nil {
+				return fmt.Errorf("[glacier] job %s: %v", job.Name, err)
+			}
+
+			jobs = append(jobs, cronJobInfo{Name: job.Name, Plan: job.Plan, Paused: job.Paused, Next: next})
+		}
+
+		return nil
+	}); err != nil {
+		return inspectTable{}, err
+	}
+
+	table := inspectTable{headers: []string{"NAME", "PLAN", "PAUSED", "NEXT"}, data: jobs}
+	for _, job := range jobs {
+		next := make([]string, 0, len(job.Next))
+		for _, t := range job.Next {
+			next = append(next, t.Format(time.RFC3339))
+		}
+
+		table.rows = append(table.rows, []string{job.Name, job.Plan, strconv.FormatBool(job.Paused), inspectValue(strings.Join(next, ", "))})
+	}
+
+	return table, nil
+}
+
+func (app *App) inspectModules(c *cli.Context) (inspectTable, error) {
+	plan, err := app.gcr.BootPlan(c)
+	if err != nil {
+		return inspectTable{}, err
+	}
+
+	loaded := map[infra.BootPlanModuleKind]int{}
+	skipped := map[infra.BootPlanModuleKind]int{}
+
+	table := inspectTable{headers: []string{"KIND", "NAME", "PRIORITY", "LOADED", "AGGREGATED BY", "SKIP REASON"}, data: plan.Modules}
+	for _, m := range plan.Modules {
+		if m.SkipReason == "" {
+			loaded[m.Kind]++
+		} else {
+			skipped[m.Kind]++
+		}
+
+		table.rows = append(table.rows, []string{
+			string(m.Kind),
+			m.Name,
+			strconv.Itoa(m.Priority),
+			strconv.FormatBool(m.SkipReason == ""),
+			inspectValue(m.AggregatedBy),
+			inspectValue(m.SkipReason),
+		})
+	}
+
+	table.footer = fmt.Sprintf(
+		"providers: %d loaded, %d skipped; services: %d loaded, %d skipped",
+		loaded[infra.BootPlanProvider], skipped[infra.BootPlanProvider],
+		loaded[infra.BootPlanService], skipped[infra.BootPlanService],
+	)
+
+	return table, nil
+}
+
+func (app *App) inspectContainer(c *cli.Context) (inspectTable, error) {
+	if err := app.execInspect(c, func() {}); err != nil {
+		return inspectTable{}, err
+	}
+
+	bindings := app.gcr.Bindings()
+	table := inspectTable{headers: []string{"KEY", "LIFETIME", "MODULE", "SCOPE", "RESOLVED"}, data: bindings}
+	for _, b := range bindings {
+		table.rows = append(table.rows, []string{b.Key, string(b.Lifetime), b.Module, inspectValue(b.Scope), strconv.FormatBool(b.Resolved)})
+	}
+
+	return table, nil
+}
+
+func inspectValue(val string) string {
+	if val == "" {
+		return "-"
+	}
+
+	return val
+}
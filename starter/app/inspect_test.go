@@ -0,0 +1,61 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/scheduler"
+	"github.com/mylxsw/glacier/web"
+)
+
+func TestInspectCommands(t *testing.T) {
+	run := func(args ...string) string {
+		ins := Create("1.0", 1).WithInspectCommands().WithBindingsCommand("bindings")
+		ins.Provider(web.Provider(nil, web.SetRouteHandlerOption(func(resolver infra.Resolver, router web.Router, mw web.RequestMiddleware) {
+			router.Get("/users", func() string { return "users" }).Name("users")
+		})))
+		ins.Provider(scheduler.Provider(func(resolver infra.Resolver, creator scheduler.JobCreator) {
+			creator.MustAdd("report", "0 0 * * * *", func() {})
+		}))
+
+		var buf bytes.Buffer
+		ins.cli.Writer = &buf
+		if err := ins.Run(append([]string{"app"}, args...)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", args[0], err)
+		}
+
+		return buf.String()
+	}
+
+	var routes []web.Route
+	if err := json.Unmarshal([]byte(run("routes", "--format", "json")), &routes); err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].PathTemplate != "/users" || routes[0].Name != "users" {
+		t.Errorf("unexpected routes: %+v", routes)
+	}
+
+	var jobs []cronJobInfo
+	if err := json.Unmarshal([]byte(run("cron:list", "--next", "2", "--format", "json")), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Name != "report" || len(jobs[0].Next) != 2 {
+		t.Errorf("unexpected cron jobs: %+v", jobs)
+	}
+
+	if output := run("modules"); !strings.Contains(output, "providers: 2 loaded, 0 skipped") {
+		t.Errorf("unexpected modules output: %s", output)
+	}
+
+	if output := run("container"); !strings.Contains(output, "scheduler.Scheduler") {
+		t.Errorf("unexpected container output: %s", output)
+	}
+
+	// bindings 与 container 命令的输出相同
+	if container, bindings := run("container", "--format", "json"), run("bindings", "--format", "json"); container != bindings {
+		t.Errorf("bindings output should be the same as container:\n%s\n%s", container, bindings)
+	}
+}
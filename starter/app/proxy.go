@@ -1,11 +1,14 @@
 package app
 
 import (
+	"context"
+	"time"
+
 	"github.com/mylxsw/glacier/infra"
 )
 
-func (app *App) PreBind(fn func(binder infra.Binder)) *App {
-	app.gcr.PreBind(fn)
+func (app *App) PreBind(fn func(binder infra.Binder), options ...infra.HookOption) *App {
+	app.gcr.PreBind(fn, options...)
 	return app
 }
 
@@ -24,17 +27,90 @@ func (app *App) Async(asyncJobs ...interface{}) *App {
 	return app
 }
 
+// AsyncJob 提交一个异步任务，返回任务句柄
+func (app *App) AsyncJob(fn interface{}, options ...infra.AsyncOption) infra.AsyncJob {
+	return app.gcr.AsyncJob(fn, options...)
+}
+
+func (app *App) WithAsyncQueue(size int, policy infra.AsyncOverflowPolicy) *App {
+	app.gcr.WithAsyncQueue(size, policy)
+	return app
+}
+
 func (app *App) Graceful(builder func() infra.Graceful) *App {
 	app.gcr.Graceful(builder)
 	return app
 }
 
+// WithShutdownPhaseTimeout 设置停机阶段的超时时间
+func (app *App) WithShutdownPhaseTimeout(phase infra.ShutdownPhase, timeout time.Duration) *App {
+	app.gcr.WithShutdownPhaseTimeout(phase, timeout)
+	return app
+}
+
+// ForProfiles 返回用于注册只在指定运行环境中加载的 Provider/Service 的注册器
+func (app *App) ForProfiles(profiles ...string) infra.ProfileRegistrar {
+	return app.gcr.ForProfiles(profiles...)
+}
+
+// WithClock 设置框架使用的时间源，一般用于测试
+func (app *App) WithClock(clock infra.Clock) *App {
+	app.gcr.WithClock(clock)
+	return app
+}
+
+func (app *App) WithPanicHandler(handler infra.PanicHandler) *App {
+	app.gcr.WithPanicHandler(handler)
+	return app
+}
+
+func (app *App) WithStartupReport(print bool, slowThreshold time.Duration) *App {
+	app.gcr.WithStartupReport(print, slowThreshold)
+	return app
+}
+
+func (app *App) StartupReport() infra.StartupReport {
+	return app.gcr.StartupReport()
+}
+
+func (app *App) BootPlan(cliCtx infra.FlagContext) (infra.BootPlan, error) {
+	return app.gcr.BootPlan(cliCtx)
+}
+
+func (app *App) Validate(cliCtx infra.FlagContext) error {
+	return app.gcr.Validate(cliCtx)
+}
+
+func (app *App) WithBindingConflictPolicy(policy infra.BindingConflictPolicy) *App {
+	app.gcr.WithBindingConflictPolicy(policy)
+	return app
+}
+
+func (app *App) Bindings() []infra.BindingInfo {
+	return app.gcr.Bindings()
+}
+
 func (app *App) Start(cliCtx infra.FlagContext) error {
 	return app.gcr.Start(cliCtx)
 }
 
-func (app *App) Init(f func(c infra.FlagContext) error) *App {
-	app.gcr.Init(f)
+// StartAsync 以非阻塞的方式启动应用，返回应用句柄
+func (app *App) StartAsync(cliCtx infra.FlagContext) infra.Application {
+	return app.gcr.StartAsync(cliCtx)
+}
+
+// StartWithContext 以非阻塞的方式启动应用，ctx 被取消时触发优雅停机，App.Run 已经用于运行命令行应用，因此使用该名称
+func (app *App) StartWithContext(ctx context.Context, cliCtx infra.FlagContext) infra.Application {
+	return app.gcr.Run(ctx, cliCtx)
+}
+
+// Exec 以命令模式执行 handler，只注册和启动 Provider，返回命令的退出码
+func (app *App) Exec(cliCtx infra.FlagContext, handler interface{}) (int, error) {
+	return app.gcr.Exec(cliCtx, handler)
+}
+
+func (app *App) Init(f func(c infra.FlagContext) error, options ...infra.HookOption) *App {
+	app.gcr.Init(f, options...)
 	return app
 }
 
@@ -42,8 +118,16 @@ func (app *App) OnServerReady(ffs ...interface{}) {
 	app.gcr.OnServerReady(ffs...)
 }
 
-func (app *App) BeforeServerStop(f func(cc infra.Resolver) error) *App {
-	app.gcr.BeforeServerStop(f)
+func (app *App) OnServerReadyHook(fn interface{}, options ...infra.ReadyHookOption) {
+	app.gcr.OnServerReadyHook(fn, options...)
+}
+
+func (app *App) OnLifecycleEvent(listeners ...interface{}) {
+	app.gcr.OnLifecycleEvent(listeners...)
+}
+
+func (app *App) BeforeServerStop(f func(cc infra.Resolver) error, options ...infra.HookOption) *App {
+	app.gcr.BeforeServerStop(f, options...)
 	return app
 }
 
@@ -57,6 +141,11 @@ func (app *App) Prototype(ins ...interface{}) *App {
 	return app
 }
 
+func (app *App) Scoped(ins ...interface{}) *App {
+	app.gcr.Scoped(ins...)
+	return app
+}
+
 func (app *App) Resolve(resolver interface{}) error {
 	return app.gcr.Resolve(resolver)
 }
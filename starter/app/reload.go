@@ -0,0 +1,645 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/glacier/event"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+// ConfigChangedEvent 重新加载配置文件后，有配置项的值发生变化时发布的事件
+type ConfigChangedEvent struct {
+	// Source 配置文件路径，有多个配置文件时按照优先级从低到高使用 , 分隔
+	Source string
+	// Keys 值发生变化的配置项（命令行选项名称），按照名称排序
+	Keys []string
+}
+
+// HasChanged 判断指定的配置项是否发生了变化，key 也可以是嵌套配置项的前缀，比如 db 匹配 db.dsn
+func (evt ConfigChangedEvent) HasChanged(keys ...string) bool {
+	for _, changed := range evt.Keys {
+		for _, key := range keys {
+			if changed == key || strings.HasPrefix(changed, key+".") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WithConfigReload 启用配置文件的重新加载，必须在 WithYAMLFlag 或者 WithConfigFiles 之后调用
+//
+// 应用收到重新加载信号（或者调用 Graceful.Reload）时，会按照与启动时相同的优先级重新读取 WithYAMLFlag 以及 WithConfigFiles
+// 指定的所有配置文件，pollInterval 大于 0 时，还会按照该间隔检查配置文件是否被修改。
+// 命令行中显式指定（或者通过环境变量指定）的选项不会被配置文件覆盖。
+// 配置项的值发生变化时：
+//
+//   - FlagContext 返回新的值
+//   - 指定了 Destination 的选项，在 WithConfig 注册的配置结构体校验成功之后更新为新的值
+//   - WithConfig 注册的配置结构体重新加载并绑定（校验失败时放弃本次加载）
+//   - ReloadableSingleton 注册的单例在下次解析时重新创建
+//   - 调用 OnConfigChange 注册的回调函数，如果绑定了 event.Publisher，发布 ConfigChangedEvent 事件
+func (app *App) WithConfigReload(pollInterval time.Duration) *App {
+	if app.yamlFlag == "" && app.configFilesFlag == "" {
+		panic("[glacier] WithConfigReload must be called after WithYAMLFlag or WithConfigFiles")
+	}
+
+	app.reloader.enabled = true
+	app.reloader.interval = pollInterval
+
+	before := app.cli.Before
+	app.cli.Before = func(c *cli.Context) error {
+		// 配置文件加载之前已经设置的选项来自命令行或者环境变量，重新加载时保持不变
+		for _, name := range c.FlagNames() {
+			app.reloader.pinned[name] = true
+		}
+
+		return before(c)
+	}
+
+	app.gcr.Provider(&configReloadProvider{reloader: app.reloader})
+	return app
+}
+
+// ReloadableSingleton 注册单例，配置项 keys（没有指定时为任意配置项）发生变化后，该单例会在下次解析时使用 initializer 重新创建
+// 已经持有旧实例的对象不受影响，需要感知变化的地方应该在使用时通过容器解析
+func (app *App) ReloadableSingleton(initializer interface{}, keys ...string) *App {
+	app.gcr.PreBind(func(binder infra.Binder) {
+		binder.MustSingletonOverride(initializer)
+	})
+
+	app.reloader.singletons = append(app.reloader.singletons, reloadableSingleton{initializer: initializer, keys: keys})
+	return app
+}
+
+// OnConfigChange 注册配置项发生变化时的回调函数，handler 的参数支持 ConfigChangedEvent 以及容器中绑定的对象，
+// 返回值为 error 类型时，返回的错误会被记录到日志
+func (app *App) OnConfigChange(handler interface{}) *App {
+	if reflect.TypeOf(handler).Kind() != reflect.Func {
+		panic("[glacier] config change handler must be a function")
+	}
+
+	app.reloader.handlers = append(app.reloader.handlers, handler)
+	return app
+}
+
+type reloadableSingleton struct {
+	initializer interface{}
+	keys        []string
+}
+
+// reloadableConfig WithConfig 注册的配置结构体
+type reloadableConfig struct {
+	typ    reflect.Type
+	fields []configField
+}
+
+// configReloader 负责重新加载配置文件，计算变化的配置项并通知相关的模块
+type configReloader struct {
+	app      *App
+	enabled  bool
+	interval time.Duration
+
+	pinned     map[string]bool
+	configs    []reloadableConfig
+	singletons []reloadableSingleton
+	handlers   []interface{}
+
+	// reloadLock 保证同一时间只有一个重新加载过程
+	reloadLock sync.Mutex
+	lock       sync.RWMutex
+	cliCtx     *cli.Context
+	values     map[string]interface{}
+}
+
+func newConfigReloader(app *App) *configReloader {
+	return &configReloader{app: app, pinned: make(map[string]bool)}
+}
+
+// flagContext 启用了配置重新加载时，返回能够反映最新配置值的 FlagContext
+func (r *configReloader) flagContext(c *cli.Context) infra.FlagContext {
+	if !r.enabled {
+		return c
+	}
+
+	r.lock.Lock()
+	r.cliCtx = c
+	r.lock.Unlock()
+
+	return &reloadableFlagContext{Context: c, reloader: r}
+}
+
+// configSource 重新加载时读取的配置文件，optional 为 true 时配置文件不存在会被忽略
+type configSource struct {
+	file     string
+	optional bool
+}
+
+// sources 返回需要重新加载的配置文件，按照优先级从低到高排列，与启动时的加载顺序保持一致：
+// WithYAMLFlag 指定的配置文件只对其它配置文件中没有的选项生效，因此优先级最低
+func (r *configReloader) sources() []configSource {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.cliCtx == nil {
+		return nil
+	}
+
+	sources := make([]configSource, 0)
+	if r.app.yamlFlag != "" {
+		if file := r.cliCtx.String(r.app.yamlFlag); file != "" {
+			sources = append(sources, configSource{file: file})
+		}
+	}
+
+	if r.app.configFilesFlag != "" {
+		optional := !r.cliCtx.IsSet(r.app.configFilesFlag)
+		for _, file := range r.cliCtx.StringSlice(r.app.configFilesFlag) {
+			sources = append(sources, configSource{file: file, optional: optional})
+		}
+	}
+
+	return sources
+}
+
+// currentValue 返回配置项当前的值，配置项没有被重新加载过时从启动时的 cli.Context 中读取
+func (r *configReloader) currentValue(name string) interface{} {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if val, ok := r.values[name]; ok {
+		return val
+	}
+
+	return r.cliCtx.Value(name)
+}
+
+// value 返回重新加载后配置项的值，配置项没有被重新加载过时返回 false
+func (r *configReloader) value(name string) (interface{}, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	val, ok := r.values[name]
+	return val, ok
+}
+
+// reload 重新读取配置文件，返回值发生变化的配置项
+func (r *configReloader) reload(resolver infra.Resolver) ([]string, error) {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	sources := r.sources()
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	values, err := r.readValues(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]string, 0)
+	for name, val := range values {
+		if !sameConfigValue(r.currentValue(name), val) {
+			changed = append(changed, name)
+		}
+	}
+
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	sort.Strings(changed)
+
+	r.lock.Lock()
+	previous := r.values
+	r.values = values
+	r.lock.Unlock()
+
+	if err := r.rebind(resolver, changed); err != nil {
+		r.lock.Lock()
+		r.values = previous
+		r.lock.Unlock()
+
+		return nil, err
+	}
+
+	r.commitDestinations(values, changed)
+
+	files := make([]string, 0, len(sources))
+	for _, src := range sources {
+		files = append(files, src.file)
+	}
+
+	evt := ConfigChangedEvent{Source: strings.Join(files, ","), Keys: changed}
+	for _, handler := range r.handlers {
+		res, err := resolver.CallWithProvider(handler, resolver.Provider(func() ConfigChangedEvent { return evt }))
+		if err != nil {
+			log.Errorf("[glacier] config change handler failed: %v", err)
+			continue
+		}
+
+		if len(res) > 0 {
+			if err, ok := res[len(res)-1].(error); ok && err != nil {
+				log.Errorf("[glacier] config change handler failed: %v", err)
+			}
+		}
+	}
+
+	_ = resolver.Resolve(func(publisher event.Publisher) {
+		if err := publisher.Publish(evt); err != nil {
+			log.Errorf("[glacier] publish config changed event failed: %v", err)
+		}
+	})
+
+	return changed, nil
+}
+
+// rebind 重新加载 WithConfig 注册的配置结构体，全部加载成功之后再替换容器中的绑定
+func (r *configReloader) rebind(resolver infra.Resolver, changed []string) error {
+	configs := make([]reflect.Value, 0, len(r.configs))
+	if err := resolver.Resolve(func(flagCtx infra.FlagContext) error {
+		for _, conf := range r.configs {
+			val := reflect.New(conf.typ.Elem())
+			if err := loadConfig(flagCtx, val, conf.fields); err != nil {
+				return err
+			}
+
+			configs = append(configs, val)
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	evt := ConfigChangedEvent{Keys: changed}
+	return resolver.Resolve(func(binder infra.Binder) {
+		for _, val := range configs {
+			binder.MustSingletonOverride(configInitializer(val))
+		}
+
+		for _, s := range r.singletons {
+			if len(s.keys) == 0 || evt.HasChanged(s.keys...) {
+				binder.MustSingletonOverride(s.initializer)
+			}
+		}
+	})
+}
+
+// readValues 使用与启动时相同的方式将配置文件应用到一组全新的选项上，返回所有可以重新加载的配置项的值，
+// 配置文件中没有的配置项使用选项的默认值。Apply 到新 FlagSet 上的是不包含 Destination 的选项副本，不会修改应用正在使用的选项
+func (r *configReloader) readValues(sources []configSource) (map[string]interface{}, error) {
+	set := flag.NewFlagSet(r.app.cli.Name, flag.ContinueOnError)
+	flags := make([]cli.Flag, 0, len(r.app.cli.Flags))
+	for _, original := range r.app.cli.Flags {
+		name := original.Names()[0]
+		if r.pinned[name] || name == r.app.yamlFlag || name == r.app.configFilesFlag {
+			continue
+		}
+
+		f, ok := cloneFlag(original)
+		if !ok {
+			continue
+		}
+
+		if err := f.Apply(set); err != nil {
+			return nil, fmt.Errorf("[glacier] config %s: %v", name, err)
+		}
+
+		flags = append(flags, f)
+	}
+
+	c := cli.NewContext(r.app.cli, set, nil)
+
+	// 按照优先级从高到低的顺序加载，每个选项只会从优先级最高的配置文件中读取
+	applied := make(map[string]bool)
+	for i := len(sources) - 1; i >= 0; i-- {
+		src := sources[i]
+		if _, err := os.Stat(src.file); err != nil && src.optional && os.IsNotExist(err) {
+			continue
+		}
+
+		remaining := make([]cli.Flag, 0, len(flags))
+		for _, f := range flags {
+			if !applied[f.Names()[0]] {
+				remaining = append(remaining, f)
+			}
+		}
+
+		names, err := applyConfigFile(c, remaining, src.file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			applied[name] = true
+		}
+	}
+
+	values := make(map[string]interface{})
+	for _, f := range flags {
+		if val, ok := reloadFlagValue(c, f); ok {
+			values[f.Names()[0]] = val
+		}
+	}
+
+	return values, nil
+}
+
+// commitDestinations 将值发生变化的配置项写入原始选项的 Destination
+func (r *configReloader) commitDestinations(values map[string]interface{}, changed []string) {
+	flags := make(map[string]cli.Flag)
+	for _, f := range r.app.cli.Flags {
+		flags[f.Names()[0]] = f
+	}
+
+	for _, name := range changed {
+		f, ok := flags[name]
+		if !ok {
+			continue
+		}
+
+		dest := reflect.ValueOf(unwrapFlag(f)).Elem().FieldByName("Destination")
+		if !dest.IsValid() || dest.IsNil() {
+			continue
+		}
+
+		switch d := dest.Interface().(type) {
+		case *cli.StringSlice:
+			*d = *cli.NewStringSlice(values[name].([]string)...)
+		case *cli.IntSlice:
+			*d = *cli.NewIntSlice(values[name].([]int)...)
+		default:
+			dest.Elem().Set(reflect.ValueOf(values[name]))
+		}
+	}
+}
+
+// cloneFlag 返回不包含 Destination 的选项副本，不支持重新加载的选项返回 false
+func cloneFlag(flag cli.Flag) (cli.Flag, bool) {
+	switch f := flag.(type) {
+	case *altsrc.StringFlag:
+		return altsrc.NewStringFlag(withoutDestination(f.StringFlag)), true
+	case *altsrc.PathFlag:
+		return altsrc.NewPathFlag(withoutDestination(f.PathFlag)), true
+	case *altsrc.BoolFlag:
+		return altsrc.NewBoolFlag(withoutDestination(f.BoolFlag)), true
+	case *altsrc.IntFlag:
+		return altsrc.NewIntFlag(withoutDestination(f.IntFlag)), true
+	case *altsrc.DurationFlag:
+		return altsrc.NewDurationFlag(withoutDestination(f.DurationFlag)), true
+	case *altsrc.Float64Flag:
+		return altsrc.NewFloat64Flag(withoutDestination(f.Float64Flag)), true
+	case *altsrc.StringSliceFlag:
+		return altsrc.NewStringSliceFlag(withoutDestination(f.StringSliceFlag)), true
+	case *altsrc.IntSliceFlag:
+		return altsrc.NewIntSliceFlag(withoutDestination(f.IntSliceFlag)), true
+	case *cli.StringFlag:
+		return withoutDestination(f), true
+	case *cli.PathFlag:
+		return withoutDestination(f), true
+	case *cli.BoolFlag:
+		return withoutDestination(f), true
+	case *cli.IntFlag:
+		return withoutDestination(f), true
+	case *cli.DurationFlag:
+		return withoutDestination(f), true
+	case *cli.Float64Flag:
+		return withoutDestination(f), true
+	case *cli.StringSliceFlag:
+		return withoutDestination(f), true
+	case *cli.IntSliceFlag:
+		return withoutDestination(f), true
+	}
+
+	return nil, false
+}
+
+// withoutDestination 返回选项的浅拷贝，并清空其 Destination
+func withoutDestination[T any](f *T) *T {
+	c := *f
+	if dest := reflect.ValueOf(&c).Elem().FieldByName("Destination"); dest.IsValid() {
+		dest.Set(reflect.Zero(dest.Type()))
+	}
+
+	return &c
+}
+
+// reloadFlagValue 返回选项在 c 中的值，不支持重新加载的选项返回 false
+func reloadFlagValue(c *cli.Context, f cli.Flag) (interface{}, bool) {
+	name := f.Names()[0]
+	switch unwrapFlag(f).(type) {
+	case *cli.StringFlag:
+		return c.String(name), true
+	case *cli.PathFlag:
+		return c.Path(name), true
+	case *cli.BoolFlag:
+		return c.Bool(name), true
+	case *cli.IntFlag:
+		return c.Int(name), true
+	case *cli.DurationFlag:
+		return c.Duration(name), true
+	case *cli.Float64Flag:
+		return c.Float64(name), true
+	case *cli.StringSliceFlag:
+		return c.StringSlice(name), true
+	case *cli.IntSliceFlag:
+		return c.IntSlice(name), true
+	}
+
+	return nil, false
+}
+
+// unwrapFlag 返回 altsrc 包装的原始命令行选项
+func unwrapFlag(flag cli.Flag) cli.Flag {
+	switch f := flag.(type) {
+	case *altsrc.StringFlag:
+		return f.StringFlag
+	case *altsrc.PathFlag:
+		return f.PathFlag
+	case *altsrc.BoolFlag:
+		return f.BoolFlag
+	case *altsrc.IntFlag:
+		return f.IntFlag
+	case *altsrc.DurationFlag:
+		return f.DurationFlag
+	case *altsrc.Float64Flag:
+		return f.Float64Flag
+	case *altsrc.StringSliceFlag:
+		return f.StringSliceFlag
+	case *altsrc.IntSliceFlag:
+		return f.IntSliceFlag
+	}
+
+	return flag
+}
+
+// sameConfigValue 比较配置项的值，空切片与 nil 视为相同
+func sameConfigValue(a, b interface{}) bool {
+	switch v := a.(type) {
+	case *cli.StringSlice:
+		a = v.Value()
+	case *cli.IntSlice:
+		a = v.Value()
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Slice && vb.Kind() == reflect.Slice && va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// reloadableFlagContext 优先返回重新加载后的配置值，其余的选项从 cli.Context 中读取
+type reloadableFlagContext struct {
+	*cli.Context
+	reloader *configReloader
+}
+
+func reloadedValue[T any](fc *reloadableFlagContext, name string) (T, bool) {
+	val, ok := fc.reloader.value(name)
+	if !ok {
+		var empty T
+		return empty, false
+	}
+
+	res, ok := val.(T)
+	return res, ok
+}
+
+func (fc *reloadableFlagContext) String(name string) string {
+	if val, ok := reloadedValue[string](fc, name); ok {
+		return val
+	}
+
+	return fc.Context.String(name)
+}
+
+func (fc *reloadableFlagContext) StringSlice(name string) []string {
+	if val, ok := reloadedValue[[]string](fc, name); ok {
+		return val
+	}
+
+	return fc.Context.StringSlice(name)
+}
+
+func (fc *reloadableFlagContext) Bool(name string) bool {
+	if val, ok := reloadedValue[bool](fc, name); ok {
+		return val
+	}
+
+	return fc.Context.Bool(name)
+}
+
+func (fc *reloadableFlagContext) Int(name string) int {
+	if val, ok := reloadedValue[int](fc, name); ok {
+		return val
+	}
+
+	return fc.Context.Int(name)
+}
+
+func (fc *reloadableFlagContext) IntSlice(name string) []int {
+	if val, ok := reloadedValue[[]int](fc, name); ok {
+		return val
+	}
+
+	return fc.Context.IntSlice(name)
+}
+
+func (fc *reloadableFlagContext) Duration(name string) time.Duration {
+	if val, ok := reloadedValue[time.Duration](fc, name); ok {
+		return val
+	}
+
+	return fc.Context.Duration(name)
+}
+
+func (fc *reloadableFlagContext) Float64(name string) float64 {
+	if val, ok := reloadedValue[float64](fc, name); ok {
+		return val
+	}
+
+	return fc.Context.Float64(name)
+}
+
+// configReloadProvider 在应用重新加载时重新加载配置文件，指定了检查间隔时，同时定期检查配置文件是否被修改
+type configReloadProvider struct {
+	reloader *configReloader
+}
+
+func (p *configReloadProvider) Name() string {
+	return "config-reload"
+}
+
+func (p *configReloadProvider) Register(binder infra.Binder) {}
+
+func (p *configReloadProvider) Boot(resolver infra.Resolver) {
+	resolver.MustResolve(func(gf infra.Graceful) {
+		gf.AddReloadHandler(func() { p.reloadAndLog(resolver) })
+	})
+}
+
+func (p *configReloadProvider) Daemon(ctx context.Context, resolver infra.Resolver) {
+	if p.reloader.interval <= 0 {
+		return
+	}
+
+	resolver.MustResolve(func(clock infra.Clock) {
+		lastStat := configFilesStat(p.reloader.sources())
+		for {
+			timer := clock.NewTimer(p.reloader.interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+
+			if stat := configFilesStat(p.reloader.sources()); stat != lastStat {
+				lastStat = stat
+				p.reloadAndLog(resolver)
+			}
+		}
+	})
+}
+
+func (p *configReloadProvider) reloadAndLog(resolver infra.Resolver) {
+	changed, err := p.reloader.reload(resolver)
+	if err != nil {
+		log.Errorf("[glacier] reload config failed: %v", err)
+		return
+	}
+
+	if len(changed) > 0 && infra.DEBUG {
+		log.Debugf("[glacier] config reloaded, changed: %s", strings.Join(changed, ", "))
+	}
+}
+
+// configFilesStat 返回所有配置文件的修改时间和大小，用于判断配置文件是否被修改
+func configFilesStat(sources []configSource) string {
+	stats := make([]string, 0, len(sources))
+	for _, src := range sources {
+		if stat, err := os.Stat(src.file); err == nil {
+			stats = append(stats, fmt.Sprintf("%d:%d", stat.ModTime().UnixNano(), stat.Size()))
+		} else {
+			stats = append(stats, "")
+		}
+	}
+
+	return strings.Join(stats, ",")
+}
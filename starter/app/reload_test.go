@@ -0,0 +1,239 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/graceful"
+	"github.com/mylxsw/glacier/infra"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+type reloadConfig struct {
+	Workers int `flag:"workers" default:"1"`
+}
+
+type workerPool struct {
+	size int
+}
+
+func TestConfigReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("workers: 2\nname: first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ins := Create("1.0", 1).WithYAMLFlag("conf").WithConfig(&reloadConfig{})
+	ins.AddStringFlag("name", "", "")
+	ins.AddStringFlag("region", "", "")
+	ins.WithConfigReload(0)
+
+	built := 0
+	ins.ReloadableSingleton(func(conf *reloadConfig) *workerPool {
+		built++
+		return &workerPool{size: conf.Workers}
+	}, "workers")
+
+	changes := make(chan ConfigChangedEvent, 1)
+	ins.OnConfigChange(func(evt ConfigChangedEvent) { changes <- evt })
+
+	ready := make(chan infra.Resolver, 1)
+	ins.Glacier().Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	ins.Glacier().OnServerReady(func(resolver infra.Resolver) { ready <- resolver })
+
+	errs := make(chan error, 1)
+	go func() { errs <- ins.Run([]string{"app", "--conf", file, "--region", "cn"}) }()
+
+	var resolver infra.Resolver
+	select {
+	case resolver = <-ready:
+	case err := <-errs:
+		t.Fatalf("application exited: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("application is not ready")
+	}
+
+	resolver.MustResolve(func(pool *workerPool) {
+		if pool.size != 2 {
+			t.Errorf("expected pool size 2, got %d", pool.size)
+		}
+	})
+
+	if err := os.WriteFile(file, []byte("workers: 4\nregion: us\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver.MustResolve(func(gf infra.Graceful) { gf.Reload() })
+
+	select {
+	case evt := <-changes:
+		if len(evt.Keys) != 2 || evt.Keys[0] != "name" || evt.Keys[1] != "workers" || evt.Source != file {
+			t.Errorf("unexpected config changed event: %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("config change is not notified")
+	}
+
+	resolver.MustResolve(func(fc infra.FlagContext, conf *reloadConfig, pool *workerPool, gf infra.Graceful) {
+		// 命令行中指定的选项不会被配置文件覆盖，配置文件中删除的选项恢复为默认值
+		if fc.Int("workers") != 4 || fc.String("region") != "cn" || fc.String("name") != "" {
+			t.Errorf("unexpected flag values: %d, %q, %q", fc.Int("workers"), fc.String("region"), fc.String("name"))
+		}
+
+		if conf.Workers != 4 || pool.size != 4 || built != 2 {
+			t.Errorf("unexpected rebuilt values: %d, %d, %d", conf.Workers, pool.size, built)
+		}
+
+		gf.Shutdown()
+	})
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("application is not stopped")
+	}
+}
+
+func TestConfigReloadWithConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	base, prod := filepath.Join(dir, "base.yaml"), filepath.Join(dir, "prod.toml")
+	if err := os.WriteFile(base, []byte("name: base\nregion: base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prod, []byte("region = \"prod\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ins := Create("1.0", 1).WithConfigFiles("conf")
+	ins.AddStringFlag("name", "", "")
+	ins.AddStringFlag("region", "", "")
+	ins.WithConfigReload(0)
+
+	changes := make(chan ConfigChangedEvent, 1)
+	ins.OnConfigChange(func(evt ConfigChangedEvent) { changes <- evt })
+
+	ready := make(chan infra.Resolver, 1)
+	ins.Glacier().Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	ins.Glacier().OnServerReady(func(resolver infra.Resolver) { ready <- resolver })
+
+	errs := make(chan error, 1)
+	go func() { errs <- ins.Run([]string{"app", "--conf", base, "--conf", prod}) }()
+
+	var resolver infra.Resolver
+	select {
+	case resolver = <-ready:
+	case err := <-errs:
+		t.Fatalf("application exited: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("application is not ready")
+	}
+
+	// region 被优先级更高的 prod.toml 覆盖，修改 base.yaml 中的 region 不会导致变化
+	if err := os.WriteFile(base, []byte("name: changed\nregion: changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver.MustResolve(func(gf infra.Graceful) { gf.Reload() })
+
+	select {
+	case evt := <-changes:
+		if len(evt.Keys) != 1 || evt.Keys[0] != "name" || evt.Source != base+","+prod {
+			t.Errorf("unexpected config changed event: %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("config change is not notified")
+	}
+
+	resolver.MustResolve(func(fc infra.FlagContext, gf infra.Graceful) {
+		if fc.String("name") != "changed" || fc.String("region") != "prod" {
+			t.Errorf("unexpected flag values: %q, %q", fc.String("name"), fc.String("region"))
+		}
+
+		gf.Shutdown()
+	})
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("application is not stopped")
+	}
+}
+
+type levelConfig struct {
+	Max int `flag:"max"`
+}
+
+func (c *levelConfig) Validate() error {
+	if c.Max > 10 {
+		return errors.New("max must not be greater than 10")
+	}
+	return nil
+}
+
+func TestConfigReloadDestination(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("level: 2\nmax: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var level int
+	ins := Create("1.0", 1).WithYAMLFlag("conf")
+	ins.AddFlags(altsrc.NewIntFlag(&cli.IntFlag{Name: "level", Destination: &level}))
+	ins.WithConfig(&levelConfig{}).WithConfigReload(0)
+
+	ready := make(chan infra.Resolver, 1)
+	ins.Glacier().Graceful(func() infra.Graceful { return graceful.NewWithoutSignal(time.Second) })
+	ins.Glacier().OnServerReady(func(resolver infra.Resolver) { ready <- resolver })
+
+	errs := make(chan error, 1)
+	go func() { errs <- ins.Run([]string{"app", "--conf", file}) }()
+
+	var resolver infra.Resolver
+	select {
+	case resolver = <-ready:
+	case err := <-errs:
+		t.Fatalf("application exited: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("application is not ready")
+	}
+
+	if level != 2 {
+		t.Fatalf("expected level 2, got %d", level)
+	}
+
+	// 校验失败时放弃本次加载，Destination 保持不变
+	if err := os.WriteFile(file, []byte("level: 7\nmax: 20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ins.reloader.reload(resolver); err == nil {
+		t.Fatal("expected validate error")
+	}
+	if level != 2 {
+		t.Errorf("destination should not change when reload fails, got %d", level)
+	}
+
+	if err := os.WriteFile(file, []byte("level: 5\nmax: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ins.reloader.reload(resolver); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level != 5 {
+		t.Errorf("expected level 5, got %d", level)
+	}
+
+	resolver.MustResolve(func(gf infra.Graceful) { gf.Shutdown() })
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+// 配置值的来源，配置文件来源使用文件路径表示
+const (
+	ConfigOriginFlag    = "flag"
+	ConfigOriginEnv     = "env"
+	ConfigOriginDefault = "default"
+)
+
+// ConfigOrigin 配置项的最终取值以及其来源
+type ConfigOrigin struct {
+	Key   string
+	Value string
+	// Source 配置值的来源：flag、env（env:变量名）、配置文件路径或者 default
+	Source string
+}
+
+// WithConfigFiles 添加指定配置文件的命令行选项，该选项可以指定多次，也可以使用 , 分隔多个文件，没有指定时使用 defaults
+//
+// 配置文件的格式根据扩展名识别，支持 .yaml/.yml、.toml、.json 以及 .env（按照选项的环境变量名称匹配），
+// 配置项的优先级为：命令行选项 > 环境变量 > 后面的配置文件 > 前面的配置文件 > 选项默认值，比如
+//
+//	--conf base.yaml --conf prod.toml --conf secrets.env
+//
+// 命令行中指定的文件不存在时返回错误，defaults 中的文件不存在时会被忽略。
+// 只有使用 altsrc 包装的选项（.env 文件除外）才会从配置文件中读取
+func (app *App) WithConfigFiles(flagName string, defaults ...string) *App {
+	app.AddFlags(&cli.StringSliceFlag{
+		Name:  flagName,
+		Value: cli.NewStringSlice(defaults...),
+		Usage: "configuration files, later files override earlier ones (yaml, toml, json, env)",
+	})
+	app.configFilesFlag = flagName
+
+	before := app.cli.Before
+	app.cli.Before = func(c *cli.Context) error {
+		files := c.StringSlice(flagName)
+		if err := app.applyConfigFiles(c, files, !c.IsSet(flagName)); err != nil {
+			return err
+		}
+
+		if before == nil {
+			return nil
+		}
+
+		return before(c)
+	}
+
+	return app
+}
+
+// WithConfigDumpCommand 添加输出所有配置项的最终取值以及来源的子命令，用于排查配置问题
+func (app *App) WithConfigDumpCommand(name string) *App {
+	app.cli.Commands = append(app.cli.Commands, &cli.Command{
+		Name:  name,
+		Usage: "print the effective value of each flag and the layer it came from",
+		Action: func(c *cli.Context) error {
+			w := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+			for _, origin := range app.ConfigOrigins(c) {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", origin.Key, origin.Value, origin.Source)
+			}
+
+			return w.Flush()
+		},
+	})
+
+	return app
+}
+
+// ConfigOrigins 返回所有命令行选项的最终取值以及来源，按照选项添加的顺序排列
+func (app *App) ConfigOrigins(c *cli.Context) []ConfigOrigin {
+	origins := make([]ConfigOrigin, 0, len(app.cli.Flags))
+	for _, flag := range app.cli.Flags {
+		name := flag.Names()[0]
+		source, ok := app.configOrigins[name]
+		if !ok {
+			source = ConfigOriginDefault
+		}
+
+		origins = append(origins, ConfigOrigin{
+			Key:    name,
+			Value:  configDisplayValue(c.Value(name)),
+			Source: source,
+		})
+	}
+
+	return origins
+}
+
+// applyConfigFiles 按照优先级从高到低的顺序加载配置文件，每个选项只会从优先级最高的来源中读取
+func (app *App) applyConfigFiles(c *cli.Context, files []string, optional bool) error {
+	// 加载配置文件之前已经设置的选项，来自命令行或者环境变量
+	for _, flag := range app.cli.Flags {
+		name := flag.Names()[0]
+		if !c.IsSet(name) {
+			continue
+		}
+
+		if env, ok := flagEnvSet(flag); ok && !app.flagInArgs(flag) {
+			app.configOrigins[name] = ConfigOriginEnv + ":" + env
+		} else {
+			app.configOrigins[name] = ConfigOriginFlag
+		}
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		if _, err := os.Stat(file); err != nil && optional && os.IsNotExist(err) {
+			continue
+		}
+
+		// 已经从优先级更高的来源中读取的选项不再处理
+		flags := make([]cli.Flag, 0, len(app.cli.Flags))
+		for _, flag := range app.cli.Flags {
+			if _, ok := app.configOrigins[flag.Names()[0]]; !ok {
+				flags = append(flags, flag)
+			}
+		}
+
+		applied, err := applyConfigFile(c, flags, file)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range applied {
+			app.configOrigins[name] = file
+		}
+	}
+
+	if infra.DEBUG {
+		for _, origin := range app.ConfigOrigins(c) {
+			log.Debugf("[glacier] config %s=%s (%s)", origin.Key, origin.Value, origin.Source)
+		}
+	}
+
+	return nil
+}
+
+// applyConfigFile 将配置文件中的值应用到选项上，返回从配置文件中读取了值的选项
+func applyConfigFile(c *cli.Context, flags []cli.Flag, file string) ([]string, error) {
+	var src altsrc.InputSourceContext
+	var err error
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		src, err = altsrc.NewYamlSourceFromFile(file)
+	case ".toml":
+		src, err = altsrc.NewTomlSourceFromFile(file)
+	case ".json":
+		src, err = altsrc.NewJSONSourceFromFile(file)
+	case ".env":
+		return applyDotEnvFile(c, flags, file)
+	default:
+		return nil, fmt.Errorf("[glacier] unsupported config file format: %s", file)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("[glacier] load config file %s failed: %v", file, err)
+	}
+
+	recorder := &recordingSource{InputSourceContext: src}
+	if err := altsrc.ApplyInputSourceValues(c, recorder, flags); err != nil {
+		return nil, err
+	}
+
+	applied := make([]string, 0, len(recorder.names))
+	for _, flag := range flags {
+		for _, name := range flag.Names() {
+			if recorder.names[name] {
+				applied = append(applied, flag.Names()[0])
+				break
+			}
+		}
+	}
+
+	return applied, nil
+}
+
+// recordingSource 记录从配置文件中读取过的选项，altsrc 只会读取配置文件中存在的选项
+type recordingSource struct {
+	altsrc.InputSourceContext
+	names map[string]bool
+}
+
+func (s *recordingSource) record(name string) {
+	if s.names == nil {
+		s.names = make(map[string]bool)
+	}
+
+	s.names[name] = true
+}
+
+func (s *recordingSource) Int(name string) (int, error) {
+	s.record(name)
+	return s.InputSourceContext.Int(name)
+}
+
+func (s *recordingSource) Duration(name string) (time.Duration, error) {
+	s.record(name)
+	return s.InputSourceContext.Duration(name)
+}
+
+func (s *recordingSource) Float64(name string) (float64, error) {
+	s.record(name)
+	return s.InputSourceContext.Float64(name)
+}
+
+func (s *recordingSource) String(name string) (string, error) {
+	s.record(name)
+	return s.InputSourceContext.String(name)
+}
+
+func (s *recordingSource) StringSlice(name string) ([]string, error) {
+	s.record(name)
+	return s.InputSourceContext.StringSlice(name)
+}
+
+func (s *recordingSource) IntSlice(name string) ([]int, error) {
+	s.record(name)
+	return s.InputSourceContext.IntSlice(name)
+}
+
+func (s *recordingSource) Int64Slice(name string) ([]int64, error) {
+	s.record(name)
+	return s.InputSourceContext.Int64Slice(name)
+}
+
+func (s *recordingSource) Generic(name string) (cli.Generic, error) {
+	s.record(name)
+	return s.InputSourceContext.Generic(name)
+}
+
+func (s *recordingSource) Bool(name string) (bool, error) {
+	s.record(name)
+	return s.InputSourceContext.Bool(name)
+}
+
+// applyDotEnvFile 将 .env 文件中的变量应用到环境变量名称匹配的选项上
+func applyDotEnvFile(c *cli.Context, flags []cli.Flag, file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("[glacier] load config file %s failed: %v", file, err)
+	}
+
+	values, err := parseDotEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("[glacier] load config file %s failed: %v", file, err)
+	}
+
+	applied := make([]string, 0)
+	for _, flag := range flags {
+		name := flag.Names()[0]
+		if c.IsSet(name) {
+			continue
+		}
+
+		if _, ok := flagEnvSet(flag); ok {
+			continue
+		}
+
+		for _, env := range flagEnvVars(flag) {
+			if val, ok := values[env]; ok {
+				if err := c.Set(name, val); err != nil {
+					return nil, fmt.Errorf("[glacier] config %s: invalid value of %s in %s: %v", name, env, file, err)
+				}
+
+				applied = append(applied, name)
+				break
+			}
+		}
+	}
+
+	return applied, nil
+}
+
+// parseDotEnv 解析 .env 文件，支持 # 注释、export 前缀以及使用单引号或者双引号包裹的值
+func parseDotEnv(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing =", lineNo)
+		}
+
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		switch {
+		case len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"':
+			unquoted, err := strconv.Unquote(val)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			val = unquoted
+		case len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'':
+			val = val[1 : len(val)-1]
+		default:
+			if idx := strings.Index(val, " #"); idx >= 0 {
+				val = strings.TrimSpace(val[:idx])
+			}
+		}
+
+		values[key] = val
+	}
+
+	return values, scanner.Err()
+}
+
+// flagInArgs 判断选项是否在命令行参数中指定
+func (app *App) flagInArgs(flag cli.Flag) bool {
+	for _, arg := range app.args {
+		if arg == "--" {
+			return false
+		}
+
+		arg = strings.TrimLeft(arg, "-")
+		for _, name := range flag.Names() {
+			if arg == name || strings.HasPrefix(arg, name+"=") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// flagEnvVars 返回选项关联的环境变量名称
+func flagEnvVars(flag cli.Flag) []string {
+	if f, ok := flag.(interface{ GetEnvVars() []string }); ok {
+		return f.GetEnvVars()
+	}
+
+	return nil
+}
+
+// flagEnvSet 返回选项关联的环境变量中第一个已经设置的变量名称
+func flagEnvSet(flag cli.Flag) (string, bool) {
+	for _, env := range flagEnvVars(flag) {
+		if _, ok := os.LookupEnv(strings.TrimSpace(env)); ok {
+			return env, true
+		}
+	}
+
+	return "", false
+}
+
+func setFlagNames(c *cli.Context) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range c.FlagNames() {
+		set[name] = true
+	}
+
+	return set
+}
+
+// configDisplayValue 返回配置值用于展示的字符串形式
+func configDisplayValue(val interface{}) string {
+	switch v := val.(type) {
+	case *cli.StringSlice:
+		return strings.Join(v.Value(), ",")
+	case cli.StringSlice:
+		return strings.Join(v.Value(), ",")
+	case *cli.IntSlice:
+		return strings.Trim(strings.Join(strings.Fields(fmt.Sprint(v.Value())), ","), "[]")
+	case cli.IntSlice:
+		return strings.Trim(strings.Join(strings.Fields(fmt.Sprint(v.Value())), ","), "[]")
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprint(val)
+}
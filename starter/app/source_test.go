@@ -0,0 +1,120 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+func TestConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yaml":   "name: base\nregion: base\nworkers: 1\ndb:\n  host: localhost\n",
+		"prod.toml":   "name = \"prod\"\n[db]\nhost = \"db.prod\"\n",
+		"extra.json":  `{"tags": ["a", "b"]}`,
+		"secrets.env": "# secrets\nexport DB_PASSWORD=\"p@ss\"\nAPP_REGION=file\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("APP_REGION", "env")
+
+	ins := Create("1.0", 1).WithConfigFiles("conf", filepath.Join(dir, "missing.yaml"))
+	ins.AddFlags(
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "name"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "region", EnvVars: []string{"APP_REGION"}}),
+		altsrc.NewIntFlag(&cli.IntFlag{Name: "workers", Value: 3}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "db.host"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "tags"}),
+		&cli.StringFlag{Name: "db.password", EnvVars: []string{"DB_PASSWORD"}},
+		&cli.IntFlag{Name: "port", Value: 8080},
+	)
+
+	var origins map[string]ConfigOrigin
+	ins.cli.Action = func(c *cli.Context) error {
+		origins = make(map[string]ConfigOrigin)
+		for _, origin := range ins.ConfigOrigins(c) {
+			origins[origin.Key] = origin
+		}
+		return nil
+	}
+
+	args := []string{"app", "--workers", "5"}
+	for _, name := range []string{"base.yaml", "prod.toml", "extra.json", "secrets.env"} {
+		args = append(args, "--conf", filepath.Join(dir, name))
+	}
+
+	if err := ins.Run(args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]ConfigOrigin{
+		"name":        {Value: "prod", Source: filepath.Join(dir, "prod.toml")},
+		"region":      {Value: "env", Source: "env:APP_REGION"},
+		"workers":     {Value: "5", Source: ConfigOriginFlag},
+		"db.host":     {Value: "db.prod", Source: filepath.Join(dir, "prod.toml")},
+		"tags":        {Value: "a,b", Source: filepath.Join(dir, "extra.json")},
+		"db.password": {Value: "p@ss", Source: filepath.Join(dir, "secrets.env")},
+		"port":        {Value: "8080", Source: ConfigOriginDefault},
+	}
+	for key, exp := range expected {
+		if got := origins[key]; got.Value != exp.Value || got.Source != exp.Source {
+			t.Errorf("config %s: expected %s from %s, got %s from %s", key, exp.Value, exp.Source, got.Value, got.Source)
+		}
+	}
+
+	// 命令行中指定的文件不存在时返回错误
+	if err := ins.Run([]string{"app", "--conf", filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("expected error for missing config file")
+	}
+}
+
+func TestConfigFilesWithYAMLFlag(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"legacy.yaml": "name: legacy\nregion: legacy\n",
+		"prod.toml":   "name = \"prod\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// WithYAMLFlag 在 WithConfigFiles 之后调用时，不会覆盖分层配置文件
+	ins := Create("1.0", 1).WithConfigFiles("conf").WithYAMLFlag("yaml")
+	ins.AddFlags(
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "name"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "region"}),
+	)
+
+	var origins map[string]ConfigOrigin
+	ins.cli.Action = func(c *cli.Context) error {
+		origins = make(map[string]ConfigOrigin)
+		for _, origin := range ins.ConfigOrigins(c) {
+			origins[origin.Key] = origin
+		}
+		return nil
+	}
+
+	args := []string{"app", "--conf", filepath.Join(dir, "prod.toml"), "--yaml", filepath.Join(dir, "legacy.yaml")}
+	if err := ins.Run(args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]ConfigOrigin{
+		"name":   {Value: "prod", Source: filepath.Join(dir, "prod.toml")},
+		"region": {Value: "legacy", Source: filepath.Join(dir, "legacy.yaml")},
+	}
+	for key, exp := range expected {
+		if got := origins[key]; got.Value != exp.Value || got.Source != exp.Source {
+			t.Errorf("config %s: expected %s from %s, got %s from %s", key, exp.Value, exp.Source, got.Value, got.Source)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package glacier
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/log"
+)
+
+// WithStartupReport 设置是否在应用就绪后输出启动耗时报告，以及单个模块步骤的慢启动告警阈值（0 表示不告警）
+func (impl *framework) WithStartupReport(print bool, slowThreshold time.Duration) infra.Glacier {
+	if impl.status >= Initialized {
+		panic("[glacier] can not invoke this method after Glacier has been initialize")
+	}
+
+	impl.printStartupReport = print
+	impl.slowModuleThreshold = slowThreshold
+	return impl
+}
+
+// StartupReport 返回应用启动耗时报告
+func (impl *framework) StartupReport() infra.StartupReport {
+	impl.startupLock.Lock()
+	defer impl.startupLock.Unlock()
+
+	return infra.StartupReport{
+		Steps: append([]infra.StartupStep{}, impl.startupSteps...),
+		Took:  impl.startupTook,
+	}
+}
+
+// recordStartupStep 记录模块启动步骤的耗时，超过慢启动阈值时输出告警，返回步骤耗时
+func (impl *framework) recordStartupStep(module string, step infra.StartupStepKind, startTs time.Time) time.Duration {
+	took := impl.clock.Since(startTs)
+	slow := impl.slowModuleThreshold > 0 && took > impl.slowModuleThreshold
+	if slow && infra.WARN {
+		log.Warningf("[glacier] %s of module %s is slow, took %s (threshold %s)", step, module, took, impl.slowModuleThreshold)
+	}
+
+	impl.startupLock.Lock()
+	defer impl.startupLock.Unlock()
+
+	impl.startupSteps = append(impl.startupSteps, infra.StartupStep{Module: module, Step: step, Duration: took, Slow: slow})
+	return took
+}
+
+// finishStartupReport 记录应用启动总耗时，按需输出启动耗时报告
+func (impl *framework) finishStartupReport() {
+	impl.startupLock.Lock()
+	impl.startupTook = impl.clock.Since(impl.startTime)
+	impl.startupLock.Unlock()
+
+	if impl.printStartupReport {
+		log.Infof("[glacier] startup report\n%s", formatStartupReport(impl.StartupReport()))
+	}
+}
+
+// formatStartupReport 将启动耗时报告格式化为表格
+func formatStartupReport(report infra.StartupReport) string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "MODULE\tSTEP\tDURATION\tSLOW")
+	for _, step := range report.Steps {
+		slow := ""
+		if step.Slow {
+			slow = "yes"
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.Module, step.Step, step.Duration, slow)
+	}
+	_, _ = fmt.Fprintf(w, "TOTAL\t\t%s\t\n", report.Took)
+
+	_ = w.Flush()
+	return buf.String()
+}
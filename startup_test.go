@@ -0,0 +1,58 @@
+package glacier
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+type slowProvider struct{}
+
+func (slowProvider) Register(binder infra.Binder) {}
+func (slowProvider) ShouldLoad() bool             { return true }
+func (slowProvider) Boot(resolver infra.Resolver) { time.Sleep(20 * time.Millisecond) }
+
+func TestStartupReport(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.WithStartupReport(false, 10*time.Millisecond)
+	impl.Provider(slowProvider{})
+	impl.cc = ioc.New()
+
+	// 计算启动计划、校验等场景过滤 providers 时不记录启动步骤
+	if _, _, err := impl.filterProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if steps := impl.StartupReport().Steps; len(steps) != 0 {
+		t.Fatalf("filter providers should not record startup steps, got %+v", steps)
+	}
+
+	if err := impl.registerProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := impl.bootProviders(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := impl.StartupReport()
+	if len(report.Steps) != 3 {
+		t.Fatalf("expect 3 steps, got %d", len(report.Steps))
+	}
+
+	var steps []string
+	for _, step := range report.Steps {
+		steps = append(steps, string(step.Step))
+	}
+	if strings.Join(steps, ",") != "ShouldLoad,Register,Boot" {
+		t.Errorf("unexpected steps: %v", steps)
+	}
+
+	slowest := report.Slowest(1)
+	if len(slowest) != 1 || slowest[0].Step != infra.StartupStepBoot || !slowest[0].Slow {
+		t.Errorf("expect boot step to be the slowest one, got %+v", slowest)
+	}
+
+	t.Log("\n" + formatStartupReport(report))
+}
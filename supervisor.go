@@ -0,0 +1,132 @@
+package glacier
+
+import (
+	"context"
+	"time"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/glacier/lifecycle"
+	"github.com/mylxsw/glacier/log"
+)
+
+const (
+	defaultRestartInitialBackoff = time.Second
+	defaultRestartMaxBackoff     = time.Minute
+)
+
+// resolveSupervision 获取服务的监管配置，未实现 infra.Supervisable 接口的服务退出后不再重启
+func resolveSupervision(s *serviceEntry) infra.Supervision {
+	sup := infra.Supervision{Policy: infra.RestartNever}
+	if sv, ok := s.service.(infra.Supervisable); ok {
+		sup = sv.Supervision()
+	}
+
+	if sup.InitialBackoff <= 0 {
+		sup.InitialBackoff = defaultRestartInitialBackoff
+	}
+
+	if sup.MaxBackoff <= 0 {
+		sup.MaxBackoff = defaultRestartMaxBackoff
+	}
+
+	if sup.MaxBackoff < sup.InitialBackoff {
+		sup.MaxBackoff = sup.InitialBackoff
+	}
+
+	return sup
+}
+
+func shouldRestartService(policy infra.RestartPolicy, err error) bool {
+	switch policy {
+	case infra.RestartAlways:
+		return true
+	case infra.RestartOnFailure:
+		return err != nil
+	}
+
+	return false
+}
+
+// superviseService 启动服务，并在服务退出后按照重启策略决定是否重启
+// 应用停机过程中服务退出属于正常情况，不会触发重启
+// 关键服务只有在因为错误（包括 panic）彻底停止时才会触发应用停机，正常返回（err 为 nil）视为服务已经完成工作
+func (impl *framework) superviseService(ctx context.Context, gf infra.Graceful, s *serviceEntry) {
+	sup := resolveSupervision(s)
+	backoff := sup.InitialBackoff
+
+	var restarts int
+	var err error
+	for {
+		var panicInfo *infra.PanicInfo
+
+		startTs := impl.clock.Now()
+		impl.publishLifecycleEvent(lifecycle.ServiceStarted{Name: s.Name(), Time: startTs})
+		panicInfo, err = impl.startService(s)
+		impl.publishLifecycleEvent(lifecycle.ServiceStopped{Name: s.Name(), Time: impl.clock.Now(), Duration: impl.clock.Since(startTs), Err: err})
+
+		if err != nil {
+			log.Errorf("[glacier] service %s stopped with error: %v", s.Name(), err)
+		} else if infra.DEBUG {
+			log.Debugf("[glacier] service %s stopped", s.Name())
+		}
+
+		if impl.currentStatus() >= Stopping || ctx.Err() != nil {
+			return
+		}
+
+		// 发生 panic 时由服务的 panic 处理策略决定是否重启，否则由重启策略决定
+		if panicInfo != nil {
+			if panicInfo.Policy == infra.PanicPolicyShutdown {
+				impl.shutdownOnPanic(gf, *panicInfo)
+				return
+			}
+
+			if panicInfo.Policy == infra.PanicPolicyIgnore {
+				break
+			}
+		} else if !shouldRestartService(sup.Policy, err) {
+			break
+		}
+
+		if sup.MaxRestarts > 0 && restarts >= sup.MaxRestarts {
+			log.Errorf("[glacier] service %s has been restarted %d times, give up", s.Name(), restarts)
+			break
+		}
+
+		restarts++
+		if infra.WARN {
+			log.Warningf("[glacier] service %s will be restarted in %s (%s, attempt %d)", s.Name(), backoff, sup.Policy, restarts)
+		}
+
+		timer := impl.clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		if impl.currentStatus() >= Stopping {
+			return
+		}
+
+		backoff *= 2
+		if backoff > sup.MaxBackoff {
+			backoff = sup.MaxBackoff
+		}
+	}
+
+	if !sup.Critical {
+		return
+	}
+
+	if err == nil {
+		if infra.WARN {
+			log.Warningf("[glacier] critical service %s exited without error, application keeps running", s.Name())
+		}
+		return
+	}
+
+	log.Errorf("[glacier] critical service %s is down, application will shutdown", s.Name())
+	gf.Shutdown()
+}
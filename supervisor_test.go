@@ -0,0 +1,110 @@
+package glacier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/clock"
+	"github.com/mylxsw/glacier/infra"
+)
+
+type supervisedService struct {
+	clock       infra.Clock
+	supervision infra.Supervision
+	failures    int
+	starts      []time.Time
+}
+
+func (s *supervisedService) Start() error {
+	s.starts = append(s.starts, s.clock.Now())
+	if len(s.starts) <= s.failures {
+		return errors.New("failed")
+	}
+
+	return nil
+}
+
+func (s *supervisedService) Supervision() infra.Supervision { return s.supervision }
+
+func TestSuperviseServiceBackoff(t *testing.T) {
+	startTs := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(startTs)
+
+	impl := New("1.0", 1).(*framework)
+	impl.WithClock(fake)
+
+	srv := &supervisedService{clock: fake, failures: 3, supervision: infra.Supervision{
+		Policy:         infra.RestartOnFailure,
+		InitialBackoff: time.Second,
+		MaxBackoff:     3 * time.Second,
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		impl.superviseService(context.Background(), &readyTestGraceful{shutdown: make(chan struct{})}, newServiceEntry(srv))
+	}()
+
+	// 重启间隔依次为 1s、2s、3s（达到 MaxBackoff 上限）
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		fake.BlockUntil(1)
+		fake.Advance(backoff)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("service should not be restarted after it returns nil")
+	}
+
+	expected := []time.Duration{0, time.Second, 3 * time.Second, 6 * time.Second}
+	if len(srv.starts) != len(expected) {
+		t.Fatalf("unexpected starts: %v", srv.starts)
+	}
+
+	for i, offset := range expected {
+		if !srv.starts[i].Equal(startTs.Add(offset)) {
+			t.Errorf("start %d: expect %s, got %s", i, startTs.Add(offset), srv.starts[i])
+		}
+	}
+}
+
+func TestSuperviseCriticalService(t *testing.T) {
+	testCases := []struct {
+		name        string
+		failures    int
+		supervision infra.Supervision
+		shutdown    bool
+	}{
+		{name: "returns nil", supervision: infra.Supervision{Critical: true}, shutdown: false},
+		{name: "returns error", failures: 1, supervision: infra.Supervision{Critical: true}, shutdown: true},
+		{name: "not critical", failures: 1, supervision: infra.Supervision{}, shutdown: false},
+		{name: "restarts exhausted", failures: 10, supervision: infra.Supervision{
+			Policy:         infra.RestartOnFailure,
+			MaxRestarts:    1,
+			InitialBackoff: time.Millisecond,
+			Critical:       true,
+		}, shutdown: true},
+	}
+
+	for _, tc := range testCases {
+		impl := New("1.0", 1).(*framework)
+		srv := &supervisedService{clock: impl.clock, failures: tc.failures, supervision: tc.supervision}
+		gf := &readyTestGraceful{shutdown: make(chan struct{})}
+
+		impl.superviseService(context.Background(), gf, newServiceEntry(srv))
+
+		var shutdown bool
+		select {
+		case <-gf.shutdown:
+			shutdown = true
+		default:
+		}
+
+		if shutdown != tc.shutdown {
+			t.Errorf("%s: expect shutdown=%v, got %v", tc.name, tc.shutdown, shutdown)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package glacier
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mylxsw/glacier/infra"
+	"github.com/mylxsw/go-ioc"
+)
+
+// ValidationProblem 校验过程中发现的问题
+type ValidationProblem struct {
+	// Source 问题来源，比如 provider xxx、onServerReady hook xxx
+	Source  string
+	Message string
+}
+
+// ValidationError 校验失败时返回的错误，包含所有发现的问题
+type ValidationError struct {
+	Problems []ValidationProblem
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		messages = append(messages, fmt.Sprintf("  - %s: %s", p.Source, p.Message))
+	}
+
+	return fmt.Sprintf("[glacier] validation failed, %d problems found:\n%s", len(e.Problems), strings.Join(messages, "\n"))
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Validate 校验容器绑定关系是否完整，不会启动 Daemon、Service 以及优雅停机的信号监听
+// 该方法会执行 initStage、diBindStage 以及所有 Provider 的 Register 方法，之后静态检查 Boot、Init、OnServerReady、Async
+// 函数签名以及需要自动注入的结构体字段能否被容器满足，一次性返回所有缺失的绑定，静态检查通过后再为所有 Service 注入依赖，
+// Provider 和 Service 注册在全局容器的一次性子容器中，只能在 Start 之外单独调用
+func (impl *framework) Validate(flagCtx infra.FlagContext) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("[glacier] validation failed with a panic: %v", rec)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flagCtx = impl.activateProfile(flagCtx)
+	if err := impl.initStage(flagCtx); err != nil {
+		return err
+	}
+
+	if err := impl.diBindStage(ctx, flagCtx); err != nil {
+		return err
+	}
+
+	// 在模块列表的副本上过滤并注册，不会修改 impl.providers/impl.services 以及其中的 entry，之后依然可以正常启动应用
+	providers, _, err := impl.filterProviderEntries(impl.cc, copyEntries(impl.providers), nil, false)
+	if err != nil {
+		return err
+	}
+
+	services, _, err := impl.filterServiceEntries(impl.cc, copyEntries(impl.services), nil, false)
+	if err != nil {
+		return err
+	}
+
+	cc := newScopedContainer(impl.cc)
+	if err := impl.registerProviderEntries(cc, "", providers); err != nil {
+		return err
+	}
+
+	problems := newBindingChecker(impl.cc).scoped(cc).check(impl, cc, providers, services)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	// 静态检查通过后为 Service 注入依赖，自动注入会创建依赖的对象
+	for _, s := range services {
+		if err := impl.registerServiceEntries(cc, []*serviceEntry{s}); err != nil {
+			problems = append(problems, ValidationProblem{Source: "service " + s.Name(), Message: err.Error()})
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// copyEntries 返回模块列表的浅拷贝，每个 entry 都是新的对象
+func copyEntries[T any](entries []*T) []*T {
+	copied := make([]*T, 0, len(entries))
+	for _, e := range entries {
+		c := *e
+		copied = append(copied, &c)
+	}
+
+	return copied
+}
+
+// bindingChecker 根据容器中已经绑定的 key 静态检查依赖能否被满足，不会创建任何对象
+type bindingChecker struct {
+	keys     map[interface{}]bool
+	problems *[]ValidationProblem
+}
+
+func newBindingChecker(cc infra.Container) *bindingChecker {
+	keys := make(map[interface{}]bool)
+	for _, k := range cc.Keys() {
+		keys[k] = true
+	}
+
+	problems := make([]ValidationProblem, 0)
+	return &bindingChecker{keys: keys, problems: &problems}
+}
+
+// scoped 返回用于检查 ScopedProvider 的 checker，子容器中的绑定对该 Provider 可见
+func (c *bindingChecker) scoped(cc ioc.Container) *bindingChecker {
+	keys := make(map[interface{}]bool)
+	for k := range c.keys {
+		keys[k] = true
+	}
+	for _, k := range cc.Keys() {
+		keys[k] = true
+	}
+
+	return &bindingChecker{keys: keys, problems: c.problems}
+}
+
+// operationScoped 返回用于检查在作用域中执行的函数（比如异步任务）的 checker，infra.Scope 以及作用域绑定对其可见
+func (c *bindingChecker) operationScoped(scopes *scopeFactory) *bindingChecker {
+	keys := make(map[interface{}]bool)
+	for k := range c.keys {
+		keys[k] = true
+	}
+
+	keys[reflect.TypeOf((*infra.Scope)(nil)).Elem()] = true
+
+	scopes.lock.RLock()
+	defer scopes.lock.RUnlock()
+
+	for _, i := range scopes.initializers {
+		if key := initializerKey(i); key != nil {
+			keys[key] = true
+		}
+	}
+
+	return &bindingChecker{keys: keys, problems: c.problems}
+}
+
+// check 检查全局绑定、providers、services 以及钩子和异步任务的依赖能否被满足，cc 为 providers 注册时使用的容器
+func (c *bindingChecker) check(impl *framework, cc ioc.Container, providers []*providerEntry, services []*serviceEntry) []ValidationProblem {
+	for _, ins := range impl.singletons {
+		c.checkInitializer("singleton", ins)
+	}
+	for _, ins := range impl.prototypes {
+		c.checkInitializer("prototype", ins)
+	}
+
+	sc := c.operationScoped(impl.scopes)
+	for _, ins := range impl.scoped {
+		sc.checkInitializer("scoped", ins)
+	}
+
+	for _, p := range providers {
+		pc := c
+		if p.cc != nil && p.cc != cc {
+			pc = c.scoped(p.cc)
+		}
+
+		source := "provider " + p.Name()
+		if _, ok := p.provider.(infra.ProviderBoot); !ok {
+			pc.checkMethodSignature(source, p.provider, "Boot", "func(infra.Resolver)")
+		}
+		if _, ok := p.provider.(infra.DaemonProvider); !ok {
+			pc.checkMethodSignature(source, p.provider, "Daemon", "func(context.Context, infra.Resolver)")
+		}
+		pc.checkAutowire(source, p.provider)
+	}
+
+	for _, s := range services {
+		source := "service " + s.Name()
+		if _, ok := s.service.(infra.Initializer); !ok {
+			c.checkMethodSignature(source, s.service, "Init", "func(infra.Resolver) error")
+		}
+		c.checkAutowire(source, s.service)
+	}
+
+	for _, hook := range impl.onServerReadyHooks {
+		c.checkFunc("onServerReady hook "+hook.name, reflect.TypeOf(hook.fn), contextType)
+	}
+
+	impl.asyncLock.RLock()
+	for _, job := range impl.asyncJobs {
+		sc.checkFunc("async job "+job.Name(), reflect.TypeOf(job.fn), contextType)
+	}
+	impl.asyncLock.RUnlock()
+
+	return *c.problems
+}
+
+func (c *bindingChecker) report(source string, format string, args ...interface{}) {
+	*c.problems = append(*c.problems, ValidationProblem{Source: source, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolvable 判断某个类型能否从容器中获取，与容器的查找规则保持一致
+func (c *bindingChecker) resolvable(typ reflect.Type, provided ...reflect.Type) bool {
+	for _, p := range provided {
+		if typ == p {
+			return true
+		}
+	}
+
+	if c.keys[typ] {
+		return true
+	}
+
+	return typ.Kind() == reflect.Ptr && typ.Elem().Kind() == reflect.Interface && c.keys[typ.Elem()]
+}
+
+// checkFunc 检查函数的所有参数能否被容器满足
+func (c *bindingChecker) checkFunc(source string, fnType reflect.Type, provided ...reflect.Type) {
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return
+	}
+
+	for i := 0; i < fnType.NumIn(); i++ {
+		if !c.resolvable(fnType.In(i), provided...) {
+			c.report(source, "argument %d of type %s is not bound in container", i, fnType.In(i))
+		}
+	}
+}
+
+func (c *bindingChecker) checkInitializer(kind string, ins interface{}) {
+	fnType := reflect.TypeOf(ins)
+	if fnType == nil || fnType.Kind() != reflect.Func || fnType.NumOut() == 0 {
+		return
+	}
+
+	c.checkFunc(fmt.Sprintf("%s %s", kind, fnType.Out(0)), fnType)
+}
+
+// checkMethodSignature 模块定义了与框架约定同名的方法，但是签名不匹配时，该方法永远不会被调用
+func (c *bindingChecker) checkMethodSignature(source string, module interface{}, name string, expected string) {
+	method, ok := reflect.TypeOf(module).MethodByName(name)
+	if !ok {
+		return
+	}
+
+	c.report(source, "method %s has signature %s, expected %s, it will never be called", name, methodSignature(method.Type), expected)
+}
+
+// methodSignature 返回去掉 receiver 之后的方法签名
+func methodSignature(typ reflect.Type) string {
+	ins := make([]string, 0, typ.NumIn())
+	for i := 1; i < typ.NumIn(); i++ {
+		ins = append(ins, typ.In(i).String())
+	}
+
+	outs := make([]string, 0, typ.NumOut())
+	for i := 0; i < typ.NumOut(); i++ {
+		outs = append(outs, typ.Out(i).String())
+	}
+
+	signature := "func(" + strings.Join(ins, ", ") + ")"
+	switch len(outs) {
+	case 0:
+		return signature
+	case 1:
+		return signature + " " + outs[0]
+	default:
+		return signature + " (" + strings.Join(outs, ", ") + ")"
+	}
+}
+
+// checkAutowire 检查模块中带有 autowire 标签的字段能否被容器满足
+func (c *bindingChecker) checkAutowire(source string, module interface{}) {
+	typ := reflect.TypeOf(module)
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	typ = typ.Elem()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("autowire")
+		switch tag {
+		case "", "-":
+			continue
+		case "@":
+			if !c.resolvable(field.Type) {
+				c.report(source, "autowired field %s of type %s is not bound in container", field.Name, field.Type)
+			}
+		default:
+			if !c.keys[tag] {
+				c.report(source, "autowired field %s with key %s is not bound in container", field.Name, tag)
+			}
+		}
+	}
+}
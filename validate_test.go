@@ -0,0 +1,87 @@
+package glacier
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mylxsw/glacier/infra"
+)
+
+type validateDep struct{}
+type validateMissingDep struct{}
+type validateScopedDep struct{}
+
+type validateProvider struct {
+	Dep     *validateDep        `autowire:"@"`
+	Missing *validateMissingDep `autowire:"@"`
+}
+
+func (*validateProvider) Register(binder infra.Binder)          {}
+func (*validateProvider) Boot(dep *validateDep, app infra.Hook) {}
+
+type validateService struct {
+	Dep *validateDep `autowire:"@"`
+}
+
+func (*validateService) Start() error { return nil }
+
+type validateSkippedProvider struct{}
+
+func (validateSkippedProvider) Register(binder infra.Binder) {}
+func (validateSkippedProvider) ShouldLoad() bool             { return false }
+
+func TestValidateBindings(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Singleton(func() *validateDep { return &validateDep{} })
+	impl.Provider(&validateProvider{}, validateSkippedProvider{})
+	impl.OnServerReady(func(dep *validateDep, missing validateMissingDep) {})
+	impl.Scoped(func(dep *validateDep) *validateScopedDep { return &validateScopedDep{} })
+	impl.Async(func(resolver infra.Resolver) {})
+	// 异步任务在作用域中执行，可以注入 infra.Scope 以及作用域绑定
+	impl.Async(func(scope infra.Scope, dep *validateScopedDep) {})
+
+	err := impl.Validate(NewFlagContext())
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 3 {
+		t.Fatalf("expect 3 problems, got %v", err)
+	}
+
+	t.Log(err)
+
+	// 校验不会修改注册的模块列表
+	if len(impl.providers) != 2 {
+		t.Errorf("validate should not filter registered providers, got %d", len(impl.providers))
+	}
+}
+
+func TestValidateRegistersServices(t *testing.T) {
+	impl := New("1.0", 1).(*framework)
+	impl.Provider(validateDepProvider{})
+
+	srv := &validateService{}
+	impl.Service(srv)
+
+	if err := impl.Validate(NewFlagContext()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 校验过程中会为 Service 注入依赖
+	if srv.Dep == nil {
+		t.Error("validate should register services")
+	}
+
+	// 校验在一次性容器以及 entry 的副本上进行
+	if impl.providers[0].cc != nil {
+		t.Error("validate should not modify registered provider entries")
+	}
+	if impl.cc.HasBound((*validateDep)(nil)) {
+		t.Error("validate should not register providers into the global container")
+	}
+}
+
+type validateDepProvider struct{}
+
+func (validateDepProvider) Register(binder infra.Binder) {
+	binder.MustSingleton(func() *validateDep { return &validateDep{} })
+}
@@ -20,6 +20,7 @@ type Config struct {
 	muxRouteHandler     MuxRouteHandler
 	initHandler         InitHandler
 	exceptionHandler    ExceptionHandler
+	healthRoutes        *healthRoutes
 
 	MultipartFormMaxMemory int64  // Multipart-form 解析占用最大内存
 	ViewTemplatePathPrefix string // 视图模板目录
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gorilla/sessions"
 	"github.com/gorilla/websocket"
+	"github.com/mylxsw/glacier/infra"
 	"github.com/mylxsw/go-ioc"
 	"github.com/pkg/errors"
 )
@@ -46,6 +47,8 @@ type webHandler struct {
 	container ioc.Container
 	router    *routerImpl
 	conf      *Config
+	// scopes 容器中绑定了 infra.ScopeFactory 并且存在作用域绑定时，每个请求都在独立的作用域中处理
+	scopes infra.ScopeFactory
 }
 
 // WebHandler 控制器方法
@@ -59,12 +62,18 @@ func newWebHandler(router *routerImpl, handler WebHandler, decors ...HandlerDeco
 	}
 
 	cc := router.container
-	return webHandler{
+	h := webHandler{
 		handle:    handler,
 		container: cc,
 		router:    router,
 		conf:      cc.MustGet(&Config{}).(*Config),
 	}
+
+	if scopes, err := cc.Get(new(infra.ScopeFactory)); err == nil {
+		h.scopes = scopes.(infra.ScopeFactory)
+	}
+
+	return h
 }
 
 // ServeHTTP 实现http.HandlerFunc接口
@@ -72,17 +81,31 @@ func (h webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(h.container.MustGet(new(context.Context)).(context.Context))
 	defer cancel()
 
+	// 没有作用域绑定时不创建作用域，避免每个请求都创建子容器
+	var cc ioc.Container = h.container
+	if h.scopes != nil && h.scopes.HasScoped() {
+		scope := h.scopes.NewScope(r.Context(), infra.ScopeHTTP, h.container)
+		defer scope.Close()
+		cc = scope
+	}
+
 	webCtx := &WebContext{
 		response: &HttpResponse{
 			w:       w,
 			headers: make(map[string]string),
 		},
-		request: &HttpRequest{r: r, cc: h.container, conf: *h.conf, router: h.router},
-		cc:      h.container,
+		request: &HttpRequest{r: r, cc: cc, conf: *h.conf, router: h.router},
+		cc:      cc,
 		conf:    *h.conf,
 		ctx:     ctx,
 	}
 
+	if scope, ok := cc.(infra.Scope); ok {
+		// 作用域绑定可以依赖当前请求
+		scope.MustSingletonOverride(func() Context { return webCtx })
+		scope.MustSingletonOverride(func() *http.Request { return r })
+	}
+
 	resp := h.handle(webCtx)
 	if resp != nil {
 		_ = resp.CreateResponse()
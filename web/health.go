@@ -0,0 +1,47 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/mylxsw/glacier/health"
+)
+
+const (
+	// DefaultLivenessPath 默认的存活检查路由
+	DefaultLivenessPath = "/healthz"
+	// DefaultReadinessPath 默认的就绪检查路由
+	DefaultReadinessPath = "/readyz"
+)
+
+type healthRoutes struct {
+	livenessPath  string
+	readinessPath string
+}
+
+// livenessReport 存活检查结果
+type livenessReport struct {
+	Live bool `json:"live"`
+}
+
+// registerHealthRoutes 注册存活检查和就绪检查路由
+// 存活检查只取决于应用的存活状态，不执行任何健康检查，避免依赖故障（比如数据库不可用）导致应用被重启；
+// 就绪检查要求应用处于存活、就绪状态并且所有健康检查通过
+func registerHealthRoutes(router Router, routes *healthRoutes) {
+	router.Get(routes.livenessPath, func(ctx Context, registry health.Registry) Response {
+		live := registry.Live()
+		return ctx.JSONWithCode(livenessReport{Live: live}, healthStatusCode(live))
+	})
+
+	router.Get(routes.readinessPath, func(ctx Context, registry health.Registry) Response {
+		report := registry.Check(ctx)
+		return ctx.JSONWithCode(report, healthStatusCode(report.Live && report.Ready && report.Status == health.StatusUp))
+	})
+}
+
+func healthStatusCode(ok bool) int {
+	if ok {
+		return http.StatusOK
+	}
+
+	return http.StatusServiceUnavailable
+}
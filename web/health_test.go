@@ -0,0 +1,45 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/glacier/health"
+	"github.com/mylxsw/go-ioc"
+)
+
+func TestHealthRoutes(t *testing.T) {
+	registry := health.NewRegistry(time.Second, 0)
+	registry.Register("db", health.CheckerFunc(func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+
+	cc := ioc.New()
+	cc.MustSingleton(func() health.Registry { return registry })
+
+	handler := NewServer(cc, SetHealthRoutesOption("", "")).(*serverImpl).router(cc)
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := probe(DefaultLivenessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("liveness should fail before application is live, got %d", code)
+	}
+
+	// 依赖检查失败只影响就绪检查，不影响存活检查
+	registry.SetLive(true)
+	registry.SetReady(true)
+	if code := probe(DefaultLivenessPath); code != http.StatusOK {
+		t.Errorf("liveness should not depend on health checks, got %d", code)
+	}
+
+	if code := probe(DefaultReadinessPath); code != http.StatusServiceUnavailable {
+		t.Errorf("readiness should fail when a health check fails, got %d", code)
+	}
+}
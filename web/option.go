@@ -89,6 +89,21 @@ func SetHttpIdleTimeoutOption(t time.Duration) Option {
 	}
 }
 
+// SetHealthRoutesOption 启用存活检查和就绪检查路由，路径为空时分别使用 /healthz 和 /readyz
+func SetHealthRoutesOption(livenessPath, readinessPath string) Option {
+	return func(cc infra.Resolver, conf *Config) {
+		if livenessPath == "" {
+			livenessPath = DefaultLivenessPath
+		}
+
+		if readinessPath == "" {
+			readinessPath = DefaultReadinessPath
+		}
+
+		conf.healthRoutes = &healthRoutes{livenessPath: livenessPath, readinessPath: readinessPath}
+	}
+}
+
 // SetOptions 设置 options，设置前可以获取到 infra.Resolver 实例
 func SetOptions(setter func(cc infra.Resolver) []Option) Option {
 	return func(resolver infra.Resolver, conf *Config) {
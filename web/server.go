@@ -20,6 +20,12 @@ type Server interface {
 	Options(cc infra.Resolver, options ...Option)
 }
 
+// RouteLister 实现该接口的 Server 支持在不启动 HTTP 服务的情况下列出所有路由
+type RouteLister interface {
+	// Routes 返回服务注册的所有路由，不会启动 HTTP 服务
+	Routes() []Route
+}
+
 // serverImpl is the web app
 type serverImpl struct {
 	cc     infra.Container
@@ -78,7 +84,7 @@ func (app *serverImpl) Start(listener net.Listener) error {
 			app.conf.serverConfigHandler(srv, listener)
 		}
 
-		gf.AddShutdownHandler(func() {
+		infra.AddShutdownHandlerInPhase(gf, infra.ShutdownPhaseStopTraffic, func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
@@ -113,7 +119,19 @@ func (app *serverImpl) Start(listener net.Listener) error {
 	})
 }
 
+// Routes 返回服务注册的所有路由，不会启动 HTTP 服务
+func (app *serverImpl) Routes() []Route {
+	_, muxRouter := app.buildRouter(app.cc)
+	return GetAllRoutes(muxRouter)
+}
+
 func (app *serverImpl) router(cc infra.Container) http.Handler {
+	handler, _ := app.buildRouter(cc)
+	return handler
+}
+
+// buildRouter 创建路由器并添加所有的路由规则
+func (app *serverImpl) buildRouter(cc infra.Container) (http.Handler, *mux.Router) {
 	router := NewRouterWithContainer(cc, app.conf)
 	mw := NewRequestMiddleware()
 
@@ -121,11 +139,19 @@ func (app *serverImpl) router(cc infra.Container) http.Handler {
 		app.conf.routeHandler(cc, router, mw)
 	}
 
-	return router.Perform(app.conf.exceptionHandler, func(muxRouter *mux.Router) {
+	if app.conf.healthRoutes != nil {
+		registerHealthRoutes(router, app.conf.healthRoutes)
+	}
+
+	var muxRouter *mux.Router
+	handler := router.Perform(app.conf.exceptionHandler, func(r *mux.Router) {
+		muxRouter = r
 		if app.conf.muxRouteHandler == nil {
 			return
 		}
 
-		app.conf.muxRouteHandler(cc, muxRouter)
+		app.conf.muxRouteHandler(cc, r)
 	})
+
+	return handler, muxRouter
 }